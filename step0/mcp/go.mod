@@ -2,7 +2,10 @@ module github.com/chiefkemist/speak-perf/step0/mcp
 
 go 1.24.4
 
-require github.com/mark3labs/mcp-go v0.33.0
+require (
+	github.com/mark3labs/mcp-go v0.33.0
+	github.com/mattn/go-sqlite3 v1.14.17
+)
 
 require (
 	github.com/google/uuid v1.6.0 // indirect
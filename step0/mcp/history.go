@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// history is the run history database, or nil when it is turned off or
+// couldn't be opened; the test tools run either way
+var history *sql.DB
+
+// historyTestTypes are the tools whose runs are recorded
+var historyTestTypes = []string{"load", "stress", "ramp"}
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS test_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	test_type TEXT NOT NULL,
+	url TEXT NOT NULL,
+	params TEXT,
+	started_at TIMESTAMP NOT NULL,
+	requests INTEGER,
+	avg_ms REAL,
+	min_ms REAL,
+	max_ms REAL,
+	p95_ms REAL,
+	error_rate REAL,
+	rps REAL,
+	results_file TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_test_runs_started_at ON test_runs(started_at);`
+
+// openHistory opens the run history database: MCP_HISTORY_DB, or history.db
+// in the results directory by default. It returns nil when MCP_HISTORY_DB is
+// "off".
+func openHistory() (*sql.DB, error) {
+	path := os.Getenv("MCP_HISTORY_DB")
+	if path == "off" {
+		return nil, nil
+	}
+	if path == "" {
+		dir, err := resultsDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "history.db")
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create history tables in %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// runMetrics are the aggregate HTTP metrics of a run
+type runMetrics struct {
+	Requests  int
+	AvgMs     float64
+	MinMs     float64
+	MaxMs     float64
+	P95Ms     float64
+	ErrorRate float64
+	RPS       float64
+	// DroppedIterations counts the iterations an arrival-rate scenario
+	// skipped for lack of VUs
+	DroppedIterations int
+}
+
+// summarizeResults aggregates the http_req_duration, http_req_failed and
+// dropped_iterations samples of a k6 JSON results file. The rate is over the span between the
+// first and last request.
+func summarizeResults(resultFile string) (runMetrics, error) {
+	data, err := os.ReadFile(resultFile)
+	if err != nil {
+		return runMetrics{}, err
+	}
+
+	var m runMetrics
+	var durations []float64
+	var failed, checked float64
+	var first, last time.Time
+	for _, line := range strings.Split(string(data), "\n") {
+		var metric K6Metric
+		if err := json.Unmarshal([]byte(line), &metric); err != nil || metric.Type != "Point" {
+			continue
+		}
+		value, ok := metric.Data["value"].(float64)
+		if !ok {
+			continue
+		}
+		switch metric.Metric {
+		case "http_req_duration":
+			durations = append(durations, value)
+			if ts, _ := metric.Data["time"].(string); ts != "" {
+				if at, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+					if first.IsZero() || at.Before(first) {
+						first = at
+					}
+					if at.After(last) {
+						last = at
+					}
+				}
+			}
+		case "http_req_failed":
+			failed += value
+			checked++
+		case "dropped_iterations":
+			m.DroppedIterations += int(value)
+		}
+	}
+	if len(durations) == 0 {
+		return m, nil
+	}
+
+	m.Requests = len(durations)
+	m.MinMs, m.MaxMs = math.Inf(1), math.Inf(-1)
+	var total float64
+	for _, d := range durations {
+		total += d
+		m.MinMs = math.Min(m.MinMs, d)
+		m.MaxMs = math.Max(m.MaxMs, d)
+	}
+	m.AvgMs = total / float64(m.Requests)
+	m.P95Ms = percentile(durations, 95)
+	if checked > 0 {
+		m.ErrorRate = failed / checked
+	}
+	if span := last.Sub(first).Seconds(); span > 0 {
+		m.RPS = float64(m.Requests) / span
+	}
+	return m, nil
+}
+
+// recordRun stores a completed run and its metrics in the history, returning
+// the run's id. It returns 0 without error when history is off.
+func recordRun(testType, url string, params interface{}, startedAt time.Time, resultFile string) (int64, error) {
+	if history == nil {
+		return 0, nil
+	}
+	m, err := summarizeResults(resultFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read results: %w", err)
+	}
+	paramsJSON, _ := json.Marshal(params)
+
+	result, err := history.Exec(`
+		INSERT INTO test_runs (test_type, url, params, started_at, requests, avg_ms, min_ms, max_ms, p95_ms, error_rate, rps, results_file)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		testType, url, string(paramsJSON), startedAt.UTC(), m.Requests, m.AvgMs, m.MinMs, m.MaxMs, m.P95Ms, m.ErrorRate, m.RPS, resultFile)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// historyNote is the line a test tool's result ends with once the run is recorded
+func historyNote(testType, url string, params interface{}, startedAt time.Time, resultFile string) string {
+	id, err := recordRun(testType, url, params, startedAt, resultFile)
+	if err != nil {
+		log.Printf("Failed to record %s run: %v", testType, err)
+		return fmt.Sprintf("History: not recorded (%v)\n", err)
+	}
+	if id == 0 {
+		return ""
+	}
+	return fmt.Sprintf("History: recorded as run %d\n", id)
+}
+
+func handleQueryHistory(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if history == nil {
+		return mcp.NewToolResultError("Run history is off: unset MCP_HISTORY_DB, or set it to a writable path, and restart the server"), nil
+	}
+
+	testType := request.GetString("testType", "")
+	url := request.GetString("url", "")
+	days := request.GetInt("days", 7)
+	limit := request.GetInt("limit", 20)
+	if testType != "" && !slices.Contains(historyTestTypes, testType) {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid testType %q: must be one of %s", testType, strings.Join(historyTestTypes, ", "))), nil
+	}
+	if days < 1 {
+		return mcp.NewToolResultError("days must be at least 1"), nil
+	}
+	if limit < 1 || limit > 500 {
+		return mcp.NewToolResultError("limit must be between 1 and 500"), nil
+	}
+
+	query := `
+		SELECT id, test_type, url, started_at, requests, avg_ms, p95_ms, error_rate, rps
+		FROM test_runs
+		WHERE started_at >= ?`
+	args := []interface{}{time.Now().UTC().AddDate(0, 0, -days)}
+	if testType != "" {
+		query += " AND test_type = ?"
+		args = append(args, testType)
+	}
+	if url != "" {
+		query += " AND url = ?"
+		args = append(args, url)
+	}
+	query += " ORDER BY started_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := history.Query(query, args...)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Query failed: %v", err)), nil
+	}
+	defer rows.Close()
+
+	report := fmt.Sprintf("# Test History (last %d days)\n\n", days)
+	report += "| Run | Started | Type | URL | Requests | Avg (ms) | p95 (ms) | Errors | Req/s |\n"
+	report += "|---|---|---|---|---|---|---|---|---|\n"
+	count := 0
+	for rows.Next() {
+		var id int64
+		var runType, runURL string
+		var startedAt time.Time
+		var requests int
+		var avg, p95, errorRate, rps float64
+		if err := rows.Scan(&id, &runType, &runURL, &startedAt, &requests, &avg, &p95, &errorRate, &rps); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read history: %v", err)), nil
+		}
+		report += fmt.Sprintf("| %d | %s | %s | %s | %d | %.2f | %.2f | %.2f%% | %.1f |\n",
+			id, startedAt.Local().Format("2006-01-02 15:04"), runType, runURL, requests, avg, p95, errorRate*100, rps)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read history: %v", err)), nil
+	}
+	if count == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("No runs recorded in the last %d days matching the filters.", days)), nil
+	}
+	return mcp.NewToolResultText(report), nil
+}
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -46,6 +50,11 @@ func main() {
 		mcp.WithString("duration", mcp.Description("Test duration")),
 		mcp.WithString("method", mcp.Description("HTTP method (GET, POST, etc.)")),
 		mcp.WithString("payload", mcp.Description("Request payload for POST/PUT")),
+		mcp.WithNumber("thinkTime", mcp.Description("Seconds to sleep between requests (default: 0)")),
+		mcp.WithBoolean("keepAlive", mcp.Description("Reuse connections between requests (default: true)")),
+		mcp.WithNumber("maxErrorRate", mcp.Description("Fail the test when more than this fraction of requests fail, 0-1 (default: 0.1)")),
+		mcp.WithNumber("preAllocatedVus", mcp.Description("Virtual users k6 starts before the test (default: sized from rps)")),
+		mcp.WithNumber("maxVus", mcp.Description("Maximum virtual users k6 may start to keep up the rate (default: sized from rps)")),
 	)
 	s.AddTool(loadTool, handleLoadTest)
 
@@ -57,9 +66,23 @@ func main() {
 		mcp.WithNumber("startVus", mcp.Description("Starting virtual users")),
 		mcp.WithNumber("maxVus", mcp.Description("Maximum virtual users")),
 		mcp.WithString("rampDuration", mcp.Description("Duration to ramp up users")),
+		mcp.WithString("hold", mcp.Description("Duration to hold at maxVus")),
+		mcp.WithString("rampDown", mcp.Description("Duration to ramp down to zero users")),
+		mcp.WithNumber("maxErrorRate", mcp.Description("Fail the test when more than this fraction of requests fail, 0-1 (default: 0.5)")),
 	)
 	s.AddTool(stressTool, handleStressTest)
 
+	// Add ramping arrival-rate test tool
+	rampTool := mcp.NewTool(
+		"run_ramp_test",
+		mcp.WithDescription("Run a test whose request rate ramps through stages, e.g. 100 to 1000 to 100 req/s"),
+		mcp.WithString("url", mcp.Required(), mcp.Description("Target URL to test")),
+		mcp.WithString("stages", mcp.Required(), mcp.Description(`Stages as a JSON array, e.g. [{"duration": "1m", "targetRps": 1000}, {"duration": "30s", "targetRps": 100}]`)),
+		mcp.WithNumber("startRps", mcp.Description("Requests per second at the start of the first stage (default: 0)")),
+		mcp.WithNumber("maxVus", mcp.Description("Maximum virtual users k6 may start to keep up the rate (default: sized from the peak rate)")),
+	)
+	s.AddTool(rampTool, handleRampTest)
+
 	// Add performance report tool
 	reportTool := mcp.NewTool(
 		"generate_report",
@@ -69,6 +92,24 @@ func main() {
 	)
 	s.AddTool(reportTool, handleGenerateReport)
 
+	// Add history query tool
+	historyTool := mcp.NewTool(
+		"query_history",
+		mcp.WithDescription("List recorded load, stress and ramp test runs with their metrics"),
+		mcp.WithString("testType", mcp.Description("Only runs of this type: load, stress or ramp")),
+		mcp.WithString("url", mcp.Description("Only runs against this exact URL")),
+		mcp.WithNumber("days", mcp.Description("How many days back to look (default: 7)")),
+		mcp.WithNumber("limit", mcp.Description("Most runs to list, newest first (default: 20)")),
+	)
+	s.AddTool(historyTool, handleQueryHistory)
+
+	// Runs are recorded when history opens; the tools work without it
+	db, err := openHistory()
+	if err != nil {
+		log.Printf("Run history disabled: %v", err)
+	}
+	history = db
+
 	// Start server with stdio transport
 	if err := server.ServeStdio(s); err != nil {
 		log.Fatal(err)
@@ -86,8 +127,11 @@ func handleK6Test(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallTo
 	duration := request.GetString("duration", "30s")
 
 	// Execute k6 test with JSON output
-	resultFile := fmt.Sprintf("/tmp/k6-results-%d.json", time.Now().Unix())
-	defer os.Remove(resultFile)
+	dir, err := resultsDir()
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	resultFile := filepath.Join(dir, fmt.Sprintf("k6-results-%d.json", time.Now().Unix()))
 	
 	result, err := executeK6TestWithJSON(ctx, script, vus, duration, resultFile)
 	if err != nil {
@@ -96,7 +140,7 @@ func handleK6Test(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallTo
 	
 	// Parse and format results
 	report := parseK6Results(resultFile)
-	return mcp.NewToolResultText(result + "\n\n" + report), nil
+	return mcp.NewToolResultText(result + "\n\n" + report + "\nRaw results: " + resultFile + "\n"), nil
 }
 
 
@@ -111,9 +155,40 @@ func handleLoadTest(ctx context.Context, request mcp.CallToolRequest) (*mcp.Call
 	duration := request.GetString("duration", "60s")
 	method := request.GetString("method", "GET")
 	payload := request.GetString("payload", "")
+	thinkTime := request.GetFloat("thinkTime", 0)
+	keepAlive := request.GetBool("keepAlive", true)
+	maxErrorRate := request.GetFloat("maxErrorRate", 0.1)
+
+	if thinkTime < 0 {
+		return mcp.NewToolResultError("thinkTime must not be negative"), nil
+	}
+	if maxErrorRate < 0 || maxErrorRate > 1 {
+		return mcp.NewToolResultError("maxErrorRate must be between 0 and 1"), nil
+	}
+	if _, err := time.ParseDuration(duration); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid duration %q: use a value such as 30s or 5m", duration)), nil
+	}
+
+	// VUs are sized as for a ramp test that holds rps throughout
+	preAllocatedVUs := request.GetInt("preAllocatedVus", 0)
+	maxVUs := request.GetInt("maxVus", 0)
+	if preAllocatedVUs < 0 || maxVUs < 0 {
+		return mcp.NewToolResultError("preAllocatedVus and maxVus must not be negative"), nil
+	}
+	sizing := rampTestParams{StartRate: int(rps)}
+	sizing.size(maxVUs)
+	if preAllocatedVUs > 0 {
+		sizing.PreAllocatedVUs = preAllocatedVUs
+		if maxVUs == 0 {
+			sizing.MaxVUs = max(sizing.MaxVUs, preAllocatedVUs)
+		}
+	}
+	if sizing.MaxVUs < sizing.PreAllocatedVUs {
+		return mcp.NewToolResultError(fmt.Sprintf("maxVus must be at least %d, the preallocated VUs", sizing.PreAllocatedVUs)), nil
+	}
 
 	// Create a temporary k6 script
-	script := generateLoadTestScript(url, rps, duration, method, payload)
+	script := generateLoadTestScript(url, rps, duration, method, payload, thinkTime, keepAlive, maxErrorRate, sizing.PreAllocatedVUs, sizing.MaxVUs)
 	
 	// Write script to temp file
 	tmpFile, err := os.CreateTemp("", "k6-load-test-*.js")
@@ -128,17 +203,41 @@ func handleLoadTest(ctx context.Context, request mcp.CallToolRequest) (*mcp.Call
 	tmpFile.Close()
 
 	// Execute the test with JSON output
-	resultFile := fmt.Sprintf("/tmp/k6-load-results-%d.json", time.Now().Unix())
-	defer os.Remove(resultFile)
-	
-	result, err := executeK6TestWithJSON(ctx, tmpFile.Name(), 10, duration, resultFile)
+	dir, err := resultsDir()
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Load test failed: %v", err)), nil
+		return mcp.NewToolResultError(err.Error()), nil
 	}
+	resultFile := filepath.Join(dir, fmt.Sprintf("k6-load-results-%d.json", time.Now().Unix()))
 	
+	// The scenario sets the rate, duration and VUs, so no --vus/--duration
+	// flags, which would replace it
+	startedAt := time.Now()
+	result, err := executeK6TestWithJSON(ctx, tmpFile.Name(), 0, "", resultFile)
+	if err != nil && !thresholdsCrossed(err) {
+		return mcp.NewToolResultError(fmt.Sprintf("Load test failed: %v", err)), nil
+	}
+	params := map[string]interface{}{
+		"rps":             rps,
+		"duration":        duration,
+		"method":          method,
+		"thinkTime":       thinkTime,
+		"keepAlive":       keepAlive,
+		"maxErrorRate":    maxErrorRate,
+		"preAllocatedVus": sizing.PreAllocatedVUs,
+		"maxVus":          sizing.MaxVUs,
+	}
+
+	sizingNote := fmt.Sprintf("Rate %d req/s; %d VUs preallocated, up to %d\n", int(rps), sizing.PreAllocatedVUs, sizing.MaxVUs)
+	sizingNote += droppedIterationsWarning(resultFile, sizing.MaxVUs)
+
 	// Parse and format results
 	report := parseK6Results(resultFile)
-	return mcp.NewToolResultText(result + "\n\n" + report), nil
+	note := historyNote("load", url, params, startedAt, resultFile)
+	text := result + "\n\n" + sizingNote + "\n" + report + "\nRaw results: " + resultFile + "\n" + note
+	if failure := runFailure(resultFile, maxErrorRate, err); failure != "" {
+		return mcp.NewToolResultError("Load test failed: " + failure + "\n\n" + text), nil
+	}
+	return mcp.NewToolResultText(text), nil
 }
 
 func handleStressTest(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -148,12 +247,29 @@ func handleStressTest(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 	}
 
 	// Get optional parameters
-	startVus := request.GetInt("startVus", 1)
-	maxVus := request.GetInt("maxVus", 100)
-	rampDuration := request.GetString("rampDuration", "5m")
+	params := stressTestParams{
+		StartVUs: request.GetInt("startVus", 1),
+		MaxVUs:   request.GetInt("maxVus", 100),
+		RampUp:   request.GetString("rampDuration", "5m"),
+		Hold:     request.GetString("hold", "10s"),
+		RampDown: request.GetString("rampDown", "1m"),
+
+		MaxErrorRate: request.GetFloat("maxErrorRate", 0.5),
+	}
+	if params.StartVUs < 0 || params.MaxVUs < 1 {
+		return mcp.NewToolResultError("startVus must be at least 0 and maxVus at least 1"), nil
+	}
+	if params.MaxErrorRate < 0 || params.MaxErrorRate > 1 {
+		return mcp.NewToolResultError("maxErrorRate must be between 0 and 1"), nil
+	}
+	for _, d := range []string{params.RampUp, params.Hold, params.RampDown} {
+		if _, err := time.ParseDuration(d); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid duration %q: use a value such as 30s or 5m", d)), nil
+		}
+	}
 
 	// Create stress test script
-	script := generateStressTestScript(url, startVus, maxVus, rampDuration)
+	script := generateStressTestScript(url, params)
 	
 	// Write script to temp file
 	tmpFile, err := os.CreateTemp("", "k6-stress-test-*.js")
@@ -168,29 +284,111 @@ func handleStressTest(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 	tmpFile.Close()
 
 	// Execute with stages and JSON output
-	resultFile := fmt.Sprintf("/tmp/k6-stress-results-%d.json", time.Now().Unix())
-	defer os.Remove(resultFile)
+	dir, err := resultsDir()
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	resultFile := filepath.Join(dir, fmt.Sprintf("k6-stress-results-%d.json", time.Now().Unix()))
 	
 	args := []string{"run", "--out", fmt.Sprintf("json=%s", resultFile), tmpFile.Name()}
-	cmd := exec.CommandContext(ctx, "k6", args...)
+	cmd := exec.CommandContext(ctx, k6Binary(), args...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
+	// k6 exits 99 when the run crossed its thresholds; it still completed,
+	// so it is reported and recorded below
+	startedAt := time.Now()
 	err = cmd.Run()
-	output := stdout.String()
-	if stderr.Len() > 0 {
-		output += "\n\nErrors:\n" + stderr.String()
+	if err != nil && !thresholdsCrossed(err) {
+		return mcp.NewToolResultError(fmt.Sprintf("Stress test failed: %v", &k6Error{err: err, stdout: stdout.String(), stderr: stderr.String()})), nil
 	}
+	output := k6ConsoleOutput(stdout.String(), stderr.String())
+	
+	// Parse and format results
+	report := parseK6Results(resultFile)
+	note := historyNote("stress", url, params, startedAt, resultFile)
+	text := output + "\n\n" + report + "\nRaw results: " + resultFile + "\n" + note
+	if failure := runFailure(resultFile, params.MaxErrorRate, err); failure != "" {
+		return mcp.NewToolResultError("Stress test failed: " + failure + "\n\n" + text), nil
+	}
+	return mcp.NewToolResultText(text), nil
+}
 
+func handleRampTest(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	url, err := request.RequireString("url")
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Stress test failed: %v\n%s", err, output)), nil
+		return mcp.NewToolResultError("Missing required url parameter"), nil
 	}
-	
+	stagesJSON, err := request.RequireString("stages")
+	if err != nil {
+		return mcp.NewToolResultError("Missing required stages parameter"), nil
+	}
+
+	stages, err := parseRampStages(stagesJSON)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid stages: %v", err)), nil
+	}
+	params := rampTestParams{
+		StartRate: request.GetInt("startRps", 0),
+		Stages:    stages,
+	}
+	if params.StartRate < 0 {
+		return mcp.NewToolResultError("startRps must not be negative"), nil
+	}
+	params.size(request.GetInt("maxVus", 0))
+	if params.MaxVUs < params.PreAllocatedVUs {
+		return mcp.NewToolResultError(fmt.Sprintf("maxVus must be at least %d, the VUs allocated for the starting rate", params.PreAllocatedVUs)), nil
+	}
+
+	// Create ramp test script
+	script := generateRampTestScript(url, params)
+
+	// Write script to temp file
+	tmpFile, err := os.CreateTemp("", "k6-ramp-test-*.js")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to create temp file: %v", err)), nil
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(script); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to write script: %v", err)), nil
+	}
+	tmpFile.Close()
+
+	// The scenario sets the rate and VUs, so no --vus/--duration flags here
+	dir, err := resultsDir()
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	resultFile := filepath.Join(dir, fmt.Sprintf("k6-ramp-results-%d.json", time.Now().Unix()))
+
+	args := []string{"run", "--out", fmt.Sprintf("json=%s", resultFile), tmpFile.Name()}
+	cmd := exec.CommandContext(ctx, k6Binary(), args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	startedAt := time.Now()
+	err = cmd.Run()
+	if err != nil && !thresholdsCrossed(err) {
+		return mcp.NewToolResultError(fmt.Sprintf("Ramp test failed: %v", &k6Error{err: err, stdout: stdout.String(), stderr: stderr.String()})), nil
+	}
+	output := k6ConsoleOutput(stdout.String(), stderr.String())
+
+	sizing := fmt.Sprintf("Peak rate %d req/s; %d VUs preallocated, up to %d\n", params.PeakRate(), params.PreAllocatedVUs, params.MaxVUs)
+	sizing += droppedIterationsWarning(resultFile, params.MaxVUs)
+
 	// Parse and format results
 	report := parseK6Results(resultFile)
-	return mcp.NewToolResultText(output + "\n\n" + report), nil
+	note := historyNote("ramp", url, params, startedAt, resultFile)
+	text := output + "\n\n" + sizing + "\n" + report + "\nRaw results: " + resultFile + "\n" + note
+	if thresholdsCrossed(err) {
+		return mcp.NewToolResultError("Ramp test failed: " + runFailure(resultFile, 0.1, err) + "\n\n" + text), nil
+	}
+	return mcp.NewToolResultText(text), nil
 }
 
 func handleGenerateReport(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -213,6 +411,11 @@ func handleGenerateReport(_ context.Context, request mcp.CallToolRequest) (*mcp.
 		report = generateJSONReport(resultFile)
 	case "html":
 		report = generateHTMLReport(resultFile)
+		htmlFile := strings.TrimSuffix(resultFile, filepath.Ext(resultFile)) + ".html"
+		if err := os.WriteFile(htmlFile, []byte(report), 0644); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to write HTML report: %v", err)), nil
+		}
+		report = fmt.Sprintf("HTML report written to %s\n\n%s", htmlFile, report)
 	default:
 		report = parseK6Results(resultFile)
 	}
@@ -220,7 +423,35 @@ func handleGenerateReport(_ context.Context, request mcp.CallToolRequest) (*mcp.
 	return mcp.NewToolResultText(report), nil
 }
 
-func generateLoadTestScript(url string, rps float64, duration string, method string, payload string) string {
+// k6Binary returns the k6 executable: K6_BINARY if set (e.g. a build with xk6
+// extensions), otherwise k6 on PATH
+func k6Binary() string {
+	if binary := os.Getenv("K6_BINARY"); binary != "" {
+		return binary
+	}
+	return "k6"
+}
+
+// resultsDir returns the directory k6 results are kept in: MCP_RESULTS_DIR,
+// or ~/.speak-perf-mcp/results by default. The directory is created if missing.
+func resultsDir() (string, error) {
+	dir := os.Getenv("MCP_RESULTS_DIR")
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			dir = filepath.Join(os.TempDir(), "speak-perf-mcp", "results")
+		} else {
+			dir = filepath.Join(homeDir, ".speak-perf-mcp", "results")
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create results directory %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+func generateLoadTestScript(url string, rps float64, duration string, method string, payload string, thinkTime float64, keepAlive bool, maxErrorRate float64, preAllocatedVUs, maxVUs int) string {
 	script := fmt.Sprintf(`import http from 'k6/http';
 import { check, sleep } from 'k6';
 import { Rate } from 'k6/metrics';
@@ -228,19 +459,20 @@ import { Rate } from 'k6/metrics';
 const errorRate = new Rate('errors');
 
 export const options = {
+  noConnectionReuse: %t,
   scenarios: {
     constant_request_rate: {
       executor: 'constant-arrival-rate',
       rate: %d,
       timeUnit: '1s',
       duration: '%s',
-      preAllocatedVUs: 10,
-      maxVUs: 100,
+      preAllocatedVUs: %d,
+      maxVUs: %d,
     },
   },
   thresholds: {
     http_req_duration: ['p(95)<500'],
-    errors: ['rate<0.1'],
+    errors: ['rate<%g'],
   },
 };
 
@@ -249,7 +481,7 @@ export default function () {
     headers: { 'Content-Type': 'application/json' },
   };
   
-`, int(rps), duration)
+`, !keepAlive, int(rps), duration, preAllocatedVUs, maxVUs, maxErrorRate)
 
 	if method == "GET" {
 		script += fmt.Sprintf(`  const res = http.get('%s', params);`, url)
@@ -267,24 +499,146 @@ export default function () {
   });
   
   errorRate.add(!success);
-}
 `
+	if thinkTime > 0 {
+		script += fmt.Sprintf("\n  sleep(%g);\n", thinkTime)
+	}
+	script += "}\n"
 	return script
 }
 
-func generateStressTestScript(url string, _ int, maxVus int, rampDuration string) string {
+// stressTestParams shapes the stages of a generated stress test
+type stressTestParams struct {
+	StartVUs int
+	MaxVUs   int
+	RampUp   string
+	Hold     string
+	RampDown string
+	// MaxErrorRate is the highest fraction of failed requests that passes
+	MaxErrorRate float64
+}
+
+// rampStage is one stage of a ramping arrival-rate test: the rate moves
+// linearly to TargetRps over Duration
+type rampStage struct {
+	Duration  string  `json:"duration"`
+	TargetRps float64 `json:"targetRps"`
+}
+
+// parseRampStages parses and validates the stages of a ramp test
+func parseRampStages(value string) ([]rampStage, error) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	var stages []rampStage
+	if err := decoder.Decode(&stages); err != nil {
+		return nil, fmt.Errorf(`must be a JSON array such as [{"duration": "1m", "targetRps": 100}]: %v`, err)
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("at least one stage is needed")
+	}
+	for i, stage := range stages {
+		d, err := time.ParseDuration(stage.Duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("stage %d: invalid duration %q: use a value such as 30s or 5m", i+1, stage.Duration)
+		}
+		if stage.TargetRps < 0 || stage.TargetRps != math.Trunc(stage.TargetRps) {
+			return nil, fmt.Errorf("stage %d: targetRps must be a whole number of at least 0, got %v", i+1, stage.TargetRps)
+		}
+	}
+	return stages, nil
+}
+
+// rampIterationTime is the iteration time VUs are sized for: twice the
+// script's 500ms p95 threshold, so responses can slow down before k6 runs
+// out of VUs and drops iterations
+const rampIterationTime = time.Second
+
+// rampTestParams shapes the scenario of a generated ramp test
+type rampTestParams struct {
+	StartRate       int
+	Stages          []rampStage
+	PreAllocatedVUs int
+	MaxVUs          int
+}
+
+// PeakRate is the highest rate the test reaches
+func (p rampTestParams) PeakRate() int {
+	peak := p.StartRate
+	for _, stage := range p.Stages {
+		peak = max(peak, int(stage.TargetRps))
+	}
+	return peak
+}
+
+// size sets the VUs: enough preallocated for the starting rate, and maxVUs
+// for the peak unless maxVUs is given
+func (p *rampTestParams) size(maxVUs int) {
+	vusFor := func(rate int) int {
+		return max(1, int(math.Ceil(float64(rate)*rampIterationTime.Seconds())))
+	}
+	p.PreAllocatedVUs = vusFor(p.StartRate)
+	p.MaxVUs = vusFor(p.PeakRate())
+	if maxVUs > 0 {
+		p.MaxVUs = maxVUs
+	}
+}
+
+func generateRampTestScript(url string, params rampTestParams) string {
+	stages := ""
+	for _, stage := range params.Stages {
+		stages += fmt.Sprintf("        { duration: '%s', target: %d },\n", stage.Duration, int(stage.TargetRps))
+	}
+
+	return fmt.Sprintf(`import http from 'k6/http';
+import { check } from 'k6';
+
+export const options = {
+  scenarios: {
+    ramp: {
+      executor: 'ramping-arrival-rate',
+      startRate: %d,
+      timeUnit: '1s',
+      preAllocatedVUs: %d,
+      maxVUs: %d,
+      stages: [
+%s      ],
+    },
+  },
+  thresholds: {
+    http_req_duration: ['p(95)<500'],
+    http_req_failed: ['rate<0.1'],
+  },
+};
+
+export default function () {
+  const res = http.get('%s');
+  check(res, {
+    'status is 200': (r) => r.status === 200,
+    'response time < 500ms': (r) => r.timings.duration < 500,
+  });
+}
+`, params.StartRate, params.PreAllocatedVUs, params.MaxVUs, stages, url)
+}
+
+func generateStressTestScript(url string, params stressTestParams) string {
 	return fmt.Sprintf(`import http from 'k6/http';
 import { check, sleep } from 'k6';
 
 export const options = {
-  stages: [
-    { duration: '%s', target: %d },
-    { duration: '10s', target: %d },
-    { duration: '1m', target: 0 },
-  ],
+  scenarios: {
+    stress: {
+      executor: 'ramping-vus',
+      startVUs: %d,
+      stages: [
+        { duration: '%s', target: %d },
+        { duration: '%s', target: %d },
+        { duration: '%s', target: 0 },
+      ],
+    },
+  },
   thresholds: {
     http_req_duration: ['p(95)<2000'],
-    http_req_failed: ['rate<0.5'],
+    http_req_failed: ['rate<%g'],
   },
 };
 
@@ -295,7 +649,7 @@ export default function () {
   });
   sleep(1);
 }
-`, rampDuration, maxVus, maxVus, url)
+`, params.StartVUs, params.RampUp, params.MaxVUs, params.Hold, params.MaxVUs, params.RampDown, params.MaxErrorRate, url)
 }
 
 func executeK6TestWithJSON(ctx context.Context, scriptPath string, vus int, duration string, outputFile string) (string, error) {
@@ -305,13 +659,18 @@ func executeK6TestWithJSON(ctx context.Context, scriptPath string, vus int, dura
 	}
 
 	// Build k6 command with JSON output
+	// Scripts whose scenario sets the VUs and duration pass 0 and ""
 	args := []string{"run"}
-	args = append(args, "--vus", strconv.Itoa(vus))
-	args = append(args, "--duration", duration)
+	if vus > 0 {
+		args = append(args, "--vus", strconv.Itoa(vus))
+	}
+	if duration != "" {
+		args = append(args, "--duration", duration)
+	}
 	args = append(args, "--out", fmt.Sprintf("json=%s", outputFile))
 	args = append(args, scriptPath)
 
-	cmd := exec.CommandContext(ctx, "k6", args...)
+	cmd := exec.CommandContext(ctx, k6Binary(), args...)
 
 	// Capture output
 	var stdout, stderr bytes.Buffer
@@ -321,17 +680,91 @@ func executeK6TestWithJSON(ctx context.Context, scriptPath string, vus int, dura
 	// Run the command
 	err := cmd.Run()
 
-	// Combine outputs
-	output := stdout.String()
-	if stderr.Len() > 0 {
-		output += "\n\nErrors:\n" + stderr.String()
+	if err != nil && !thresholdsCrossed(err) {
+		return "", &k6Error{err: err, stdout: stdout.String(), stderr: stderr.String()}
 	}
 
-	if err != nil {
-		return output, fmt.Errorf("k6 execution failed: %w", err)
+	// A run that crossed its thresholds completed, so its output comes back
+	// with the error
+	return k6ConsoleOutput(stdout.String(), stderr.String()), err
+}
+
+// k6Error is a failed k6 run. Its message leads with stderr, where k6 reports
+// script and runtime errors, so they aren't lost among the progress output.
+type k6Error struct {
+	err    error
+	stdout string
+	stderr string
+}
+
+func (e *k6Error) Error() string {
+	msg := fmt.Sprintf("k6 execution failed: %v", e.err)
+	if stderr := strings.TrimSpace(e.stderr); stderr != "" {
+		msg += "\n\nstderr:\n" + stderr
+	}
+	if stdout := strings.TrimSpace(e.stdout); stdout != "" {
+		msg += "\n\nstdout:\n" + stdout
+	}
+	return msg
+}
+
+func (e *k6Error) Unwrap() error {
+	return e.err
+}
+
+// k6ThresholdsFailedExitCode is k6's exit code for a run that completed but
+// crossed one of its thresholds
+const k6ThresholdsFailedExitCode = 99
+
+// thresholdsCrossed reports whether err is k6 exiting because the run crossed
+// its thresholds. The run itself completed, so its results are reported and
+// recorded like a passing run's.
+func thresholdsCrossed(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == k6ThresholdsFailedExitCode
+}
+
+// runFailure explains why a completed run failed: more than maxErrorRate of
+// its requests failed, or k6 reported another threshold crossed. It returns
+// "" for a run that passed.
+func runFailure(resultFile string, maxErrorRate float64, err error) string {
+	if failure := errorRateFailure(resultFile, maxErrorRate); failure != "" {
+		return failure
+	}
+	if thresholdsCrossed(err) {
+		return "k6 reported crossed thresholds, marked ✗ in its summary"
 	}
+	return ""
+}
 
-	return output, nil
+// errorRateFailure explains why a completed run failed because more than
+// maxErrorRate of its requests failed, or returns "" when it didn't
+func errorRateFailure(resultFile string, maxErrorRate float64) string {
+	m, err := summarizeResults(resultFile)
+	if err != nil || m.ErrorRate <= maxErrorRate {
+		return ""
+	}
+	return fmt.Sprintf("%.2f%% of requests failed, above the maxErrorRate of %.2f%%", m.ErrorRate*100, maxErrorRate*100)
+}
+
+// droppedIterationsWarning warns when k6 ran out of VUs for an arrival-rate
+// scenario and dropped iterations, so the rate asked for wasn't reached. It
+// returns "" when none were dropped.
+func droppedIterationsWarning(resultFile string, maxVUs int) string {
+	m, err := summarizeResults(resultFile)
+	if err != nil || m.DroppedIterations == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Warning: k6 dropped %d iterations because all %d VUs were busy, so the requested rate wasn't reached. Raise maxVus or lower the rate.\n", m.DroppedIterations, maxVUs)
+}
+
+// k6ConsoleOutput renders a successful run's output: the end-of-test summary
+// from stdout, then k6's log output from stderr
+func k6ConsoleOutput(stdout, stderr string) string {
+	if strings.TrimSpace(stderr) == "" {
+		return stdout
+	}
+	return stdout + "\n\nk6 log output (stderr):\n" + stderr
 }
 
 // K6Metric represents a k6 metric data point
@@ -463,11 +896,12 @@ func generateJSONReport(resultFile string) string {
 
 func generateHTMLReport(resultFile string) string {
 	markdownReport := parseK6Results(resultFile)
-	
-	// Simple HTML wrapper
+
+	// Standalone HTML; charts are inline SVG so the file opens without network access
 	html := `<!DOCTYPE html>
 <html>
 <head>
+    <meta charset="utf-8">
     <title>K6 Performance Test Report</title>
     <style>
         body { font-family: Arial, sans-serif; margin: 40px; }
@@ -476,11 +910,44 @@ func generateHTMLReport(resultFile string) string {
         h3 { color: #999; }
         ul { list-style-type: none; }
         li { margin: 5px 0; }
+        svg { display: block; margin: 10px 0 30px; }
+        svg text { font-size: 11px; fill: #666; }
+        .note { color: #999; font-style: italic; }
     </style>
 </head>
 <body>
 `
-	
+
+	// Charts over the run, when there are enough samples to draw a line
+	buckets := latencyTimeSeries(resultFile)
+	if len(buckets) >= 2 {
+		elapsed := make([]float64, len(buckets))
+		p50 := make([]float64, len(buckets))
+		p95 := make([]float64, len(buckets))
+		p99 := make([]float64, len(buckets))
+		rps := make([]float64, len(buckets))
+		for i, b := range buckets {
+			elapsed[i] = b.offset
+			p50[i] = percentile(b.durations, 50)
+			p95[i] = percentile(b.durations, 95)
+			p99[i] = percentile(b.durations, 99)
+			rps[i] = float64(len(b.durations)) / b.width
+		}
+
+		html += "<h2>Response Time Percentiles</h2>\n"
+		html += renderLineChart(elapsed, "ms", []chartSeries{
+			{name: "p50", color: "#4caf50", values: p50},
+			{name: "p95", color: "#ff9800", values: p95},
+			{name: "p99", color: "#f44336", values: p99},
+		})
+		html += "<h2>Requests per Second</h2>\n"
+		html += renderLineChart(elapsed, "req/s", []chartSeries{
+			{name: "rps", color: "#2196f3", values: rps},
+		})
+	} else {
+		html += `<p class="note">Not enough time-series data to chart; showing summary only.</p>` + "\n"
+	}
+
 	// Convert markdown to basic HTML
 	lines := strings.Split(markdownReport, "\n")
 	for _, line := range lines {
@@ -498,8 +965,167 @@ func generateHTMLReport(resultFile string) string {
 			html += fmt.Sprintf("<p>%s</p>\n", line)
 		}
 	}
-	
+
 	html += `</body>
 </html>`
 	return html
 }
+
+// maxChartPoints caps how many time buckets are plotted so long runs stay readable
+const maxChartPoints = 120
+
+type timeBucket struct {
+	offset    float64 // seconds since the first request
+	width     float64 // bucket width in seconds
+	durations []float64
+}
+
+// latencyTimeSeries groups http_req_duration samples into equal time buckets
+func latencyTimeSeries(resultFile string) []timeBucket {
+	data, err := os.ReadFile(resultFile)
+	if err != nil {
+		return nil
+	}
+
+	type sample struct {
+		at    time.Time
+		value float64
+	}
+	var samples []sample
+	for _, line := range strings.Split(string(data), "\n") {
+		var metric K6Metric
+		if err := json.Unmarshal([]byte(line), &metric); err != nil {
+			continue
+		}
+		if metric.Type != "Point" || metric.Metric != "http_req_duration" {
+			continue
+		}
+		value, ok := metric.Data["value"].(float64)
+		if !ok {
+			continue
+		}
+		ts, _ := metric.Data["time"].(string)
+		at, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, sample{at: at, value: value})
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	start, end := samples[0].at, samples[0].at
+	for _, s := range samples {
+		if s.at.Before(start) {
+			start = s.at
+		}
+		if s.at.After(end) {
+			end = s.at
+		}
+	}
+
+	// One-second buckets, widened for long runs
+	total := end.Sub(start).Seconds()
+	width := 1.0
+	if total/width > maxChartPoints {
+		width = math.Ceil(total / maxChartPoints)
+	}
+
+	buckets := make([]timeBucket, int(total/width)+1)
+	for i := range buckets {
+		buckets[i] = timeBucket{offset: float64(i) * width, width: width}
+	}
+	for _, s := range samples {
+		i := int(s.at.Sub(start).Seconds() / width)
+		buckets[i].durations = append(buckets[i].durations, s.value)
+	}
+
+	// Drop empty buckets rather than plotting them as zero latency
+	filled := buckets[:0]
+	for _, b := range buckets {
+		if len(b.durations) > 0 {
+			filled = append(filled, b)
+		}
+	}
+	return filled
+}
+
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+type chartSeries struct {
+	name   string
+	color  string
+	values []float64
+}
+
+// renderLineChart draws the series against elapsed seconds as an inline SVG
+func renderLineChart(elapsed []float64, unit string, series []chartSeries) string {
+	const (
+		width, height = 800.0, 260.0
+		left, right   = 60.0, 20.0
+		top, bottom   = 20.0, 40.0
+	)
+	plotW, plotH := width-left-right, height-top-bottom
+
+	maxX := elapsed[len(elapsed)-1]
+	if maxX == 0 {
+		maxX = 1
+	}
+	maxY := 0.0
+	for _, s := range series {
+		for _, v := range s.values {
+			maxY = math.Max(maxY, v)
+		}
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+	maxY *= 1.1
+
+	x := func(v float64) float64 { return left + v/maxX*plotW }
+	y := func(v float64) float64 { return top + plotH - v/maxY*plotH }
+
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`+"\n", width, height, width, height)
+
+	// Horizontal grid lines with value labels
+	for i := 0; i <= 4; i++ {
+		v := maxY * float64(i) / 4
+		svg += fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#eee"/>`+"\n", left, y(v), left+plotW, y(v))
+		svg += fmt.Sprintf(`<text x="%.1f" y="%.1f" text-anchor="end">%.1f</text>`+"\n", left-6, y(v)+4, v)
+	}
+	svg += fmt.Sprintf(`<text x="12" y="%.1f" transform="rotate(-90 12 %.1f)" text-anchor="middle">%s</text>`+"\n", top+plotH/2, top+plotH/2, unit)
+
+	// Elapsed-time labels at the start, middle and end
+	for _, v := range []float64{0, maxX / 2, maxX} {
+		svg += fmt.Sprintf(`<text x="%.1f" y="%.1f" text-anchor="middle">%.0fs</text>`+"\n", x(v), top+plotH+16, v)
+	}
+	svg += fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#999"/>`+"\n", left, top+plotH, left+plotW, top+plotH)
+
+	for i, s := range series {
+		points := make([]string, len(s.values))
+		for j, v := range s.values {
+			points[j] = fmt.Sprintf("%.1f,%.1f", x(elapsed[j]), y(v))
+		}
+		svg += fmt.Sprintf(`<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`+"\n", s.color, strings.Join(points, " "))
+
+		// Legend along the bottom
+		lx := left + float64(i)*80
+		svg += fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="12" height="3" fill="%s"/>`+"\n", lx, height-10, s.color)
+		svg += fmt.Sprintf(`<text x="%.1f" y="%.1f">%s</text>`+"\n", lx+16, height-6, s.name)
+	}
+
+	svg += "</svg>\n"
+	return svg
+}
@@ -3,8 +3,14 @@ module github.com/chiefkemist/speak-perf/step1/mcp
 go 1.24.4
 
 require (
+	github.com/lib/pq v1.10.9
 	github.com/mark3labs/mcp-go v0.33.0
 	github.com/mattn/go-sqlite3 v1.14.17
+	github.com/prometheus/client_golang v1.19.1
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/chiefkemist/speak-perf/step1/mcp/tools"
 )
 
 // LogLevel represents the severity level of a log entry
@@ -22,6 +27,24 @@ const (
 	LogLevelFATAL LogLevel = "FATAL"
 )
 
+// logLevelSeverity orders the known log levels from most to least verbose
+var logLevelSeverity = map[LogLevel]int{
+	LogLevelDEBUG: 0,
+	LogLevelINFO:  1,
+	LogLevelWARN:  2,
+	LogLevelERROR: 3,
+	LogLevelFATAL: 4,
+}
+
+// ParseLogLevel converts a level name such as "debug" or "WARN" to a LogLevel
+func ParseLogLevel(value string) (LogLevel, error) {
+	level := LogLevel(strings.ToUpper(strings.TrimSpace(value)))
+	if _, ok := logLevelSeverity[level]; !ok {
+		return LogLevelINFO, fmt.Errorf("unknown log level %q: must be one of DEBUG, INFO, WARN, ERROR, FATAL", value)
+	}
+	return level, nil
+}
+
 // LogEntry represents a structured log entry
 type LogEntry struct {
 	Level       LogLevel               `json:"level"`
@@ -39,21 +62,71 @@ type LogEntry struct {
 	UserContext map[string]interface{} `json:"user_context,omitempty"`
 }
 
+const (
+	// defaultLogMaxSize is the size at which the current log file is rolled over
+	defaultLogMaxSize int64 = 50 * 1024 * 1024
+	// defaultLogMaxAgeDays is how long rotated log files are kept
+	defaultLogMaxAgeDays = 14
+	logFilePrefix        = "mcp-server-step1-"
+)
+
 var (
 	fileLogger *log.Logger
 	logLevel   LogLevel = LogLevelINFO
 	logMutex   sync.RWMutex
+
+	// Rotation state, guarded by logMutex
+	logDir      string
+	logFile     *os.File
+	logFileSize int64
+	logMaxSize  = defaultLogMaxSize
+	logMaxAge   = defaultLogMaxAgeDays * 24 * time.Hour
+
+	// redactKeys are matched case-insensitively against data keys, ignoring
+	// '-' and '_', so "apikey" also covers "api_key" and "X-Api-Key"
+	redactKeys = []string{"authorization", "token", "password", "secret", "apikey"}
 )
 
+// redactedValue replaces the values of sensitive keys in log entries
+const redactedValue = "[REDACTED]"
+
 // InitializeLogging sets up the logging system
 func InitializeLogging() {
-	// Set log level from environment
-	if level := os.Getenv("MCP_LOG_LEVEL"); level != "" {
-		logLevel = LogLevel(level)
+	config := tools.Settings()
+
+	// Set log level from config, falling back to INFO on typos
+	var levelErr error
+	if value := config.LogLevel; value != "" {
+		logLevel, levelErr = ParseLogLevel(value)
+		if levelErr != nil {
+			log.Printf("Ignoring MCP_LOG_LEVEL: %v", levelErr)
+		}
+	}
+
+	if size := config.LogMaxSize; size != "" {
+		if parsed, err := parseLogSize(size); err == nil {
+			logMaxSize = parsed
+		} else {
+			log.Printf("Ignoring invalid MCP_LOG_MAX_SIZE %q: %v", size, err)
+		}
+	}
+	// MCP_LOG_REDACT_KEYS adds to the default list rather than replacing it
+	for _, key := range strings.Split(config.LogRedactKeys, ",") {
+		if key = normalizeLogKey(key); key != "" {
+			redactKeys = append(redactKeys, key)
+		}
 	}
 
-	// Use environment variable or current directory
-	logDir := os.Getenv("MCP_LOG_DIR")
+	if age := config.LogMaxAge; age != "" {
+		if days, err := strconv.Atoi(age); err == nil && days > 0 {
+			logMaxAge = time.Duration(days) * 24 * time.Hour
+		} else {
+			log.Printf("Ignoring invalid MCP_LOG_MAX_AGE %q: must be a positive number of days", age)
+		}
+	}
+
+	// Use the configured directory or a standard location
+	logDir = config.LogDir
 	if logDir == "" {
 		// Try to use a standard location
 		homeDir, err := os.UserHomeDir()
@@ -69,9 +142,10 @@ func InitializeLogging() {
 		return
 	}
 
+	removeExpiredLogs()
+
 	// Create log file with timestamp
-	logFile := filepath.Join(logDir, fmt.Sprintf("mcp-server-step1-%s.log", time.Now().Format("2006-01-02-15-04-05")))
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	file, err := openLogFile()
 	if err != nil {
 		log.Printf("Failed to open log file: %v", err)
 		return
@@ -79,25 +153,193 @@ func InitializeLogging() {
 
 	fileLogger = log.New(file, "", 0) // No prefix for clean JSON
 	logWithLevel(LogLevelINFO, "MCP Server Step1 logging initialized", nil, map[string]interface{}{
-		"logFile":    logFile,
+		"logFile":    file.Name(),
+		"logMaxSize": logMaxSize,
+		"logMaxAge":  logMaxAge.String(),
 		"logLevel":   logLevel,
 		"version":    "1.0.0",
 		"go_version": runtime.Version(),
 		"os":         runtime.GOOS,
 		"arch":       runtime.GOARCH,
 	})
+	if levelErr != nil {
+		logWithLevel(LogLevelWARN, "Invalid MCP_LOG_LEVEL, using INFO", levelErr, nil)
+	}
+}
+
+// openLogFile creates a new timestamped log file and makes it current.
+// Callers other than InitializeLogging must hold logMutex.
+func openLogFile() (*os.File, error) {
+	name := filepath.Join(logDir, fmt.Sprintf("%s%s.log", logFilePrefix, time.Now().Format("2006-01-02-15-04-05")))
+	// Rotating twice within a second would otherwise reopen the full file
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+		name = filepath.Join(logDir, fmt.Sprintf("%s%s-%d.log", logFilePrefix, time.Now().Format("2006-01-02-15-04-05"), i))
+	}
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	logFile = file
+	logFileSize = 0
+	return file, nil
+}
+
+// rotateLogFile switches logging to a fresh file and prunes expired ones.
+// Callers must hold logMutex.
+func rotateLogFile() {
+	previous := logFile
+	file, err := openLogFile()
+	if err != nil {
+		// Keep writing to the oversized file rather than dropping entries
+		log.Printf("Failed to rotate log file: %v", err)
+		return
+	}
+	fileLogger.SetOutput(file)
+	if previous != nil {
+		previous.Close()
+	}
+	removeExpiredLogs()
+}
+
+// removeExpiredLogs deletes log files older than logMaxAge
+func removeExpiredLogs() {
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-logMaxAge)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, logFilePrefix) || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		if logFile != nil && filepath.Join(logDir, name) == logFile.Name() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(logDir, name))
+	}
+}
+
+// parseLogSize parses a size such as "50MB", "512KB" or "1GB"; a bare
+// number is taken as megabytes
+func parseLogSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1024 * 1024)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1024 * 1024 * 1024},
+		{"MB", 1024 * 1024},
+		{"KB", 1024},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(size, unit.suffix) {
+			size = strings.TrimSpace(strings.TrimSuffix(size, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("must be a positive size such as 50MB")
+	}
+	return n * multiplier, nil
 }
 
 // shouldLog checks if a log level should be logged based on current log level
 func shouldLog(level LogLevel) bool {
-	levels := map[LogLevel]int{
-		LogLevelDEBUG: 0,
-		LogLevelINFO:  1,
-		LogLevelWARN:  2,
-		LogLevelERROR: 3,
-		LogLevelFATAL: 4,
-	}
-	return levels[level] >= levels[logLevel]
+	return logLevelSeverity[level] >= logLevelSeverity[logLevel]
+}
+
+// normalizeLogKey lowercases a key and drops '-', '_' and spaces for
+// redaction matching
+func normalizeLogKey(key string) string {
+	return strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(key))
+}
+
+// isSensitiveLogKey reports whether a data key contains one of redactKeys
+func isSensitiveLogKey(key string) bool {
+	key = normalizeLogKey(key)
+	for _, pattern := range redactKeys {
+		if strings.Contains(key, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactLogData returns a copy of data with the values of sensitive keys
+// masked, descending into nested maps and slices. The caller's map is left
+// untouched.
+func redactLogData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if isSensitiveLogKey(key) {
+			redacted[key] = redactedValue
+			continue
+		}
+		redacted[key] = redactLogValue(value)
+	}
+	return redacted
+}
+
+func redactLogValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactLogData(v)
+	case map[string]string:
+		redacted := make(map[string]string, len(v))
+		for key, s := range v {
+			if isSensitiveLogKey(key) {
+				s = redactedValue
+			}
+			redacted[key] = s
+		}
+		return redacted
+	case http.Header:
+		return http.Header(redactLogStringSlices(v))
+	case map[string][]string:
+		return redactLogStringSlices(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactLogValue(item)
+		}
+		return redacted
+	case []map[string]interface{}:
+		redacted := make([]map[string]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactLogData(item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+func redactLogStringSlices(values map[string][]string) map[string][]string {
+	redacted := make(map[string][]string, len(values))
+	for key, v := range values {
+		if isSensitiveLogKey(key) {
+			v = []string{redactedValue}
+		}
+		redacted[key] = v
+	}
+	return redacted
 }
 
 // logWithLevel is the core logging function that handles all log entries
@@ -114,7 +356,7 @@ func logWithLevel(level LogLevel, message string, err error, data map[string]int
 			Level:     level,
 			Timestamp: time.Now().Format(time.RFC3339Nano),
 			Message:   message,
-			Data:      data,
+			Data:      redactLogData(data),
 		}
 
 		if err != nil {
@@ -128,6 +370,10 @@ func logWithLevel(level LogLevel, message string, err error, data map[string]int
 
 		jsonData, _ := json.Marshal(entry)
 		fileLogger.Println(string(jsonData))
+		logFileSize += int64(len(jsonData)) + 1
+		if logFileSize >= logMaxSize {
+			rotateLogFile()
+		}
 
 		// Also log to stderr for errors and fatal
 		if level == LogLevelERROR || level == LogLevelFATAL {
@@ -186,6 +432,7 @@ func LogToolEnd(tool string, requestID string, duration time.Duration, success b
 	}
 
 	logWithLevel(level, "Tool execution completed", nil, logData)
+	observeToolCall(tool, duration, success)
 }
 
 func LogDatabaseOperation(operation string, duration time.Duration, err error, data map[string]interface{}) {
@@ -225,6 +472,7 @@ func LogContainerOperation(operation string, projectName string, duration time.D
 	}
 
 	logWithLevel(level, "Container operation", err, logData)
+	observeContainerOperation(operation, duration, err)
 }
 
 func LogTestExecution(testType string, testID int64, duration time.Duration, metrics map[string]interface{}) {
@@ -235,6 +483,7 @@ func LogTestExecution(testType string, testID int64, duration time.Duration, met
 		"metrics":   metrics,
 		"component": "test_runner",
 	})
+	observeTestExecution(testType, duration)
 }
 
 func LogPerformanceMetrics(operation string, duration time.Duration, data map[string]interface{}) {
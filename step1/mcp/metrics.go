@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Server metrics are recorded from the logging hooks (LogToolEnd,
+// LogContainerOperation, LogTestExecution) and served on /metrics when
+// MCP_METRICS_ADDR is set. They describe this server, not the k6 results.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	toolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_tool_calls_total",
+		Help: "Tool calls by tool and whether they succeeded.",
+	}, []string{"tool", "success"})
+
+	toolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "mcp_tool_duration_seconds",
+		Help: "How long tool calls took.",
+		// From quick lookups to long soak tests
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"tool"})
+
+	containerOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcp_container_operation_duration_seconds",
+		Help:    "How long docker compose operations such as pull, start and stop took.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+	}, []string{"operation", "success"})
+
+	testExecutionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcp_k6_run_duration_seconds",
+		Help:    "How long completed k6 runs took.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"test_type"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		toolCalls,
+		toolDuration,
+		containerOperationDuration,
+		testExecutionDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// startMetricsServer serves /metrics on addr, returning nil when addr is
+// empty. The server runs until it is shut down.
+func startMetricsServer(addr string) *http.Server {
+	if addr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			LogError("Metrics server stopped", err, map[string]interface{}{"addr": addr})
+		}
+	}()
+	LogInfo("Serving metrics", map[string]interface{}{"addr": addr, "path": "/metrics"})
+	return srv
+}
+
+// stopMetricsServer shuts the metrics server down, if it was started
+func stopMetricsServer(srv *http.Server) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		LogError("Failed to stop metrics server", err, nil)
+	}
+}
+
+func observeToolCall(tool string, duration time.Duration, success bool) {
+	toolCalls.WithLabelValues(tool, strconv.FormatBool(success)).Inc()
+	toolDuration.WithLabelValues(tool).Observe(duration.Seconds())
+}
+
+func observeContainerOperation(operation string, duration time.Duration, err error) {
+	containerOperationDuration.WithLabelValues(operation, strconv.FormatBool(err == nil)).Observe(duration.Seconds())
+}
+
+func observeTestExecution(testType string, duration time.Duration) {
+	testExecutionDuration.WithLabelValues(testType).Observe(duration.Seconds())
+}
@@ -2,7 +2,9 @@ package tools
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"strings"
 
 	mcpgolang "github.com/mark3labs/mcp-go/mcp"
 )
@@ -17,6 +19,129 @@ func NewAnalyzeResultsTool(deps *SharedDependencies) *AnalyzeResultsTool {
 	return &AnalyzeResultsTool{deps: deps}
 }
 
+// Verdicts of an analysis: every endpoint with an SLA met it, one didn't,
+// or no endpoint had an SLA to check
+const (
+	VerdictPass  = "PASS"
+	VerdictFail  = "FAIL"
+	VerdictNoSLA = "NO SLA CONFIGURED"
+)
+
+// endpointAnalysis is one endpoint's metrics for a run and the SLA declared
+// for it, if any
+type endpointAnalysis struct {
+	Endpoint  string
+	AvgTime   float64
+	P95Time   sql.NullFloat64
+	ErrorRate float64
+	SLATime   sql.NullInt64
+	SLAError  sql.NullFloat64
+	// Requests and the data transfer are unset for runs stored before they
+	// were recorded, and the transfer when k6 didn't attribute it to the endpoint
+	Requests     sql.NullInt64
+	DataSent     sql.NullInt64
+	DataReceived sql.NullInt64
+}
+
+// AvgResponseBytes returns the data received per request, if known
+func (e endpointAnalysis) AvgResponseBytes() (float64, bool) {
+	if !e.DataReceived.Valid || !e.Requests.Valid || e.Requests.Int64 == 0 {
+		return 0, false
+	}
+	return float64(e.DataReceived.Int64) / float64(e.Requests.Int64), true
+}
+
+// ResponseTime is the time checked against the SLA: p95, or the average for
+// metrics recorded before p95 was
+func (e endpointAnalysis) ResponseTime() (float64, string) {
+	if e.P95Time.Valid {
+		return e.P95Time.Float64, "p95"
+	}
+	return e.AvgTime, "avg"
+}
+
+// HasSLA reports whether the endpoint has an SLA to check
+func (e endpointAnalysis) HasSLA() bool {
+	return e.SLATime.Valid || e.SLAError.Valid
+}
+
+// ResponseTimeViolated reports whether the response time SLA was exceeded
+func (e endpointAnalysis) ResponseTimeViolated() bool {
+	responseTime, _ := e.ResponseTime()
+	return e.SLATime.Valid && responseTime > float64(e.SLATime.Int64)
+}
+
+// ErrorRateViolated reports whether the error rate SLA was exceeded
+func (e endpointAnalysis) ErrorRateViolated() bool {
+	return e.SLAError.Valid && e.ErrorRate > e.SLAError.Float64
+}
+
+// AnalysisVerdict is the machine-readable outcome of analyze_results, for
+// automation such as PR comments to key off
+type AnalysisVerdict struct {
+	RunID   string `json:"run_id"`
+	Verdict string `json:"verdict"`
+	// Summary is the one-line verdict, e.g. "FAIL — 2 endpoints exceeded response time SLA"
+	Summary                string   `json:"summary"`
+	Endpoints              int      `json:"endpoints"`
+	EndpointsWithSLA       int      `json:"endpoints_with_sla"`
+	ResponseTimeViolations []string `json:"response_time_violations"`
+	ErrorRateViolations    []string `json:"error_rate_violations"`
+}
+
+// verdict checks each endpoint against its SLA. Endpoints without one don't
+// affect the verdict, and a run where none has one gets VerdictNoSLA rather
+// than passing by default.
+func (t *AnalyzeResultsTool) verdict(runId string, endpoints []endpointAnalysis) AnalysisVerdict {
+	v := AnalysisVerdict{
+		RunID:                  runId,
+		Endpoints:              len(endpoints),
+		ResponseTimeViolations: []string{},
+		ErrorRateViolations:    []string{},
+	}
+	for _, e := range endpoints {
+		if !e.HasSLA() {
+			continue
+		}
+		v.EndpointsWithSLA++
+		if e.ResponseTimeViolated() {
+			v.ResponseTimeViolations = append(v.ResponseTimeViolations, e.Endpoint)
+		}
+		if e.ErrorRateViolated() {
+			v.ErrorRateViolations = append(v.ErrorRateViolations, e.Endpoint)
+		}
+	}
+
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 endpoint"
+		}
+		return fmt.Sprintf("%d endpoints", n)
+	}
+	switch {
+	case v.EndpointsWithSLA == 0:
+		v.Verdict = VerdictNoSLA
+		v.Summary = fmt.Sprintf("%s — none of %s has an SLA", VerdictNoSLA, plural(len(endpoints)))
+	case len(v.ResponseTimeViolations) > 0 || len(v.ErrorRateViolations) > 0:
+		v.Verdict = VerdictFail
+		failures := []string{}
+		if n := len(v.ResponseTimeViolations); n > 0 {
+			failures = append(failures, plural(n)+" exceeded response time SLA")
+		}
+		if n := len(v.ErrorRateViolations); n > 0 {
+			failures = append(failures, plural(n)+" exceeded error rate SLA")
+		}
+		v.Summary = fmt.Sprintf("%s — %s", VerdictFail, strings.Join(failures, ", "))
+	default:
+		v.Verdict = VerdictPass
+		v.Summary = fmt.Sprintf("%s — all %s within SLA", VerdictPass, plural(v.EndpointsWithSLA))
+		if v.EndpointsWithSLA < len(endpoints) {
+			v.Summary += fmt.Sprintf(" (%d without one)", len(endpoints)-v.EndpointsWithSLA)
+		}
+	}
+	return v
+}
+
 // Handle processes the analyze_results request
 func (t *AnalyzeResultsTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
 	runId, err := request.RequireString("runId")
@@ -28,41 +153,68 @@ func (t *AnalyzeResultsTool) Handle(ctx context.Context, request mcpgolang.CallT
 
 	// Get metrics for this run
 	rows, err := t.deps.DB.Query(`
-		SELECT endpoint, avg_response_time, error_rate 
+		SELECT endpoint, avg_response_time, p95_response_time, error_rate, requests, data_sent, data_received
 		FROM metrics 
-		WHERE run_id = ?`, runId)
+		WHERE run_id = ?
+		ORDER BY endpoint`, runId)
 	if err != nil {
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to query metrics: %v", err)), nil
 	}
-	defer rows.Close()
+	endpoints := []endpointAnalysis{}
+	for rows.Next() {
+		var e endpointAnalysis
+		if err := rows.Scan(&e.Endpoint, &e.AvgTime, &e.P95Time, &e.ErrorRate, &e.Requests, &e.DataSent, &e.DataReceived); err != nil {
+			rows.Close()
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to read metrics: %v", err)), nil
+		}
+		endpoints = append(endpoints, e)
+	}
+	rows.Close()
 
-	analysis := "# Performance Analysis\n\n"
-	analysis += fmt.Sprintf("## Run ID: %s\n\n", runId)
+	// Check against SLAs declared in discovered specs, preferring the run's
+	// own session; an unset SLA is skipped rather than read as 0
+	for i := range endpoints {
+		t.deps.DB.QueryRow(`
+			SELECT e.sla_response_time, e.sla_error_rate
+			FROM endpoints e
+			JOIN api_specs a ON e.spec_id = a.id
+			WHERE e.path = ? AND (e.sla_response_time IS NOT NULL OR e.sla_error_rate IS NOT NULL)
+			ORDER BY a.session_id = (
+				SELECT t.session_id FROM test_runs r JOIN tests t ON r.test_id = t.id WHERE r.id = ?
+			) DESC, e.id DESC
+			LIMIT 1`, endpoints[i].Endpoint, runId).Scan(&endpoints[i].SLATime, &endpoints[i].SLAError)
+	}
+	verdict := t.verdict(runId, endpoints)
 
-	for rows.Next() {
-		var endpoint string
-		var avgTime, errorRate float64
-		rows.Scan(&endpoint, &avgTime, &errorRate)
-
-		analysis += fmt.Sprintf("### %s\n", endpoint)
-		analysis += fmt.Sprintf("- Avg Response Time: %.2f ms\n", avgTime)
-		analysis += fmt.Sprintf("- Error Rate: %.2f%%\n", errorRate*100)
-
-		// Check against SLAs
-		var slaTime int
-		var slaError float64
-		err := t.deps.DB.QueryRow(`
-			SELECT sla_response_time, sla_error_rate 
-			FROM endpoints 
-			WHERE path = ?`, endpoint).Scan(&slaTime, &slaError)
+	report := ToolReport{
+		Title:   "Performance Analysis",
+		Status:  verdict.Verdict,
+		Summary: verdict.Summary,
+		Data:    verdict,
+	}
+	report.AddMetric("endpoints", float64(verdict.Endpoints))
+	report.AddMetric("endpoints_with_sla", float64(verdict.EndpointsWithSLA))
+	report.AddMetric("response_time_violations", float64(len(verdict.ResponseTimeViolations)))
+	report.AddMetric("error_rate_violations", float64(len(verdict.ErrorRateViolations)))
+	report.AddSection(fmt.Sprintf("Run ID: %s", runId), t.overallResults(runId)+summaryTable(endpoints))
 
-		if err == nil {
-			if avgTime > float64(slaTime) {
-				analysis += fmt.Sprintf("- ⚠️ SLA VIOLATION: Response time exceeds %d ms\n", slaTime)
-			}
-			if errorRate > slaError {
-				analysis += fmt.Sprintf("- ⚠️ SLA VIOLATION: Error rate exceeds %.1f%%\n", slaError*100)
-			}
+	for _, e := range endpoints {
+		analysis := fmt.Sprintf("- Avg Response Time: %.2f ms\n", e.AvgTime)
+		if e.P95Time.Valid {
+			analysis += fmt.Sprintf("- p95 Response Time: %.2f ms\n", e.P95Time.Float64)
+		}
+		analysis += fmt.Sprintf("- Error Rate: %.2f%%\n", e.ErrorRate*100)
+		if avgResponse, ok := e.AvgResponseBytes(); ok {
+			analysis += fmt.Sprintf("- Data: %s sent, %s received (%s per response)\n",
+				FormatBytes(float64(e.DataSent.Int64)), FormatBytes(float64(e.DataReceived.Int64)), FormatBytes(avgResponse))
+		}
+
+		if e.ResponseTimeViolated() {
+			_, stat := e.ResponseTime()
+			analysis += fmt.Sprintf("- ⚠️ SLA VIOLATION: %s response time exceeds %d ms\n", stat, e.SLATime.Int64)
+		}
+		if e.ErrorRateViolated() {
+			analysis += fmt.Sprintf("- ⚠️ SLA VIOLATION: Error rate exceeds %.1f%%\n", e.SLAError.Float64*100)
 		}
 
 		if compareHistory {
@@ -71,17 +223,98 @@ func (t *AnalyzeResultsTool) Handle(ctx context.Context, request mcpgolang.CallT
 			err := t.deps.DB.QueryRow(`
 				SELECT AVG(avg_response_time), AVG(error_rate) 
 				FROM metrics 
-				WHERE endpoint = ? AND run_id != ?`, endpoint, runId).Scan(&histAvgTime, &histErrorRate)
+				WHERE endpoint = ? AND run_id != ?`, e.Endpoint, runId).Scan(&histAvgTime, &histErrorRate)
 
 			if err == nil {
-				timeDiff := ((avgTime - histAvgTime) / histAvgTime) * 100
+				timeDiff := ((e.AvgTime - histAvgTime) / histAvgTime) * 100
 				analysis += fmt.Sprintf("- Response time: %.1f%% vs historical average\n", timeDiff)
 			}
+
+			// Growing responses slow an endpoint down before its code does
+			if avgResponse, ok := e.AvgResponseBytes(); ok {
+				var histResponse sql.NullFloat64
+				t.deps.DB.QueryRow(`
+					SELECT AVG(CAST(data_received AS REAL) / requests)
+					FROM metrics
+					WHERE endpoint = ? AND run_id != ? AND data_received IS NOT NULL AND requests > 0`, e.Endpoint, runId).Scan(&histResponse)
+				if histResponse.Valid && histResponse.Float64 > 0 {
+					sizeDiff := ((avgResponse - histResponse.Float64) / histResponse.Float64) * 100
+					analysis += fmt.Sprintf("- Response size: %.1f%% vs historical average\n", sizeDiff)
+				}
+			}
 		}
 
-		analysis += "\n"
+		report.AddSection(e.Endpoint, analysis)
 	}
 
-	return mcpgolang.NewToolResultText(analysis), nil
+	return report.Result(), nil
 }
 
+// summaryTable renders one row per endpoint with its SLA status
+func summaryTable(endpoints []endpointAnalysis) string {
+	if len(endpoints) == 0 {
+		return ""
+	}
+	table := "### Summary\n\n| Endpoint | Avg (ms) | p95 (ms) | Error Rate | SLA | Status |\n|---|---|---|---|---|---|\n"
+	for _, e := range endpoints {
+		p95 := "-"
+		if e.P95Time.Valid {
+			p95 = fmt.Sprintf("%.2f", e.P95Time.Float64)
+		}
+		sla := []string{}
+		if e.SLATime.Valid {
+			sla = append(sla, fmt.Sprintf("%d ms", e.SLATime.Int64))
+		}
+		if e.SLAError.Valid {
+			sla = append(sla, fmt.Sprintf("%.1f%% errors", e.SLAError.Float64*100))
+		}
+		status := "-"
+		switch {
+		case e.ResponseTimeViolated() || e.ErrorRateViolated():
+			status = VerdictFail
+		case e.HasSLA():
+			status = VerdictPass
+		}
+		slaText := "-"
+		if len(sla) > 0 {
+			slaText = strings.Join(sla, ", ")
+		}
+		table += fmt.Sprintf("| %s | %.2f | %s | %.2f%% | %s | %s |\n", e.Endpoint, e.AvgTime, p95, e.ErrorRate*100, slaText, status)
+	}
+	return table + "\n"
+}
+
+// overallResults reports run-wide request metrics, preferring the k6 summary
+// export stored with the run and falling back to the NDJSON output stream
+func (t *AnalyzeResultsTool) overallResults(runId string) string {
+	var summaryExport, resultsFile sql.NullString
+	t.deps.DB.QueryRow("SELECT summary, results_file FROM test_runs WHERE id = ?", runId).Scan(&summaryExport, &resultsFile)
+
+	if summaryExport.Valid {
+		summary, err := ParseK6Summary([]byte(summaryExport.String))
+		if err == nil {
+			return "### Overall (k6 summary)\n" + summary.Markdown() + "\n"
+		}
+		t.deps.Logger.LogError("Failed to parse stored k6 summary", err, map[string]interface{}{"run_id": runId})
+	}
+
+	if !resultsFile.Valid {
+		return ""
+	}
+	groups, err := ParseK6Results(resultsFile.String, "")
+	if err != nil {
+		return ""
+	}
+	all, ok := groups["all"]
+	if !ok || all.Requests() == 0 {
+		return ""
+	}
+
+	result := "### Overall (k6 output stream)\n"
+	result += fmt.Sprintf("- Requests: %d (%.2f/s)\n", all.Requests(), all.RPS())
+	result += fmt.Sprintf("- Response Time: avg %.2f ms, min %.2f ms, max %.2f ms\n", all.Avg(), all.Min(), all.Max())
+	result += fmt.Sprintf("- Percentiles: p90 %.2f ms, p95 %.2f ms, p99 %.2f ms\n",
+		all.Percentile(90), all.Percentile(95), all.Percentile(99))
+	result += fmt.Sprintf("- Error Rate: %.2f%%\n\n", all.ErrorRate()*100)
+	return result
+}
@@ -0,0 +1,130 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// DefaultTempDirMaxAge is how old a run's temp directory must be before
+// cleanup removes it; runs in progress keep theirs well within this
+const DefaultTempDirMaxAge = 24 * time.Hour
+
+// CleanupTool handles the cleanup tool
+type CleanupTool struct {
+	deps *SharedDependencies
+}
+
+// NewCleanupTool creates a new instance of CleanupTool
+func NewCleanupTool(deps *SharedDependencies) *CleanupTool {
+	return &CleanupTool{deps: deps}
+}
+
+// Handle processes the cleanup request
+func (t *CleanupTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	dryRun := request.GetString("dryRun", "false") == "true"
+	maxAge := DefaultTempDirMaxAge
+	if olderThan := request.GetString("olderThan", ""); olderThan != "" {
+		parsed, err := time.ParseDuration(olderThan)
+		if err != nil || parsed < 0 {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid olderThan %q: must be a duration such as 1h or 30m", olderThan)), nil
+		}
+		maxAge = parsed
+	}
+
+	report := "# Cleanup\n\n"
+	if dryRun {
+		report += "Dry run: nothing was removed.\n\n"
+	}
+
+	// Compose projects, including those kept with keepContainers
+	removedProjects := 0
+	report += "## Compose Projects\n"
+	projects, err := OrphanedProjects(ctx)
+	if err != nil {
+		report += fmt.Sprintf("- Failed to list projects: %v\n", err)
+	} else if len(projects) == 0 {
+		report += "- None found\n"
+	}
+	for _, name := range projects {
+		if dryRun {
+			report += fmt.Sprintf("- Would remove %s\n", name)
+			continue
+		}
+		if err := RemoveProject(name); err != nil {
+			t.deps.Logger.LogError("Failed to remove compose project", err, map[string]interface{}{
+				"project_name": name,
+			})
+			report += fmt.Sprintf("- %v\n", err)
+			continue
+		}
+		removedProjects++
+		t.deps.DB.Exec("UPDATE test_sessions SET status = ?, completed_at = COALESCE(completed_at, CURRENT_TIMESTAMP) WHERE project_name = ? AND status = ?",
+			"completed", name, SessionStatusLeftRunning)
+		report += fmt.Sprintf("- Removed %s\n", name)
+	}
+
+	// Temp directories left by crashed runs
+	removedDirs := 0
+	report += fmt.Sprintf("\n## Temp Directories (older than %s)\n", maxAge)
+	dirs, err := staleTempDirs(maxAge)
+	if err != nil {
+		report += fmt.Sprintf("- Failed to list temp directories: %v\n", err)
+	} else if len(dirs) == 0 {
+		report += "- None found\n"
+	}
+	for _, dir := range dirs {
+		if dryRun {
+			report += fmt.Sprintf("- Would remove %s\n", dir)
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			report += fmt.Sprintf("- Failed to remove %s: %v\n", dir, err)
+			continue
+		}
+		removedDirs++
+		report += fmt.Sprintf("- Removed %s\n", dir)
+	}
+
+	if dryRun {
+		report += fmt.Sprintf("\nWould remove %d projects and %d directories.\n", len(projects), len(dirs))
+	} else {
+		report += fmt.Sprintf("\nRemoved %d projects and %d directories.\n", removedProjects, removedDirs)
+	}
+
+	t.deps.Logger.LogInfo("Cleanup completed", map[string]interface{}{
+		"dry_run":          dryRun,
+		"removed_projects": removedProjects,
+		"removed_dirs":     removedDirs,
+	})
+
+	return mcpgolang.NewToolResultText(report), nil
+}
+
+// staleTempDirs returns the run directories under os.TempDir() last modified
+// more than maxAge ago
+func staleTempDirs(maxAge time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(os.TempDir())
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	dirs := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), TempDirPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		dirs = append(dirs, filepath.Join(os.TempDir(), entry.Name()))
+	}
+	return dirs, nil
+}
@@ -0,0 +1,312 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// DefaultRegressionThresholdPct is the percent change beyond which a metric
+// counts as improved or regressed
+const DefaultRegressionThresholdPct = 10.0
+
+// CompareRunsTool handles the compare_runs tool
+type CompareRunsTool struct {
+	deps *SharedDependencies
+}
+
+// NewCompareRunsTool creates a new instance of CompareRunsTool
+func NewCompareRunsTool(deps *SharedDependencies) *CompareRunsTool {
+	return &CompareRunsTool{deps: deps}
+}
+
+// runMetrics holds the stored metrics for one endpoint of a run
+type runMetrics struct {
+	Avg       float64
+	P95       float64
+	ErrorRate float64
+	RPS       float64
+}
+
+// metricComparison describes how one metric is compared between runs
+type metricComparison struct {
+	Name           string
+	Unit           string
+	HigherIsBetter bool
+	Value          func(m runMetrics) float64
+}
+
+var comparedMetrics = []metricComparison{
+	{Name: "Avg", Unit: "ms", Value: func(m runMetrics) float64 { return m.Avg }},
+	{Name: "p95", Unit: "ms", Value: func(m runMetrics) float64 { return m.P95 }},
+	{Name: "Error rate", Unit: "%", Value: func(m runMetrics) float64 { return m.ErrorRate * 100 }},
+	{Name: "RPS", HigherIsBetter: true, Value: func(m runMetrics) float64 { return m.RPS }},
+}
+
+// RunComparison is the machine-readable result of compare_runs
+type RunComparison struct {
+	BaselineRunID  string               `json:"baseline_run_id"`
+	CandidateRunID string               `json:"candidate_run_id"`
+	ThresholdPct   float64              `json:"threshold_pct"`
+	Endpoints      []EndpointComparison `json:"endpoints"`
+}
+
+// EndpointComparison is one endpoint's verdict: improved, regressed,
+// neutral, new or missing
+type EndpointComparison struct {
+	Endpoint string         `json:"endpoint"`
+	Verdict  string         `json:"verdict"`
+	Metrics  []MetricChange `json:"metrics,omitempty"`
+}
+
+// MetricChange is one metric of an endpoint in both runs; ChangePct is nil
+// when the baseline is zero
+type MetricChange struct {
+	Metric    string   `json:"metric"`
+	Unit      string   `json:"unit,omitempty"`
+	Baseline  float64  `json:"baseline"`
+	Candidate float64  `json:"candidate"`
+	ChangePct *float64 `json:"change_pct,omitempty"`
+}
+
+// Handle processes the compare_runs request
+func (t *CompareRunsTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	// Each side is a run ID, or the latest completed run with the given tags
+	tags, err := ParseRunTags(request.GetString("tags", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid tags: %v", err)), nil
+	}
+	baselineRunId, err := t.resolveRun(request, "baseline", tags)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	candidateRunId, err := t.resolveRun(request, "candidate", tags)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	thresholdPct := request.GetFloat("thresholdPct", DefaultRegressionThresholdPct)
+	if thresholdPct < 0 {
+		return mcpgolang.NewToolResultError("thresholdPct must not be negative"), nil
+	}
+
+	baseline, err := t.loadRunMetrics(baselineRunId)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to load baseline run: %v", err)), nil
+	}
+	candidate, err := t.loadRunMetrics(candidateRunId)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to load candidate run: %v", err)), nil
+	}
+
+	endpointSet := make(map[string]bool)
+	for endpoint := range baseline {
+		endpointSet[endpoint] = true
+	}
+	for endpoint := range candidate {
+		endpointSet[endpoint] = true
+	}
+	if len(endpointSet) == 0 {
+		return mcpgolang.NewToolResultError("Neither run has any stored metrics"), nil
+	}
+	endpoints := make([]string, 0, len(endpointSet))
+	for endpoint := range endpointSet {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	comparison := RunComparison{
+		BaselineRunID:  baselineRunId,
+		CandidateRunID: candidateRunId,
+		ThresholdPct:   thresholdPct,
+	}
+	report := ToolReport{Title: "Run Comparison", Data: &comparison}
+	runs := fmt.Sprintf("- Baseline run: %s%s\n", baselineRunId, t.runTagsLabel(baselineRunId))
+	runs += fmt.Sprintf("- Candidate run: %s%s\n", candidateRunId, t.runTagsLabel(candidateRunId))
+	runs += fmt.Sprintf("- Threshold: ±%.1f%%\n", thresholdPct)
+	report.AddSection("", runs)
+
+	verdicts := make(map[string]int)
+	for _, endpoint := range endpoints {
+		base, inBaseline := baseline[endpoint]
+		cand, inCandidate := candidate[endpoint]
+
+		if !inBaseline {
+			report.AddSection(endpoint, "Only present in the candidate run.")
+			comparison.Endpoints = append(comparison.Endpoints, EndpointComparison{Endpoint: endpoint, Verdict: "new"})
+			verdicts["new"]++
+			continue
+		}
+		if !inCandidate {
+			report.AddSection(endpoint, "Only present in the baseline run.")
+			comparison.Endpoints = append(comparison.Endpoints, EndpointComparison{Endpoint: endpoint, Verdict: "missing"})
+			verdicts["missing"]++
+			continue
+		}
+
+		table := "| Metric | Baseline | Candidate | Delta | Change |\n"
+		table += "|--------|----------|-----------|-------|--------|\n"
+
+		entry := EndpointComparison{Endpoint: endpoint}
+		improved, regressed := false, false
+		for _, metric := range comparedMetrics {
+			b, c := metric.Value(base), metric.Value(cand)
+			pct, ok := percentChange(b, c)
+
+			change := "n/a"
+			metricChange := MetricChange{Metric: metric.Name, Unit: metric.Unit, Baseline: b, Candidate: c}
+			if ok {
+				change = fmt.Sprintf("%+.1f%%", pct)
+				metricChange.ChangePct = &pct
+			}
+			entry.Metrics = append(entry.Metrics, metricChange)
+			table += fmt.Sprintf("| %s | %.2f%s | %.2f%s | %+.2f%s | %s |\n",
+				metric.Name, b, metric.Unit, c, metric.Unit, c-b, metric.Unit, change)
+
+			// A change from zero has no percentage but is always significant
+			if c == b || (ok && math.Abs(pct) <= thresholdPct) {
+				continue
+			}
+			if (c > b) == metric.HigherIsBetter {
+				improved = true
+			} else {
+				regressed = true
+			}
+		}
+
+		entry.Verdict = "neutral"
+		switch {
+		case regressed:
+			entry.Verdict = "regressed"
+		case improved:
+			entry.Verdict = "improved"
+		}
+		verdicts[entry.Verdict]++
+		comparison.Endpoints = append(comparison.Endpoints, entry)
+		report.AddSection(endpoint, table+fmt.Sprintf("\n**Verdict: %s**", entry.Verdict))
+	}
+
+	// The run as a whole regressed if any endpoint did
+	report.Status = "neutral"
+	switch {
+	case verdicts["regressed"] > 0:
+		report.Status = "regressed"
+	case verdicts["improved"] > 0:
+		report.Status = "improved"
+	}
+
+	summary := ""
+	counts := make([]string, 0, len(verdicts))
+	for _, verdict := range []string{"improved", "regressed", "neutral", "new", "missing"} {
+		if verdicts[verdict] > 0 {
+			summary += fmt.Sprintf("- %s: %d\n", verdict, verdicts[verdict])
+			counts = append(counts, fmt.Sprintf("%d %s", verdicts[verdict], verdict))
+			report.AddMetric(verdict, float64(verdicts[verdict]))
+		}
+	}
+	report.Summary = fmt.Sprintf("%d endpoints compared: %s", len(endpoints), strings.Join(counts, ", "))
+	report.AddSection("Summary", summary)
+
+	return report.Result(), nil
+}
+
+// resolveRun returns the run to compare on one side, baseline or candidate:
+// the <side>RunId parameter, or else the latest completed run carrying the
+// <side>Tags parameter's tags plus the shared tags
+func (t *CompareRunsTool) resolveRun(request mcpgolang.CallToolRequest, side string, shared RunTags) (string, error) {
+	runId := request.GetString(side+"RunId", "")
+	sideTags, err := ParseRunTags(request.GetString(side+"Tags", ""))
+	if err != nil {
+		return "", fmt.Errorf("Invalid %sTags: %v", side, err)
+	}
+	if runId != "" {
+		if len(sideTags) > 0 {
+			return "", fmt.Errorf("Give %sRunId or %sTags, not both", side, side)
+		}
+		return runId, nil
+	}
+	if len(sideTags) == 0 {
+		return "", fmt.Errorf("Missing required %sRunId or %sTags", side, side)
+	}
+
+	tags := RunTags{}
+	for key, value := range shared {
+		tags[key] = value
+	}
+	for key, value := range sideTags {
+		tags[key] = value
+	}
+	filter, args := tags.Filter("tr.id")
+	var id int64
+	err = t.deps.DB.QueryRow(`
+		SELECT tr.id FROM test_runs tr
+		WHERE tr.completed_at IS NOT NULL`+filter+`
+		ORDER BY tr.started_at DESC, tr.id DESC
+		LIMIT 1`, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("No completed run has the %s tags %s", side, tags)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to find the %s run: %v", side, err)
+	}
+	return fmt.Sprintf("%d", id), nil
+}
+
+// runTagsLabel renders a run's tags for the report, empty if it has none
+func (t *CompareRunsTool) runTagsLabel(runId string) string {
+	var id int64
+	fmt.Sscanf(runId, "%d", &id)
+	tags, err := LoadRunTags(t.deps.DB, id)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", tags)
+}
+
+// loadRunMetrics returns the stored metrics of a run keyed by endpoint
+func (t *CompareRunsTool) loadRunMetrics(runId string) (map[string]runMetrics, error) {
+	var exists int
+	if err := t.deps.DB.QueryRow("SELECT 1 FROM test_runs WHERE id = ?", runId).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("run %s not found: %w", runId, err)
+	}
+
+	rows, err := t.deps.DB.Query(`
+		SELECT endpoint, avg_response_time, p95_response_time, error_rate, requests_per_second
+		FROM metrics
+		WHERE run_id = ?`, runId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := make(map[string]runMetrics)
+	for rows.Next() {
+		var endpoint string
+		var avg, p95, errorRate, rps sql.NullFloat64
+		if err := rows.Scan(&endpoint, &avg, &p95, &errorRate, &rps); err != nil {
+			return nil, err
+		}
+		metrics[endpoint] = runMetrics{
+			Avg:       avg.Float64,
+			P95:       p95.Float64,
+			ErrorRate: errorRate.Float64,
+			RPS:       rps.Float64,
+		}
+	}
+
+	return metrics, rows.Err()
+}
+
+// percentChange returns the relative change from baseline to candidate in
+// percent; ok is false when the baseline is zero
+func percentChange(baseline, candidate float64) (pct float64, ok bool) {
+	if baseline == 0 {
+		return 0, candidate == 0
+	}
+	return (candidate - baseline) / baseline * 100, true
+}
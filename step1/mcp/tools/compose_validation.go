@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeTopLevelKeys are the top-level keys defined by the Compose spec
+var composeTopLevelKeys = map[string]bool{
+	"version":  true,
+	"name":     true,
+	"include":  true,
+	"services": true,
+	"networks": true,
+	"volumes":  true,
+	"configs":  true,
+	"secrets":  true,
+}
+
+// portSpecPattern matches the Compose short port syntax:
+// [HOST_IP:][HOST_PORT:]CONTAINER_PORT[/PROTOCOL], where ports may be ranges
+var portSpecPattern = regexp.MustCompile(`^(?:(\[[0-9a-fA-F:.]+\]|[0-9.]+):)??(?:(\d+(?:-\d+)?)?:)?(\d+(?:-\d+)?)(?:/(tcp|udp|sctp))?$`)
+
+// ValidateCompose parses compose content and checks it against the parts of
+// the Compose spec the tools rely on. Problems that would make the stack
+// unusable are returned as an error; anything else is returned as warnings.
+func ValidateCompose(content string) (*ComposeFile, []string, error) {
+	var compose ComposeFile
+	if err := yaml.Unmarshal([]byte(content), &compose); err != nil {
+		return nil, nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+
+	var topLevel map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &topLevel); err != nil {
+		return nil, nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+
+	if len(compose.Services) == 0 {
+		return nil, nil, fmt.Errorf("invalid compose file: no services defined")
+	}
+
+	unknownKeys := []string{}
+	for key := range topLevel {
+		if !composeTopLevelKeys[key] && !strings.HasPrefix(key, "x-") {
+			unknownKeys = append(unknownKeys, key)
+		}
+	}
+	sort.Strings(unknownKeys)
+
+	warnings := []string{}
+	for _, key := range unknownKeys {
+		warnings = append(warnings, fmt.Sprintf("unknown top-level key %q", key))
+	}
+
+	names := make([]string, 0, len(compose.Services))
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		service := compose.Services[name]
+		if service.Image == "" && service.Build == nil {
+			warnings = append(warnings, fmt.Sprintf("service %q has no image or build", name))
+		}
+		if len(service.Ports) == 0 {
+			warnings = append(warnings, fmt.Sprintf("service %q has no published ports", name))
+		}
+		for _, port := range service.Ports {
+			if err := validatePortSpec(port); err != nil {
+				return nil, nil, fmt.Errorf("invalid compose file: service %q: %w", name, err)
+			}
+		}
+	}
+
+	return &compose, warnings, nil
+}
+
+// ValidateProfiles checks that each profile is used by some service, since
+// compose silently starts nothing extra for a misspelt one
+func ValidateProfiles(compose *ComposeFile, profiles []string) error {
+	defined := []string{}
+	for _, service := range compose.Services {
+		for _, profile := range service.Profiles {
+			if !slices.Contains(defined, profile) {
+				defined = append(defined, profile)
+			}
+		}
+	}
+	sort.Strings(defined)
+
+	for _, profile := range profiles {
+		if slices.Contains(defined, profile) {
+			continue
+		}
+		if len(defined) == 0 {
+			return fmt.Errorf("unknown profile %q: the compose file defines no profiles", profile)
+		}
+		return fmt.Errorf("unknown profile %q; profiles: %s", profile, strings.Join(defined, ", "))
+	}
+	return nil
+}
+
+// WithProfiles returns the compose file narrowed to the services compose
+// starts with profiles enabled: those without a profile and those in one
+// of profiles
+func (c *ComposeFile) WithProfiles(profiles []string) *ComposeFile {
+	active := &ComposeFile{Services: map[string]Service{}}
+	for name, service := range c.Services {
+		if len(service.Profiles) == 0 || slices.ContainsFunc(service.Profiles, func(p string) bool {
+			return slices.Contains(profiles, p)
+		}) {
+			active.Services[name] = service
+		}
+	}
+	return active
+}
+
+// validatePortSpec checks a short-syntax port mapping such as "8080:80"
+func validatePortSpec(spec string) error {
+	// Interpolated values can only be checked once compose substitutes them
+	if strings.Contains(spec, "$") {
+		return nil
+	}
+
+	match := portSpecPattern.FindStringSubmatch(spec)
+	if match == nil {
+		return fmt.Errorf("malformed port %q", spec)
+	}
+
+	for _, ports := range match[2:4] {
+		if ports == "" {
+			continue
+		}
+		for _, p := range strings.SplitN(ports, "-", 2) {
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 1 || n > 65535 {
+				return fmt.Errorf("malformed port %q: %s is out of range", spec, p)
+			}
+		}
+	}
+
+	return nil
+}
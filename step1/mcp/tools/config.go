@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnv names the environment variable holding the config file path
+const ConfigEnv = "MCP_CONFIG"
+
+// Config holds the server's settings. Each can be set in the config file and
+// overridden by its environment variable. Values are kept as the strings the
+// environment would give and parsed where they are used, so a setting means
+// the same thing from either source.
+type Config struct {
+	LogLevel       string `yaml:"log_level"`
+	LogDir         string `yaml:"log_dir"`
+	LogMaxSize     string `yaml:"log_max_size"`
+	LogMaxAge      string `yaml:"log_max_age"`
+	LogRedactKeys  string `yaml:"log_redact_keys"`
+	DBDriver       string `yaml:"db_driver"`
+	DBDSN          string `yaml:"db_dsn"`
+	ResultsDir     string `yaml:"results_dir"`
+	K6Binary       string `yaml:"k6_binary"`
+	KeepContainers string `yaml:"keep_containers"`
+	RegistryURL    string `yaml:"registry_url"`
+	RegistryUser   string `yaml:"registry_user"`
+	RegistryPass   string `yaml:"registry_pass"`
+	MetricsAddr    string `yaml:"metrics_addr"`
+	StartupWait    string `yaml:"startup_wait"`
+	MaxVUs         string `yaml:"max_vus"`
+}
+
+// settings is the loaded config; it is set once at startup, before any tool runs
+var settings Config
+
+// envFields maps each setting's environment variable to its field
+func (c *Config) envFields() map[string]*string {
+	return map[string]*string{
+		"MCP_LOG_LEVEL":       &c.LogLevel,
+		"MCP_LOG_DIR":         &c.LogDir,
+		"MCP_LOG_MAX_SIZE":    &c.LogMaxSize,
+		"MCP_LOG_MAX_AGE":     &c.LogMaxAge,
+		"MCP_LOG_REDACT_KEYS": &c.LogRedactKeys,
+		"MCP_DB_DRIVER":       &c.DBDriver,
+		"MCP_DB_DSN":          &c.DBDSN,
+		"MCP_RESULTS_DIR":     &c.ResultsDir,
+		K6BinaryEnv:           &c.K6Binary,
+		KeepContainersEnv:     &c.KeepContainers,
+		"MCP_REGISTRY_URL":    &c.RegistryURL,
+		"MCP_REGISTRY_USER":   &c.RegistryUser,
+		"MCP_REGISTRY_PASS":   &c.RegistryPass,
+		"MCP_METRICS_ADDR":    &c.MetricsAddr,
+		"MCP_STARTUP_WAIT":    &c.StartupWait,
+		"MCP_MAX_VUS":         &c.MaxVUs,
+	}
+}
+
+// ConfigPath returns the config file to read: MCP_CONFIG, or
+// ~/.speak-perf-mcp/config.yaml by default
+func ConfigPath() string {
+	if path := os.Getenv(ConfigEnv); path != "" {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".speak-perf-mcp", "config.yaml")
+}
+
+// LoadConfig reads the config file at path, if there is one, applies
+// environment overrides and makes the result the server's settings. A file
+// that can't be read or parsed is reported, and the environment alone is used.
+func LoadConfig(path string) error {
+	var c Config
+	var fileErr error
+	if path != "" {
+		if content, err := os.ReadFile(path); err == nil {
+			if err := yaml.Unmarshal(content, &c); err != nil {
+				c = Config{}
+				fileErr = fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+		} else if !os.IsNotExist(err) {
+			fileErr = fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+	}
+
+	for name, field := range c.envFields() {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+	settings = c
+	return fileErr
+}
+
+// Settings returns the server's settings
+func Settings() Config {
+	return settings
+}
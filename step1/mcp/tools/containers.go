@@ -0,0 +1,975 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ProjectPrefixes are the compose project name prefixes used by the tools
+var ProjectPrefixes = []string{"perftest-", "quick-", "auto-", "discover-"}
+
+// teardownTimeout bounds how long a single `docker compose down` may take
+const teardownTimeout = 2 * time.Minute
+
+// KeepContainersEnv names the environment variable that, when "true", leaves
+// compose projects running after a run unless keepContainers says otherwise
+const KeepContainersEnv = "MCP_KEEP_CONTAINERS"
+
+// SessionStatusLeftRunning marks a session whose containers were kept running
+// for inspection
+const SessionStatusLeftRunning = "left-running"
+
+// ComposeProject is a docker compose project started by one of the tools
+type ComposeProject struct {
+	Name        string
+	ComposePath string
+	// Profiles are the compose profiles the project was started with
+	Profiles []string
+	cancel   context.CancelFunc
+}
+
+// ParseProfiles reads a comma-separated list of compose profiles, dropping
+// blanks and repeats
+func ParseProfiles(value string) []string {
+	profiles := []string{}
+	for _, profile := range strings.Split(value, ",") {
+		profile = strings.TrimSpace(profile)
+		if profile != "" && !slices.Contains(profiles, profile) {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// ProfilesColumn is how profiles are stored in test_sessions.profiles: NULL
+// when none were active
+func ProfilesColumn(profiles []string) sql.NullString {
+	if len(profiles) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: strings.Join(profiles, ","), Valid: true}
+}
+
+// SessionProfiles returns the compose profiles recorded for a session
+func SessionProfiles(db *DB, sessionId int64) ([]string, error) {
+	var profiles sql.NullString
+	if err := db.QueryRow("SELECT profiles FROM test_sessions WHERE id = ?", sessionId).Scan(&profiles); err != nil {
+		return nil, err
+	}
+	return ParseProfiles(profiles.String), nil
+}
+
+// composeArgs builds a `docker compose` command line for a project, enabling
+// its profiles; compose leaves services of other profiles alone
+func composeArgs(composePath, projectName string, profiles []string, args ...string) []string {
+	command := []string{"compose"}
+	if composePath != "" {
+		command = append(command, "-f", composePath)
+	}
+	command = append(command, "-p", projectName)
+	for _, profile := range profiles {
+		command = append(command, "--profile", profile)
+	}
+	return append(command, args...)
+}
+
+var (
+	activeProjectsMu sync.Mutex
+	activeProjects   = make(map[string]*ComposeProject)
+)
+
+// StartComposeProject runs `docker compose up -d` for the project and tracks it
+// in the active-projects registry. The returned context is derived from ctx and
+// is cancelled if the server shuts down; callers should use it for the rest of
+// the run and must call Stop when done. Only services without a profile or
+// in one of profiles are started. An `up` that fails with a transient error
+// is tried again; see IsTransientComposeError.
+func StartComposeProject(ctx context.Context, deps *SharedDependencies, composePath, projectName string, profiles []string) (*ComposeProject, context.Context, []byte, error) {
+	// The span covers `up` only, so it isn't the parent of the run's later spans
+	_, span := StartSpan(ctx, "compose up", attribute.String("compose.project", projectName))
+	var err error
+	defer func() { EndSpan(span, err) }()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	project := &ComposeProject{
+		Name:        projectName,
+		ComposePath: composePath,
+		Profiles:    profiles,
+		cancel:      cancel,
+	}
+
+	// The owner label lets a later server's startup sweep tell whether this
+	// project's server is still running
+	override, err := writeOwnerOverride(composePath)
+	if err != nil {
+		cancel()
+		return nil, ctx, nil, err
+	}
+	defer os.Remove(override)
+
+	if err = RegistryLogin(runCtx); err != nil {
+		cancel()
+		return nil, ctx, nil, err
+	}
+
+	activeProjectsMu.Lock()
+	activeProjects[projectName] = project
+	activeProjectsMu.Unlock()
+
+	var output []byte
+	backoff := composeInitialBackoff
+	for attempt := 1; ; attempt++ {
+		attemptStart := time.Now()
+		startCmd := exec.CommandContext(runCtx, "docker", composeArgs(composePath, projectName, profiles, "-f", override, "up", "-d")...)
+		output, err = startCmd.CombinedOutput()
+		if err == nil || runCtx.Err() != nil || !IsTransientComposeError(output) {
+			break
+		}
+		if attempt == composeAttempts {
+			err = fmt.Errorf("%w (failed %d times)", err, attempt)
+			break
+		}
+
+		// `up` picks up where the failed attempt stopped
+		deps.Logger.LogContainerOperation("start", projectName, time.Since(attemptStart), err, map[string]interface{}{
+			"attempt":  attempt,
+			"output":   string(output),
+			"retry_in": backoff.String(),
+		})
+		deps.SendProgress(ctx, "Retrying container start after a transient error", map[string]interface{}{
+			"project_name": projectName,
+			"attempt":      attempt + 1,
+		})
+		if !sleepContext(runCtx, backoff) {
+			break
+		}
+		backoff = min(backoff*2, composeMaxBackoff)
+	}
+	if err != nil {
+		// Partially started projects still need tearing down
+		project.Stop()
+		switch {
+		case IsImageNotFoundError(output):
+			err = fmt.Errorf("%w: %v", ErrImageNotFound, err)
+		case IsPullAuthError(output):
+			err = fmt.Errorf("%w: %v", ErrRegistryAuth, err)
+		}
+		return nil, ctx, output, err
+	}
+
+	return project, runCtx, output, nil
+}
+
+const (
+	// composeAttempts is how many times `docker compose pull` and `up` are
+	// tried when they fail with a transient error
+	composeAttempts = 3
+	// composeInitialBackoff doubles between attempts, up to composeMaxBackoff
+	composeInitialBackoff = 2 * time.Second
+	composeMaxBackoff     = 10 * time.Second
+)
+
+// transientComposeErrors are what docker prints when a pull or start fails
+// for a reason that may pass by itself: a network timeout, a dropped
+// connection or a registry server error
+var transientComposeErrors = []string{
+	"i/o timeout",
+	"tls handshake timeout",
+	"client.timeout exceeded",
+	"request canceled while waiting for connection",
+	"connection reset by peer",
+	"unexpected eof",
+	"temporary failure in name resolution",
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+}
+
+// IsTransientComposeError reports whether `docker compose` output shows a
+// failure worth retrying. Anything else, such as an invalid compose file, a
+// missing image or a build error, fails the same way every time, and a
+// registry refusing credentials is never retried.
+func IsTransientComposeError(output []byte) bool {
+	if IsPullAuthError(output) || IsImageNotFoundError(output) {
+		return false
+	}
+	text := strings.ToLower(string(output))
+	for _, marker := range transientComposeErrors {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// sleepContext waits for d and reports whether it did, rather than ctx
+// ending first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// PullTimeout bounds image pulls. It is separate from the tests' timeouts,
+// and generous, because a cold machine can spend minutes pulling.
+const PullTimeout = 30 * time.Minute
+
+// pullEvents are the per-service states in `docker compose pull` output;
+// layer lines such as "Downloading" are too noisy to report
+var pullEvents = map[string]bool{"Pulling": true, "Pulled": true, "Skipped": true, "Error": true, "Interrupted": true}
+
+// PullImages runs `docker compose pull` before a project starts, reporting
+// each service's pull as progress, so the wait for services to start only
+// begins once their images are present. Images that can't be pulled, such as
+// ones built locally, are left for `up` to build or report. Images of
+// services outside profiles are not pulled. A pull that fails with a
+// transient error is tried again.
+func PullImages(ctx context.Context, deps *SharedDependencies, composePath, projectName string, profiles []string) (err error) {
+	ctx, span := StartSpan(ctx, "compose pull", attribute.String("compose.project", projectName))
+	defer func() { EndSpan(span, err) }()
+
+	if err := RegistryLogin(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, PullTimeout)
+	defer cancel()
+
+	start := time.Now()
+	deps.SendProgress(ctx, "Pulling images", map[string]interface{}{
+		"project_name": projectName,
+	})
+	report := func(service, event string) {
+		deps.SendProgress(ctx, fmt.Sprintf("Image for %s: %s", service, strings.ToLower(event)), map[string]interface{}{
+			"project_name": projectName,
+			"service":      service,
+			"event":        event,
+			"elapsed":      time.Since(start).Round(time.Second).String(),
+		})
+	}
+	backoff := composeInitialBackoff
+	for attempt := 1; ; attempt++ {
+		attemptStart := time.Now()
+		output := &pullOutput{report: report}
+		cmd := exec.CommandContext(ctx, "docker", composeArgs(composePath, projectName, profiles, "pull", "--ignore-pull-failures")...)
+		cmd.Stdout = output
+		cmd.Stderr = output
+		err = cmd.Run()
+		output.flush()
+		deps.Logger.LogContainerOperation("pull", projectName, time.Since(attemptStart), err, map[string]interface{}{
+			"attempt": attempt,
+		})
+
+		// Failed pulls don't fail the command, so the output tells
+		if ctx.Err() != nil || !output.Transient() || attempt == composeAttempts {
+			break
+		}
+		deps.Logger.LogInfo("Retrying image pull after a transient error", map[string]interface{}{
+			"project_name": projectName,
+			"attempt":      attempt,
+			"retry_in":     backoff.String(),
+		})
+		deps.SendProgress(ctx, "Retrying image pull after a transient error", map[string]interface{}{
+			"project_name": projectName,
+			"attempt":      attempt + 1,
+		})
+		if !sleepContext(ctx, backoff) {
+			break
+		}
+		backoff = min(backoff*2, composeMaxBackoff)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("pulling images timed out after %s", PullTimeout)
+	}
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// Other failures are left to `up`, which reports them with its output
+	return nil
+}
+
+// pullOutput splits `docker compose pull` output into lines and reports the
+// per-service events among them
+type pullOutput struct {
+	report  func(service, event string)
+	partial []byte
+	// transient and authDenied record whether any line showed a transient
+	// error, or a registry refusing credentials or missing an image
+	transient  bool
+	authDenied bool
+}
+
+// Transient reports whether the pull failed in a way worth retrying
+func (o *pullOutput) Transient() bool {
+	return o.transient && !o.authDenied
+}
+
+func (o *pullOutput) Write(data []byte) (int, error) {
+	o.partial = append(o.partial, data...)
+	for {
+		// Without a terminal, compose ends progress lines with \n or \r
+		i := bytes.IndexAny(o.partial, "\r\n")
+		if i < 0 {
+			return len(data), nil
+		}
+		o.line(string(o.partial[:i]))
+		o.partial = o.partial[i+1:]
+	}
+}
+
+func (o *pullOutput) flush() {
+	o.line(string(o.partial))
+	o.partial = nil
+}
+
+// line reports lines such as " api Pulling" or " ✔ api Pulled 3.2s"
+func (o *pullOutput) line(line string) {
+	if IsPullAuthError([]byte(line)) || IsImageNotFoundError([]byte(line)) {
+		o.authDenied = true
+	} else if IsTransientComposeError([]byte(line)) {
+		o.transient = true
+	}
+	fields := strings.Fields(line)
+	// Skip status symbols such as ✔ that newer compose versions print
+	for len(fields) > 0 && !strings.ContainsAny(fields[0], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") {
+		fields = fields[1:]
+	}
+	if len(fields) < 2 || !pullEvents[fields[1]] {
+		return
+	}
+	// Layers print "<id> Pulling fs layer"
+	if len(fields) > 2 && fields[2] == "fs" {
+		return
+	}
+	o.report(fields[0], fields[1])
+}
+
+// ErrRegistryAuth marks a compose start that failed because a registry
+// refused to serve an image without valid credentials
+var ErrRegistryAuth = errors.New("image pull was denied by the registry; set MCP_REGISTRY_URL, MCP_REGISTRY_USER and MCP_REGISTRY_PASS to log in before starting containers")
+
+// ErrImageNotFound marks a compose start that failed because an image's
+// repository or tag doesn't exist
+var ErrImageNotFound = errors.New("image not found: check the image names and tags in the compose file. Docker Hub gives the same answer for a private repository it got no credentials for; for those, set MCP_REGISTRY_URL, MCP_REGISTRY_USER and MCP_REGISTRY_PASS")
+
+// pullAuthErrors are what docker prints when a registry refuses a pull for
+// lack of credentials
+var pullAuthErrors = []string{
+	"authentication required",
+	"no basic auth credentials",
+	"incorrect username or password",
+}
+
+// pullAccessDenied is also printed for images that don't exist, so it only
+// counts as a credentials problem with one of pullAuthHints
+const pullAccessDenied = "pull access denied"
+
+var pullAuthHints = []string{"may require 'docker login'", "authentication required"}
+
+// imageNotFoundErrors are what docker prints when an image's repository or
+// tag doesn't exist. Docker Hub says "repository does not exist or may
+// require 'docker login'" for both missing and private repositories.
+var imageNotFoundErrors = []string{
+	"repository does not exist",
+	"manifest unknown",
+	"name unknown",
+}
+
+// IsPullAuthError reports whether `docker compose up` output shows an image
+// pull refused for lack of credentials, rather than for a missing image
+func IsPullAuthError(output []byte) bool {
+	if IsImageNotFoundError(output) {
+		return false
+	}
+	text := strings.ToLower(string(output))
+	for _, marker := range pullAuthErrors {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	if strings.Contains(text, pullAccessDenied) {
+		for _, hint := range pullAuthHints {
+			if strings.Contains(text, hint) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsImageNotFoundError reports whether `docker compose` output shows an
+// image whose repository or tag doesn't exist
+func IsImageNotFoundError(output []byte) bool {
+	text := strings.ToLower(string(output))
+	for _, marker := range imageNotFoundErrors {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// registryLoginMu guards registryLoggedIn; docker keeps the credentials, so
+// one successful login serves every later run
+var (
+	registryLoginMu  sync.Mutex
+	registryLoggedIn bool
+)
+
+// RegistryLogin runs `docker login` with the registry_* settings
+// (MCP_REGISTRY_URL, MCP_REGISTRY_USER, MCP_REGISTRY_PASS) when a user is
+// set, so compose can pull private images. The password goes to docker on
+// stdin and is never logged or put on a command line.
+func RegistryLogin(ctx context.Context) error {
+	config := Settings()
+	if config.RegistryUser == "" {
+		return nil
+	}
+	if config.RegistryPass == "" {
+		return errors.New("MCP_REGISTRY_USER is set without MCP_REGISTRY_PASS")
+	}
+
+	registryLoginMu.Lock()
+	defer registryLoginMu.Unlock()
+	if registryLoggedIn {
+		return nil
+	}
+
+	args := []string{"login", "--username", config.RegistryUser, "--password-stdin"}
+	if config.RegistryURL != "" {
+		args = append(args, config.RegistryURL)
+	}
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdin = strings.NewReader(config.RegistryPass)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		registry := config.RegistryURL
+		if registry == "" {
+			registry = "Docker Hub"
+		}
+		return fmt.Errorf("docker login to %s as %s failed: %v\n%s", registry, config.RegistryUser, err, strings.TrimSpace(string(output)))
+	}
+	registryLoggedIn = true
+	return nil
+}
+
+// Stop tears the project down with `docker compose down -v` and removes it from
+// the registry. It is a no-op if the project was already stopped (e.g. during
+// server shutdown).
+func (p *ComposeProject) Stop() error {
+	activeProjectsMu.Lock()
+	_, tracked := activeProjects[p.Name]
+	delete(activeProjects, p.Name)
+	activeProjectsMu.Unlock()
+
+	p.cancel()
+	if !tracked {
+		return nil
+	}
+	return composeDown(p.Name, p.ComposePath, p.Profiles)
+}
+
+// Release removes the project from the registry without tearing it down, so
+// its containers outlive the run and server shutdown
+func (p *ComposeProject) Release() {
+	activeProjectsMu.Lock()
+	delete(activeProjects, p.Name)
+	activeProjectsMu.Unlock()
+
+	p.cancel()
+}
+
+// KeepContainers reports whether a run should leave its containers running:
+// the keepContainers parameter ("true"/"false") if given, else the
+// keep_containers setting (MCP_KEEP_CONTAINERS)
+func KeepContainers(param string) bool {
+	if param != "" {
+		return param == "true"
+	}
+	return Settings().KeepContainers == "true"
+}
+
+// KeepProject releases the project instead of tearing it down and marks its
+// session left-running, recording the project name so it can be found later
+func KeepProject(db *DB, project *ComposeProject, sessionId int64) error {
+	project.Release()
+	_, err := db.Exec("UPDATE test_sessions SET status = ?, project_name = ? WHERE id = ?",
+		SessionStatusLeftRunning, project.Name, sessionId)
+	return err
+}
+
+// KeptProjectHint tells the user how to inspect and remove a project that was
+// left running
+func KeptProjectHint(projectName string) string {
+	return fmt.Sprintf("Containers were left running in compose project %s.\n"+
+		"- Logs: docker compose -p %s logs\n"+
+		"- Shell: docker compose -p %s exec <service> sh\n"+
+		"- Remove: the teardown_environment tool, docker compose -p %s down -v, or the cleanup tool", projectName, projectName, projectName, projectName)
+}
+
+// LeftRunningProjects returns the compose projects of sessions marked left-running
+func LeftRunningProjects(db *DB) (map[string]bool, error) {
+	rows, err := db.Query("SELECT project_name FROM test_sessions WHERE status = ? AND project_name IS NOT NULL",
+		SessionStatusLeftRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			projects[name] = true
+		}
+	}
+	return projects, rows.Err()
+}
+
+// ActiveProjects returns the names of compose projects currently running
+func ActiveProjects() []string {
+	activeProjectsMu.Lock()
+	defer activeProjectsMu.Unlock()
+
+	names := make([]string, 0, len(activeProjects))
+	for name := range activeProjects {
+		names = append(names, name)
+	}
+	return names
+}
+
+// StopActiveProjects cancels every in-flight run and tears down its compose
+// project. It is intended to be called once on server shutdown and returns
+// a map of project name to teardown error (nil on success).
+func StopActiveProjects() map[string]error {
+	activeProjectsMu.Lock()
+	projects := make([]*ComposeProject, 0, len(activeProjects))
+	for _, p := range activeProjects {
+		projects = append(projects, p)
+	}
+	activeProjectsMu.Unlock()
+
+	results := make(map[string]error, len(projects))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, p := range projects {
+		wg.Add(1)
+		go func(p *ComposeProject) {
+			defer wg.Done()
+			err := p.Stop()
+			mu.Lock()
+			results[p.Name] = err
+			mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// SweepOrphanedProjects removes compose projects left behind by a previous
+// crashed run: any project matching ProjectPrefixes that this process is not
+// tracking, that is not in kept, the projects deliberately left running, and
+// whose owning server, named by OwnerLabel, is no longer running. Projects
+// without an owner predate the label and are removed too. It returns the
+// names of the projects that were torn down.
+func SweepOrphanedProjects(ctx context.Context, kept map[string]bool) ([]string, error) {
+	orphaned, err := OrphanedProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owners, err := projectOwners(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, name := range orphaned {
+		if kept[name] {
+			continue
+		}
+		// Another server's in-flight run is left to that server
+		if slices.ContainsFunc(owners[name], ownerAlive) {
+			continue
+		}
+		if err := RemoveProject(name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+
+	return removed, nil
+}
+
+// OrphanedProjects lists the compose projects matching ProjectPrefixes that
+// this process is not tracking, including any left running on purpose
+func OrphanedProjects(ctx context.Context) ([]string, error) {
+	projects, err := listProjects(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	activeProjectsMu.Lock()
+	tracked := make(map[string]bool, len(activeProjects))
+	for name := range activeProjects {
+		tracked[name] = true
+	}
+	activeProjectsMu.Unlock()
+
+	orphaned := []string{}
+	for _, name := range projects {
+		if tracked[name] || !HasProjectPrefix(name) {
+			continue
+		}
+		orphaned = append(orphaned, name)
+	}
+	return orphaned, nil
+}
+
+// listProjects returns the names of the compose projects with running
+// containers, or with any containers when all is set
+func listProjects(ctx context.Context, all bool) ([]string, error) {
+	args := []string{"compose", "ls", "--format", "json"}
+	if all {
+		args = append(args, "--all")
+	}
+	output, err := exec.CommandContext(ctx, "docker", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list compose projects: %w", err)
+	}
+
+	var projects []struct {
+		Name string `json:"Name"`
+	}
+	if err := json.Unmarshal(output, &projects); err != nil {
+		return nil, fmt.Errorf("failed to parse compose project list: %w", err)
+	}
+
+	names := make([]string, 0, len(projects))
+	for _, p := range projects {
+		names = append(names, p.Name)
+	}
+	return names, nil
+}
+
+// ProjectRunning reports whether a compose project has running containers
+func ProjectRunning(ctx context.Context, projectName string) (bool, error) {
+	projects, err := listProjects(ctx, false)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(projects, projectName), nil
+}
+
+// ReusedProjectName is the compose project reuseEnvironment keeps running
+// for a session when no projectName is given
+func ReusedProjectName(sessionId int64) string {
+	return fmt.Sprintf("perftest-session-%d", sessionId)
+}
+
+// projectNameRegex matches the project names docker compose accepts
+var projectNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidateProjectName checks a projectName parameter
+func ValidateProjectName(name string) error {
+	if !projectNameRegex.MatchString(name) {
+		return fmt.Errorf("Invalid projectName %q: must be lowercase letters, digits, dashes and underscores, starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// AttachComposeProject returns a handle on a project that is already
+// running, so a run can check its services and collect their logs without
+// starting it. The project isn't tracked: neither Stop nor server shutdown
+// tears it down. The returned context is derived from ctx.
+func AttachComposeProject(ctx context.Context, composePath, projectName string, profiles []string) (*ComposeProject, context.Context) {
+	runCtx, cancel := context.WithCancel(ctx)
+	return &ComposeProject{
+		Name:        projectName,
+		ComposePath: composePath,
+		Profiles:    profiles,
+		cancel:      cancel,
+	}, runCtx
+}
+
+// RemoveProject tears down a compose project this process is not tracking
+func RemoveProject(projectName string) error {
+	if err := composeDown(projectName, "", nil); err != nil {
+		return fmt.Errorf("failed to remove project %s: %w", projectName, err)
+	}
+	return nil
+}
+
+// HasProjectPrefix reports whether a compose project name was created by these tools
+func HasProjectPrefix(name string) bool {
+	for _, prefix := range ProjectPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits on the service logs collected when a run fails: lines per service,
+// and bytes kept from the end of the combined output
+const (
+	ServiceLogTail     = 200
+	MaxServiceLogBytes = 16 << 10
+)
+
+// serviceLogsTimeout bounds how long `docker compose logs` may take
+const serviceLogsTimeout = 30 * time.Second
+
+// ServiceLogs returns the last ServiceLogTail lines of each service's logs,
+// trimmed to the final MaxServiceLogBytes, so a failed run can show why the
+// services misbehaved. It must be called before Stop removes the containers.
+func (p *ComposeProject) ServiceLogs() (string, error) {
+	logs, err := p.logs(ServiceLogTail)
+	if err != nil {
+		return "", err
+	}
+	if len(logs) > MaxServiceLogBytes {
+		// The end of the logs is nearest the failure; start on a line boundary
+		logs = logs[len(logs)-MaxServiceLogBytes:]
+		if i := strings.IndexByte(logs, '\n'); i >= 0 {
+			logs = logs[i+1:]
+		}
+		logs = fmt.Sprintf("[earlier lines truncated to the last %d KB]\n%s", MaxServiceLogBytes>>10, logs)
+	}
+	return logs, nil
+}
+
+// logs returns the last tail lines of the named services' logs, or of every
+// service when none are named
+func (p *ComposeProject) logs(tail int, services ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), serviceLogsTimeout)
+	defer cancel()
+
+	args := composeArgs(p.ComposePath, p.Name, p.Profiles, "logs", "--no-color", "--tail", fmt.Sprintf("%d", tail))
+	output, err := exec.CommandContext(ctx, "docker", append(args, services...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("docker compose logs failed: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ServiceState is a container's state as `docker compose ps` reports it
+type ServiceState struct {
+	Service  string `json:"Service"`
+	State    string `json:"State"`
+	Health   string `json:"Health"`
+	ExitCode int    `json:"ExitCode"`
+}
+
+// Crashed reports whether the container failed: it exited with a non-zero
+// code, is restarting, never started or fails its healthcheck. One that
+// exited with 0, such as a migration job, ran to completion.
+func (s ServiceState) Crashed() bool {
+	switch {
+	case s.Health == "unhealthy":
+		return true
+	case s.State == "running":
+		return false
+	case s.State == "exited":
+		return s.ExitCode != 0
+	default:
+		return true
+	}
+}
+
+// Problem describes how a crashed container failed
+func (s ServiceState) Problem() string {
+	switch {
+	case s.State == "exited" || s.State == "dead":
+		return fmt.Sprintf("crashed on startup (exited with code %d)", s.ExitCode)
+	case s.State == "restarting":
+		return fmt.Sprintf("keeps crashing on startup (restarting, last exit code %d)", s.ExitCode)
+	case s.Health == "unhealthy":
+		return "is unhealthy"
+	default:
+		return fmt.Sprintf("did not start (%s)", s.State)
+	}
+}
+
+// ServiceStates lists the project's containers, including stopped ones
+func (p *ComposeProject) ServiceStates() ([]ServiceState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), serviceLogsTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "docker", composeArgs(p.ComposePath, p.Name, p.Profiles, "ps", "-a", "--format", "json")...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker compose ps failed: %w", err)
+	}
+
+	// Compose prints a JSON array before v2.21 and one object per line since
+	output = bytes.TrimSpace(output)
+	states := []ServiceState{}
+	if len(output) > 0 && output[0] == '[' {
+		if err := json.Unmarshal(output, &states); err != nil {
+			return nil, fmt.Errorf("failed to parse docker compose ps: %w", err)
+		}
+		return states, nil
+	}
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var state ServiceState
+		if err := json.Unmarshal(line, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse docker compose ps: %w", err)
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// DefaultStartupWait is how long services get to start before they are
+// probed or tested; test_application waits longer, as it also discovers specs
+const DefaultStartupWait = 10 * time.Second
+
+// MaxStartupWait caps how long services are given to start before they are
+// probed or tested
+const MaxStartupWait = 5 * time.Minute
+
+// StartupWait returns how long to give services to start: the startupWait
+// parameter if given, else the startup_wait setting (MCP_STARTUP_WAIT), else
+// the tool's default. Both are durations such as 45s, from 0 up to
+// MaxStartupWait.
+func StartupWait(param string, toolDefault time.Duration) (time.Duration, error) {
+	name, value := "startupWait", param
+	if value == "" {
+		name, value = "MCP_STARTUP_WAIT", Settings().StartupWait
+	}
+	if value == "" {
+		return toolDefault, nil
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 || wait > MaxStartupWait {
+		return 0, fmt.Errorf("Invalid %s %q: must be a duration from 0s to %s, such as 45s", name, value, MaxStartupWait)
+	}
+	return wait, nil
+}
+
+// WaitForStartup gives a project's services d to start. It returns early with
+// an error if ctx ends first, so a cancelled tool call goes straight to
+// tearing the project down.
+func WaitForStartup(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("cancelled while waiting for services to start: %w", ctx.Err())
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// CrashLogTail is how many log lines of each crashed service are shown
+const CrashLogTail = 20
+
+// CheckServicesStarted returns an error naming each service that crashed on
+// startup, with its exit code and last log lines, so a run can stop before
+// k6 meets refused connections. A failure to inspect the containers is
+// logged and the run goes ahead as it would have without the check.
+func CheckServicesStarted(deps *SharedDependencies, project *ComposeProject) error {
+	states, err := project.ServiceStates()
+	if err != nil {
+		deps.Logger.LogError("Failed to check service states", err, map[string]interface{}{
+			"project_name": project.Name,
+		})
+		return nil
+	}
+
+	problems := []string{}
+	for _, state := range states {
+		if !state.Crashed() {
+			continue
+		}
+		deps.Logger.LogError("Service failed to start", errors.New(state.Problem()), map[string]interface{}{
+			"project_name": project.Name,
+			"service":      state.Service,
+			"state":        state.State,
+			"health":       state.Health,
+			"exit_code":    state.ExitCode,
+		})
+		problem := fmt.Sprintf("Service %s %s", state.Service, state.Problem())
+		if logs, err := project.logs(CrashLogTail, state.Service); err == nil && logs != "" {
+			problem += fmt.Sprintf("\nLast %d log lines:\n```\n%s\n```", CrashLogTail, logs)
+		}
+		problems = append(problems, problem)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "\n\n"))
+}
+
+// RunFailed reports whether a run failed badly enough to be worth its
+// service logs: its thresholds were crossed, or an endpoint's error rate was
+// over DefaultMaxErrorRate, which catches scripts without thresholds
+func RunFailed(thresholdsPassed bool, metrics map[string]*EndpointMetrics) bool {
+	if !thresholdsPassed {
+		return true
+	}
+	for _, m := range metrics {
+		if m.Requests() > 0 && m.ErrorRate() > DefaultMaxErrorRate {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectServiceLogs fetches the project's service logs and stores them with
+// the run. A failure to collect them is logged and returns an empty excerpt,
+// so it never hides the run's own result.
+func CollectServiceLogs(deps *SharedDependencies, project *ComposeProject, runId int64) string {
+	logs, err := project.ServiceLogs()
+	if err != nil {
+		deps.Logger.LogError("Failed to collect service logs", err, map[string]interface{}{
+			"run_id":       runId,
+			"project_name": project.Name,
+		})
+		return ""
+	}
+	if _, err := deps.DB.Exec("UPDATE test_runs SET service_logs = ? WHERE id = ?", logs, runId); err != nil {
+		deps.Logger.LogError("Failed to store service logs", err, map[string]interface{}{"run_id": runId})
+	}
+	return logs
+}
+
+// ServiceLogsSection renders collected service logs for a tool result
+func ServiceLogsSection(logs string) string {
+	return fmt.Sprintf("Service logs (last %d lines per service):\n```\n%s\n```\n", ServiceLogTail, logs)
+}
+
+// composeDown removes a project's containers and volumes. profiles must
+// include those the project was started with, or their services are left
+// running.
+func composeDown(projectName, composePath string, profiles []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), teardownTimeout)
+	defer cancel()
+
+	if composePath != "" {
+		if _, err := os.Stat(composePath); err != nil {
+			composePath = ""
+		}
+	}
+	args := composeArgs(composePath, projectName, profiles, "down", "-v")
+
+	return exec.CommandContext(ctx, "docker", args...).Run()
+}
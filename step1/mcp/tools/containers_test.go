@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"testing"
+)
+
+func TestPullErrorClassification(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		auth      bool
+		notFound  bool
+		transient bool
+	}{
+		{
+			name:     "missing Docker Hub repository",
+			output:   "Error response from daemon: pull access denied for myorg/apii, repository does not exist or may require 'docker login': denied: requested access to the resource is denied",
+			notFound: true,
+		},
+		{
+			name:     "missing tag",
+			output:   "Error response from daemon: manifest for nginx:1.999 not found: manifest unknown: manifest unknown",
+			notFound: true,
+		},
+		{
+			name:     "missing repository on another registry",
+			output:   "Error response from daemon: Head \"https://ghcr.io/v2/myorg/apii/manifests/latest\": name unknown",
+			notFound: true,
+		},
+		{
+			name:   "pull access denied needing login",
+			output: "Error response from daemon: pull access denied for registry.example.com/api, may require 'docker login'",
+			auth:   true,
+		},
+		{
+			name:   "authentication required",
+			output: "Error response from daemon: Head \"https://registry.example.com/v2/api/manifests/1.0\": unauthorized: authentication required",
+			auth:   true,
+		},
+		{
+			name:   "no credentials",
+			output: "Error response from daemon: Get \"https://123.dkr.ecr.us-east-1.amazonaws.com/v2/\": no basic auth credentials",
+			auth:   true,
+		},
+		{
+			name:   "pull access denied alone",
+			output: "Error response from daemon: pull access denied for api",
+		},
+		{
+			name:   "bare unauthorized",
+			output: "level=warning msg=\"unauthorized client\"",
+		},
+		{
+			name:      "registry timeout",
+			output:    "Error response from daemon: Get \"https://registry-1.docker.io/v2/\": net/http: TLS handshake timeout",
+			transient: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := []byte(tt.output)
+			if got := IsPullAuthError(output); got != tt.auth {
+				t.Errorf("IsPullAuthError = %v, want %v", got, tt.auth)
+			}
+			if got := IsImageNotFoundError(output); got != tt.notFound {
+				t.Errorf("IsImageNotFoundError = %v, want %v", got, tt.notFound)
+			}
+			if got := IsTransientComposeError(output); got != tt.transient {
+				t.Errorf("IsTransientComposeError = %v, want %v", got, tt.transient)
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	mcpgolang "github.com/mark3labs/mcp-go/mcp"
 )
@@ -30,6 +33,16 @@ func (t *CreateUITestTool) Handle(ctx context.Context, request mcpgolang.CallToo
 	}
 
 	testName := request.GetString("testName", "ui-test")
+	actionTimeout, err := time.ParseDuration(request.GetString("actionTimeout", "10s"))
+	if err != nil || actionTimeout <= 0 {
+		return mcpgolang.NewToolResultError("Invalid actionTimeout: must be a positive duration such as 10s"), nil
+	}
+
+	// Failed actions leave a screenshot here
+	screenshotDir, err := ResultsDir()
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
 
 	// Get most recent session
 	var sessionId int64
@@ -39,28 +52,40 @@ func (t *CreateUITestTool) Handle(ctx context.Context, request mcpgolang.CallToo
 	}
 
 	// Parse natural language instructions
-	script := t.generateK6UITest(url, instructions)
+	script := t.generateK6UITest(url, instructions, actionTimeout, screenshotDir)
 
 	// Store test with session
-	result, err := t.deps.DB.Exec("INSERT INTO tests (session_id, name, type, script) VALUES (?, ?, ?, ?)",
-		sessionId, testName, "browser", script)
+	testId, err := t.deps.DB.Insert("INSERT INTO tests (session_id, name, type, script) VALUES (?, ?, ?, ?)",
+		sessionId, testName, TestTypeBrowser, script)
 	if err != nil {
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to store test: %v", err)), nil
 	}
 
-	testId, _ := result.LastInsertId()
-
-	return mcpgolang.NewToolResultText(fmt.Sprintf("Created UI test '%s' with ID: %d\n\nInstructions parsed:\n%s",
-		testName, testId, instructions)), nil
+	return mcpgolang.NewToolResultText(fmt.Sprintf("Created UI test '%s' with ID: %d\n\nActions wait up to %s for their element; a failed action saves a screenshot to %s\n\nInstructions parsed:\n%s",
+		testName, testId, actionTimeout, screenshotDir, instructions)), nil
 }
 
-func (t *CreateUITestTool) generateK6UITest(url, instructions string) string {
+func (t *CreateUITestTool) generateK6UITest(url, instructions string, actionTimeout time.Duration, screenshotDir string) string {
 	// Parse natural language to k6 browser commands
 	actions := ParseUIInstructions(instructions)
 
-	script := fmt.Sprintf(`import { browser } from 'k6/experimental/browser';
+	browserModule := "k6/browser"
+	pageSetup := `const context = await browser.newContext();
+  const page = await context.newPage();`
+	pageClose := "await page.close();"
+	if !UseStableBrowserModule() {
+		// Older k6 releases only ship the experimental module with a synchronous newPage()
+		browserModule = "k6/experimental/browser"
+		pageSetup = "const page = browser.newPage();"
+		pageClose = "page.close();"
+	}
+
+	script := fmt.Sprintf(`import { browser } from '%s';
 import { check } from 'k6';
 
+const ACTION_TIMEOUT = %d;
+const SCREENSHOT_DIR = __ENV.SCREENSHOT_DIR || %s;
+
 export const options = {
   scenarios: {
     browser: {
@@ -74,24 +99,54 @@ export const options = {
       },
     },
   },
+  thresholds: {
+    browser_web_vital_lcp: ['p(75)<2500'],
+    checks: ['rate==1.0'],
+  },
 };
 
+// screenshot saves the page to SCREENSHOT_DIR, returning the file's path
+async function screenshot(page, name) {
+  const path = SCREENSHOT_DIR + '/ui-' + name + '-' + Date.now() + '.png';
+  await page.screenshot({ path: path });
+  return path;
+}
+
+// step runs one action, saving a screenshot of the page if it fails
+async function step(page, name, action) {
+  try {
+    await action();
+  } catch (err) {
+    try {
+      const path = await screenshot(page, name);
+      console.error('Step ' + name + ' failed, screenshot saved to ' + path);
+    } catch (screenshotErr) {
+      console.error('Step ' + name + ' failed, and the screenshot could not be saved: ' + screenshotErr);
+    }
+    throw err;
+  }
+}
+
 export default async function () {
-  const page = browser.newPage();
-  
+  %s
+
   try {
-    await page.goto('%s');
-    
-`, url)
+    await step(page, 'goto', async () => {
+      await page.goto('%s');
+    });
+
+`, browserModule, actionTimeout.Milliseconds(), strconv.Quote(screenshotDir), pageSetup, url)
 
 	for _, action := range actions {
-		script += "    " + action + "\n"
+		script += "    " + strings.ReplaceAll(action, "\n", "\n    ") + "\n"
 	}
 
-	script += `  } finally {
-    page.close();
+	// The page as the test left it, for comparing against a failed run
+	script += "\n    await screenshot(page, 'final');\n"
+	script += fmt.Sprintf(`  } finally {
+    %s
   }
-}`
+}`, pageClose)
 
 	return script
 }
@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// withK6Version pins the detected k6 version for the length of a test
+func withK6Version(t *testing.T, version string) {
+	t.Helper()
+	k6VersionOnce.Do(func() {})
+	previous := k6Version
+	k6Version = version
+	t.Cleanup(func() { k6Version = previous })
+}
+
+func TestGenerateK6UITestBrowserModule(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		module    string
+		pageSetup []string
+		absent    []string
+	}{
+		{
+			name:      "stable module",
+			version:   "0.52.0",
+			module:    "import { browser } from 'k6/browser';",
+			pageSetup: []string{"const context = await browser.newContext();", "const page = await context.newPage();", "await page.close();"},
+			absent:    []string{"k6/experimental/browser", "browser.newPage()"},
+		},
+		{
+			name:      "version not detected",
+			version:   "",
+			module:    "import { browser } from 'k6/browser';",
+			pageSetup: []string{"const context = await browser.newContext();", "const page = await context.newPage();"},
+			absent:    []string{"k6/experimental/browser"},
+		},
+		{
+			name:      "experimental fallback",
+			version:   "0.51.0",
+			module:    "import { browser } from 'k6/experimental/browser';",
+			pageSetup: []string{"const page = browser.newPage();", "page.close();"},
+			absent:    []string{"'k6/browser'", "newContext()", "await page.close();"},
+		},
+	}
+
+	tool := &CreateUITestTool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withK6Version(t, tt.version)
+			script := tool.generateK6UITest("http://localhost:3000", "click the button", 10*time.Second, "/tmp/shots")
+
+			if first := strings.SplitN(script, "\n", 2)[0]; first != tt.module {
+				t.Errorf("import line = %q, want %q", first, tt.module)
+			}
+			for _, want := range tt.pageSetup {
+				if !strings.Contains(script, want) {
+					t.Errorf("script is missing %q", want)
+				}
+			}
+			for _, unwanted := range tt.absent {
+				if strings.Contains(script, unwanted) {
+					t.Errorf("script contains %q", unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateK6UITestInterleavesChecks(t *testing.T) {
+	withK6Version(t, "0.52.0")
+	instructions := "Expect 'Sign in' to be visible. Type the email and click the login button. " +
+		"Verify the url contains /dashboard, then wait for the charts. Expect element '#total' to have text '42'"
+	script := (&CreateUITestTool{}).generateK6UITest("http://localhost:3000", instructions, 10*time.Second, "/tmp/shots")
+
+	// Each check runs where the instructions ask for it, between the actions
+	order := []string{
+		`{ "'Sign in' is visible":`,
+		`await step(page, "type-input"`,
+		`await step(page, "click-button"`,
+		`{ "url contains /dashboard":`,
+		"await page.waitForTimeout(1000);",
+		`{ "#total contains 42":`,
+	}
+	last := -1
+	for _, want := range order {
+		at := strings.Index(script, want)
+		if at < 0 {
+			t.Fatalf("script is missing %q:\n%s", want, script)
+		}
+		if at < last {
+			t.Errorf("%q is out of order:\n%s", want, script)
+		}
+		last = at
+	}
+}
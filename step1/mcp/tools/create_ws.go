@@ -0,0 +1,130 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestTypeWebSocket is the stored type of tests generated by create_ws_test
+const TestTypeWebSocket = "websocket"
+
+// CreateWSTestTool handles the create_ws_test tool
+type CreateWSTestTool struct {
+	deps *SharedDependencies
+}
+
+// NewCreateWSTestTool creates a new instance of CreateWSTestTool
+func NewCreateWSTestTool(deps *SharedDependencies) *CreateWSTestTool {
+	return &CreateWSTestTool{deps: deps}
+}
+
+// Handle processes the create_ws_test request
+func (t *CreateWSTestTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	wsURL, err := request.RequireString("url")
+	if err != nil {
+		return mcpgolang.NewToolResultError("Missing required url"), nil
+	}
+	if parsed, err := url.Parse(wsURL); err != nil || (parsed.Scheme != "ws" && parsed.Scheme != "wss") || parsed.Host == "" {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid url %q: must be a ws:// or wss:// URL", wsURL)), nil
+	}
+
+	message := request.GetString("message", "")
+	expect := request.GetString("expect", "")
+	testName := request.GetString("testName", "ws-test")
+	vus := int(request.GetFloat("vus", 10))
+	duration := request.GetString("duration", "30s")
+	timeout, err := time.ParseDuration(request.GetString("timeout", "5s"))
+	if err != nil || timeout <= 0 {
+		return mcpgolang.NewToolResultError("Invalid timeout: must be a positive duration such as 5s"), nil
+	}
+	if err := ValidateLoad(vus, duration); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	p95ThresholdMs := request.GetFloat("p95ThresholdMs", DefaultP95ThresholdMs)
+	maxErrorRate := request.GetFloat("maxErrorRate", DefaultMaxErrorRate)
+	if err := ValidateThresholds(p95ThresholdMs, maxErrorRate); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	// Use the given session, else the most recent one
+	var sessionId int64
+	if id := request.GetString("sessionId", ""); id != "" {
+		err = t.deps.DB.QueryRow("SELECT id FROM test_sessions WHERE id = ?", id).Scan(&sessionId)
+	} else {
+		err = t.deps.DB.QueryRow("SELECT id FROM test_sessions ORDER BY started_at DESC, id DESC LIMIT 1").Scan(&sessionId)
+	}
+	if err != nil {
+		return mcpgolang.NewToolResultError("No active session. Run setup_test_environment first."), nil
+	}
+
+	script := GenerateK6WSTest(wsURL, message, expect, timeout, vus, duration, p95ThresholdMs, maxErrorRate)
+
+	// The stored duration lets run_performance_test run the script's own load
+	testId, err := t.deps.DB.Insert("INSERT INTO tests (session_id, name, type, script, scenario_duration) VALUES (?, ?, ?, ?, ?)",
+		sessionId, testName, TestTypeWebSocket, script, duration)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to store test: %v", err)), nil
+	}
+
+	return mcpgolang.NewToolResultText(fmt.Sprintf("Created WebSocket test '%s' with ID: %d\n\n- URL: %s\n- Load: %d VUs for %s\n- Response timeout: %s\n\nRun it with run_performance_test.",
+		testName, testId, wsURL, vus, duration, timeout)), nil
+}
+
+// GenerateK6WSTest returns a k6 script where each iteration opens a WebSocket
+// session, sends message once open, and checks that a response containing
+// expect (any response if empty) arrives within timeout. Sessions are tagged
+// with the URL so ws_session_duration is stored per endpoint.
+func GenerateK6WSTest(wsURL, message, expect string, timeout time.Duration, vus int, duration string, p95ThresholdMs, maxErrorRate float64) string {
+	jsString := func(s string) string {
+		quoted, _ := json.Marshal(s)
+		return string(quoted)
+	}
+
+	return fmt.Sprintf(`import ws from 'k6/ws';
+import { check } from 'k6';
+
+export const options = {
+  vus: %d,
+  duration: '%s',
+  thresholds: {
+    ws_connecting: ['p(95)<%g'],
+    checks: ['rate>%g'],
+  },
+};
+
+// Override the URL with envVars, e.g. WS_URL=wss://staging.example.com/ws
+const URL = __ENV.WS_URL || %s;
+const MESSAGE = %s;
+// A response must contain this to count; empty accepts any message
+const EXPECT = %s;
+const TIMEOUT_MS = %d;
+
+export default function () {
+  let received = false;
+
+  const res = ws.connect(URL, { tags: { name: URL } }, function (socket) {
+    socket.on('open', () => {
+      if (MESSAGE !== '') {
+        socket.send(MESSAGE);
+      }
+      socket.setTimeout(() => socket.close(), TIMEOUT_MS);
+    });
+
+    socket.on('message', (data) => {
+      if (EXPECT === '' || String(data).includes(EXPECT)) {
+        received = true;
+        socket.close();
+      }
+    });
+  });
+
+  check(res, { 'handshake status is 101': (r) => r && r.status === 101 });
+  check(received, { 'expected response within timeout': (r) => r === true });
+}`, vus, duration, p95ThresholdMs, 1-maxErrorRate,
+		jsString(wsURL), jsString(message), jsString(expect), timeout.Milliseconds())
+}
@@ -0,0 +1,204 @@
+package tools
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// k6 metric types, as declared on the Metric lines of the NDJSON output
+const (
+	MetricTypeCounter = "counter"
+	MetricTypeGauge   = "gauge"
+	MetricTypeRate    = "rate"
+	MetricTypeTrend   = "trend"
+)
+
+// k6BuiltinMetrics are the metrics k6 itself emits outside the prefixes in
+// k6BuiltinMetricPrefixes; everything else in a run's output was defined
+// by its script
+var k6BuiltinMetrics = map[string]bool{
+	"vus":                true,
+	"vus_max":            true,
+	"iterations":         true,
+	"iteration_duration": true,
+	"dropped_iterations": true,
+	"data_received":      true,
+	"data_sent":          true,
+	"checks":             true,
+	"group_duration":     true,
+}
+
+// k6BuiltinMetricPrefixes cover the protocol and browser metrics
+var k6BuiltinMetricPrefixes = []string{"http_", "ws_", "grpc_", "browser_"}
+
+// IsBuiltinMetric reports whether a metric is one of k6's own rather than
+// one a script defined with new Counter/Gauge/Rate/Trend
+func IsBuiltinMetric(name string) bool {
+	if k6BuiltinMetrics[name] {
+		return true
+	}
+	for _, prefix := range k6BuiltinMetricPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CustomMetric holds the samples of one script-defined metric
+type CustomMetric struct {
+	Name   string
+	Type   string
+	Values []float64
+	// Last is the latest sample, which is a gauge's value
+	Last     float64
+	lastTime time.Time
+}
+
+func (m *CustomMetric) add(value float64, at time.Time) {
+	m.Values = append(m.Values, value)
+	if m.lastTime.IsZero() || !at.Before(m.lastTime) {
+		m.Last = value
+		m.lastTime = at
+	}
+}
+
+// CustomMetricSummary is the machine-readable result for one custom metric.
+// Value is a counter's total, a rate's fraction of non-zero samples, a
+// gauge's last value or a trend's average; the other statistics are only
+// set for trends, and min and max for gauges too.
+type CustomMetricSummary struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Samples int      `json:"samples"`
+	Value   float64  `json:"value"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	P90     *float64 `json:"p90,omitempty"`
+	P95     *float64 `json:"p95,omitempty"`
+}
+
+// Summary reduces the samples to the statistics stored for the metric type
+func (m *CustomMetric) Summary() CustomMetricSummary {
+	summary := CustomMetricSummary{Name: m.Name, Type: m.Type, Samples: len(m.Values)}
+	// The percentile helpers work on any list of samples
+	samples := &EndpointMetrics{Durations: m.Values}
+	stat := func(p float64) *float64 {
+		value := samples.Percentile(p)
+		return &value
+	}
+	switch m.Type {
+	case MetricTypeCounter:
+		for _, v := range m.Values {
+			summary.Value += v
+		}
+	case MetricTypeRate:
+		nonZero := 0
+		for _, v := range m.Values {
+			if v != 0 {
+				nonZero++
+			}
+		}
+		if len(m.Values) > 0 {
+			summary.Value = float64(nonZero) / float64(len(m.Values))
+		}
+	case MetricTypeGauge:
+		summary.Value = m.Last
+		summary.Min, summary.Max = stat(0), stat(100)
+	default:
+		summary.Value = samples.Avg()
+		summary.Min, summary.Max = stat(0), stat(100)
+		summary.P90, summary.P95 = stat(90), stat(95)
+	}
+	return summary
+}
+
+// SummarizeCustomMetrics converts parsed custom metrics to summaries sorted
+// by name
+func SummarizeCustomMetrics(metrics map[string]*CustomMetric) []CustomMetricSummary {
+	summaries := []CustomMetricSummary{}
+	for _, m := range metrics {
+		if len(m.Values) == 0 {
+			continue
+		}
+		summaries = append(summaries, m.Summary())
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
+
+// StoreCustomMetrics stores one custom_metrics row per metric of a run
+func StoreCustomMetrics(db *DB, runId int64, summaries []CustomMetricSummary) error {
+	nullable := func(v *float64) sql.NullFloat64 {
+		if v == nil {
+			return sql.NullFloat64{}
+		}
+		return sql.NullFloat64{Float64: *v, Valid: true}
+	}
+	for _, m := range summaries {
+		_, err := db.Exec(`INSERT INTO custom_metrics (run_id, name, type, samples, value, min, max, p90, p95)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			runId, m.Name, m.Type, m.Samples, m.Value, nullable(m.Min), nullable(m.Max), nullable(m.P90), nullable(m.P95))
+		if err != nil {
+			return fmt.Errorf("failed to store custom metric %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// LoadCustomMetrics reads a run's stored custom metrics, sorted by name
+func LoadCustomMetrics(db *DB, runId int64) ([]CustomMetricSummary, error) {
+	rows, err := db.Query(`
+		SELECT name, type, samples, value, min, max, p90, p95
+		FROM custom_metrics
+		WHERE run_id = ?
+		ORDER BY name`, runId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pointer := func(v sql.NullFloat64) *float64 {
+		if !v.Valid {
+			return nil
+		}
+		return &v.Float64
+	}
+	summaries := []CustomMetricSummary{}
+	for rows.Next() {
+		var m CustomMetricSummary
+		var min, max, p90, p95 sql.NullFloat64
+		if err := rows.Scan(&m.Name, &m.Type, &m.Samples, &m.Value, &min, &max, &p90, &p95); err != nil {
+			return nil, err
+		}
+		m.Min, m.Max, m.P90, m.P95 = pointer(min), pointer(max), pointer(p90), pointer(p95)
+		summaries = append(summaries, m)
+	}
+	return summaries, rows.Err()
+}
+
+// CustomMetricsSection renders custom metrics as a markdown table
+func CustomMetricsSection(summaries []CustomMetricSummary) string {
+	format := func(v *float64) string {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f", *v)
+	}
+	table := "| Metric | Type | Samples | Value | Min | Max | p90 | p95 |\n" +
+		"|--------|------|---------|-------|-----|-----|-----|-----|\n"
+	for _, m := range summaries {
+		value := fmt.Sprintf("%.2f", m.Value)
+		if m.Type == MetricTypeRate {
+			value = fmt.Sprintf("%.2f%%", m.Value*100)
+		}
+		table += fmt.Sprintf("| %s | %s | %d | %s | %s | %s | %s | %s |\n",
+			m.Name, m.Type, m.Samples, value, format(m.Min), format(m.Max), format(m.P90), format(m.P95))
+	}
+	return table
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Database drivers for the test history store
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// DB is the test history database shared by the tools. Queries are written
+// once with ? placeholders in the SQL both SQLite and Postgres accept; DB
+// rebinds the placeholders for Postgres, and the helpers below cover the few
+// places where the dialects differ.
+type DB struct {
+	*sql.DB
+	Driver string
+}
+
+// OpenDB opens the database for driver, which is DriverSQLite or DriverPostgres
+func OpenDB(driver, dsn string) (*DB, error) {
+	switch driver {
+	case DriverSQLite, DriverPostgres:
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q: must be sqlite3 or postgres", driver)
+	}
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{DB: conn, Driver: driver}, nil
+}
+
+// IsPostgres reports whether the database is Postgres
+func (db *DB) IsPostgres() bool {
+	return db.Driver == DriverPostgres
+}
+
+// Exec runs a statement after rebinding its placeholders
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.Rebind(query), args...)
+}
+
+// Query runs a query after rebinding its placeholders
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.Rebind(query), args...)
+}
+
+// QueryRow runs a single-row query after rebinding its placeholders
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.Rebind(query), args...)
+}
+
+// Insert runs an INSERT and returns the new row's id. Postgres drivers don't
+// support LastInsertId, so there the id comes from RETURNING.
+func (db *DB) Insert(query string, args ...interface{}) (int64, error) {
+	if db.IsPostgres() {
+		var id int64
+		err := db.QueryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Rebind rewrites ? placeholders as $1, $2, ... for Postgres. Question marks
+// inside quoted strings and identifiers are left alone.
+func (db *DB) Rebind(query string) string {
+	if !db.IsPostgres() || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var rebound strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			rebound.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		rebound.WriteRune(r)
+	}
+	return rebound.String()
+}
+
+// DaysAgo returns an expression for the time a number of days before now,
+// with the number of days bound to a single ? placeholder
+func (db *DB) DaysAgo() string {
+	if db.IsPostgres() {
+		return "NOW() - CAST(? AS INTEGER) * INTERVAL '1 day'"
+	}
+	return "datetime('now', '-' || ? || ' days')"
+}
+
+// Schema adapts SQLite DDL to the database: Postgres gets BIGSERIAL keys,
+// BIGINT references and DOUBLE PRECISION for REAL columns
+func (db *DB) Schema(ddl string) string {
+	if !db.IsPostgres() {
+		return ddl
+	}
+	return strings.NewReplacer(
+		"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+		"INTEGER", "BIGINT",
+		"REAL", "DOUBLE PRECISION",
+	).Replace(ddl)
+}
@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTestDB returns a migrated SQLite database in the test's temp dir
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := OpenDB(DriverSQLite, filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return db
+}
+
+// mustInsert runs an INSERT and returns the new row's ID
+func mustInsert(t *testing.T, db *DB, query string, args ...interface{}) int64 {
+	t.Helper()
+	id, err := db.Insert(query, args...)
+	if err != nil {
+		t.Fatalf("insert failed: %v\n%s", err, query)
+	}
+	return id
+}
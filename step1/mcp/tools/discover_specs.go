@@ -2,11 +2,11 @@ package tools
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -28,13 +28,37 @@ func NewDiscoverSpecsTool(deps *SharedDependencies) *DiscoverSpecsTool {
 func (t *DiscoverSpecsTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
 	specPaths := request.GetString("specPaths", "")
 	autoDiscover := request.GetString("autoDiscover", "true") == "true"
+	probeTimeout := request.GetFloat("probeTimeoutSeconds", DefaultProbeTimeoutSeconds)
+	if probeTimeout <= 0 {
+		return mcpgolang.NewToolResultError("probeTimeoutSeconds must be greater than 0"), nil
+	}
+	headers, err := ParseHeaderList(request.GetString("discoveryHeaders", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid discoveryHeaders: %v", err)), nil
+	}
+	scheme := request.GetString("scheme", "auto")
+	if scheme != "auto" && scheme != "http" && scheme != "https" {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid scheme %q: must be auto, http or https", scheme)), nil
+	}
+	basePaths, err := ParseBasePaths(request.GetString("basePaths", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid basePaths: %v", err)), nil
+	}
+	candidates := SpecPathCandidates(request.GetString("specPathCandidates", ""),
+		request.GetString("replaceDefaultPaths", "false") == "true")
+	startupWait, err := StartupWait(request.GetString("startupWait", ""), DefaultStartupWait)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
 
-	// Get the most recent session
+	// Get the most recent session with an environment; run_url_test
+	// sessions have none
 	var sessionId int64
 	var composeFileId int64
-	err := t.deps.DB.QueryRow(`
+	err = t.deps.DB.QueryRow(`
 		SELECT id, compose_file_id 
 		FROM test_sessions 
+		WHERE compose_file_id IS NOT NULL
 		ORDER BY created_at DESC 
 		LIMIT 1`).Scan(&sessionId, &composeFileId)
 	if err != nil {
@@ -48,6 +72,11 @@ func (t *DiscoverSpecsTool) Handle(ctx context.Context, request mcpgolang.CallTo
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to get compose file: %v", err)), nil
 	}
 
+	profiles, err := SessionProfiles(t.deps.DB, sessionId)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to get session profiles: %v", err)), nil
+	}
+
 	// Write to temp location
 	composePath, err := WriteComposeToTemp(content, sessionId)
 	if err != nil {
@@ -57,9 +86,11 @@ func (t *DiscoverSpecsTool) Handle(ctx context.Context, request mcpgolang.CallTo
 
 	// Start containers temporarily for discovery
 	projectName := fmt.Sprintf("discover-%d", sessionId)
+	if err := PullImages(ctx, t.deps, composePath, projectName, profiles); err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to pull images: %v", err)), nil
+	}
 	containerStart := time.Now()
-	startCmd := exec.CommandContext(ctx, "docker", "compose", "-f", composePath, "-p", projectName, "up", "-d")
-	output, err := startCmd.CombinedOutput()
+	project, ctx, output, err := StartComposeProject(ctx, t.deps, composePath, projectName, profiles)
 	if err != nil {
 		t.deps.Logger.LogContainerOperation("start", projectName, time.Since(containerStart), err, map[string]interface{}{
 			"output":     string(output),
@@ -75,17 +106,23 @@ func (t *DiscoverSpecsTool) Handle(ctx context.Context, request mcpgolang.CallTo
 	// Ensure cleanup
 	defer func() {
 		stopStart := time.Now()
-		stopCmd := exec.Command("docker", "compose", "-f", composePath, "-p", projectName, "down", "-v")
-		err := stopCmd.Run()
+		err := project.Stop()
 		t.deps.Logger.LogContainerOperation("stop", projectName, time.Since(stopStart), err, map[string]interface{}{
 			"session_id": sessionId,
 		})
 	}()
 
 	// Wait for services to be ready
-	time.Sleep(10 * time.Second)
+	if err := WaitForStartup(ctx, startupWait); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if err := CheckServicesStarted(t.deps, project); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
 
 	discovered := []string{}
+	// Specs found by probing are attributed to the service that served them
+	specServices := map[string]int64{}
 
 	if specPaths != "" {
 		// Use provided paths
@@ -95,18 +132,21 @@ func (t *DiscoverSpecsTool) Handle(ctx context.Context, request mcpgolang.CallTo
 		}
 	}
 
+	// Redirects are followed; a hung service only costs one timeout per probe
+	client := &http.Client{
+		Timeout: time.Duration(probeTimeout * float64(time.Second)),
+		Transport: &http.Transport{
+			// Probes only target the local compose stack, whose HTTPS
+			// services typically use self-signed certificates
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	probed := []string{}
 	if autoDiscover {
-		// Try common OpenAPI paths
-		commonPaths := []string{
-			"/swagger.json",
-			"/openapi.json",
-			"/api-docs",
-			"/v2/api-docs",
-			"/v3/api-docs",
-			"/api/swagger.json",
-			"/api/openapi.json",
-			"/api/v3/openapi.json",
-		}
+		// Retries back off while services warm up, so bound the whole phase
+		probeCtx, cancel := context.WithTimeout(ctx, discoveryProbeBudget)
+		defer cancel()
 
 		// Get services from database
 		rows, err := t.deps.DB.Query("SELECT id, name, ports FROM services WHERE session_id = ?", sessionId)
@@ -116,39 +156,167 @@ func (t *DiscoverSpecsTool) Handle(ctx context.Context, request mcpgolang.CallTo
 		defer rows.Close()
 
 		for rows.Next() {
-			var id int
+			var id int64
 			var name, ports string
 			rows.Scan(&id, &name, &ports)
 
 			// Extract first port
 			portList := strings.Split(ports, ",")
-			if len(portList) > 0 && portList[0] != "" {
-				port := strings.Split(portList[0], ":")[0]
-				baseURL := fmt.Sprintf("http://localhost:%s", port)
-
-				for _, path := range commonPaths {
-					url := baseURL + path
-					// Actually try to fetch to see if it exists
-					resp, err := http.Get(url)
-					if err == nil && resp.StatusCode == 200 {
-						discovered = append(discovered, url)
-						resp.Body.Close()
-					}
-				}
+			if len(portList) == 0 || portList[0] == "" {
+				continue
+			}
+			port := PublishedPort(portList[0])
+
+			serviceScheme := scheme
+			if serviceScheme == "auto" {
+				serviceScheme = detectScheme(probeCtx, client, port, headers)
 			}
+			baseURL := fmt.Sprintf("%s://localhost:%s%s", serviceScheme, port, basePaths.For(name))
+
+			found, statuses := probeServiceSpecs(probeCtx, t.deps.Logger, client, name, baseURL, candidates, headers)
+			discovered = append(discovered, found...)
+			probed = append(probed, statuses...)
+			for _, spec := range found {
+				specServices[spec] = id
+			}
+		}
+
+		if probeCtx.Err() == context.DeadlineExceeded {
+			probed = append(probed, fmt.Sprintf("probing stopped after the %s discovery budget", discoveryProbeBudget))
 		}
 	}
 
 	result := fmt.Sprintf("Discovered %d API specifications:\n", len(discovered))
 	for i, spec := range discovered {
 		result += fmt.Sprintf("%d. %s\n", i+1, spec)
-		// Store in database with session
-		_, err := t.deps.DB.Exec("INSERT INTO api_specs (session_id, spec_url) VALUES (?, ?)", sessionId, spec)
+		// Store in database with session, along with the endpoints the spec
+		// declares, while the containers are still up to serve it
+		count, err := StoreDiscoveredSpec(ctx, t.deps.DB, client, sessionId, specServices[spec], spec, headers)
 		if err != nil {
-			log.Printf("Failed to store spec: %v", err)
+			log.Printf("Spec %s not fully stored: %v", spec, err)
+			continue
+		}
+		result += fmt.Sprintf("   %d endpoints\n", count)
+	}
+
+	if len(probed) > 0 {
+		result += fmt.Sprintf("\nProbed %d URLs:\n", len(probed))
+		for _, p := range probed {
+			result += fmt.Sprintf("- %s\n", p)
 		}
 	}
 
 	return mcpgolang.NewToolResultText(result + "\nContainers have been stopped."), nil
 }
 
+
+const (
+	// probeAttempts is how many times a probe is tried while a service is
+	// still starting up
+	probeAttempts = 3
+	// probeInitialBackoff doubles between attempts, up to probeMaxBackoff
+	probeInitialBackoff = 500 * time.Millisecond
+	probeMaxBackoff     = 4 * time.Second
+	// discoveryProbeBudget bounds the probing of all services, so one
+	// unreachable service can't stall discovery
+	discoveryProbeBudget = 2 * time.Minute
+)
+
+// probeServiceSpecs probes each candidate path under baseURL and returns the
+// URLs that answered 200 OK with an OpenAPI or Swagger document, plus a
+// status line per URL. Once the service has failed to answer at all,
+// its remaining paths are skipped. Rejected candidates are logged at debug.
+func probeServiceSpecs(ctx context.Context, logger Logger, client *http.Client, name, baseURL string, paths []string, headers http.Header) (found, probed []string) {
+	unreachable := false
+	for _, path := range paths {
+		url := baseURL + path
+		if unreachable {
+			probed = append(probed, fmt.Sprintf("%s (%s): skipped, service not reachable", url, name))
+			continue
+		}
+
+		status, reachable := probeSpecURL(ctx, client, url, headers)
+		unreachable = !reachable
+		if status == "200 OK" {
+			// Services answer unknown paths with login or error pages too
+			if _, _, err := FetchSpec(ctx, client, url, headers); err != nil {
+				status += ", " + err.Error()
+				logger.LogDebug("Rejected spec candidate", map[string]interface{}{
+					"url":     url,
+					"service": name,
+					"reason":  err.Error(),
+				})
+			} else {
+				found = append(found, url)
+			}
+		}
+		probed = append(probed, fmt.Sprintf("%s (%s): %s", url, name, status))
+	}
+	return found, probed
+}
+
+// probeSpecURL requests url with headers and returns the response status, or
+// the error if no response was received. Connection errors and gateway errors
+// are retried with exponential backoff, since services are often still warming
+// up; any other response, such as a 404, is final. reachable reports whether
+// the service answered at all.
+func probeSpecURL(ctx context.Context, client *http.Client, url string, headers http.Header) (status string, reachable bool) {
+	backoff := probeInitialBackoff
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		status, reachable, retry = probeOnce(ctx, client, url, headers)
+		if !retry || attempt == probeAttempts {
+			return status, reachable
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, reachable
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, probeMaxBackoff)
+	}
+}
+
+// probeOnce makes a single probe request and reports whether it is worth retrying
+func probeOnce(ctx context.Context, client *http.Client, url string, headers http.Header) (status string, reachable, retry bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err.Error(), false, false
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Retry refused or reset connections, but not once the budget is spent
+		return err.Error(), false, ctx.Err() == nil
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return resp.Status, true, true
+	}
+	return resp.Status, true, false
+}
+
+// detectScheme returns the scheme the service on port answers. https is tried
+// first because TLS servers still answer plain HTTP (with a 400), whereas an
+// HTTPS request to a plain HTTP server fails outright. Defaults to http.
+func detectScheme(ctx context.Context, client *http.Client, port string, headers http.Header) string {
+	for _, scheme := range []string{"https", "http"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://localhost:%s/", scheme, port), nil)
+		if err != nil {
+			continue
+		}
+		for key, values := range headers {
+			req.Header[key] = values
+		}
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+			return scheme
+		}
+	}
+	return "http"
+}
@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// MaxInlineExportBytes is the largest export returned in the result; bigger
+// ones are written to the results directory and only the path is returned
+const MaxInlineExportBytes = 64 * 1024
+
+// exportColumns are the CSV header, and the keys of JSON rows
+var exportColumns = []string{"timestamp", "session", "endpoint", "avg", "p95", "error_rate", "rps", "response_bytes"}
+
+// ExportHistoryTool handles the export_history tool
+type ExportHistoryTool struct {
+	deps *SharedDependencies
+}
+
+// NewExportHistoryTool creates a new instance of ExportHistoryTool
+func NewExportHistoryTool(deps *SharedDependencies) *ExportHistoryTool {
+	return &ExportHistoryTool{deps: deps}
+}
+
+// historyRow is one exported metrics row. Columns the run didn't record,
+// such as p95 before it was stored, are empty in CSV and null in JSON.
+type historyRow struct {
+	Timestamp string
+	Session   string
+	Endpoint  string
+	Avg       sql.NullFloat64
+	P95       sql.NullFloat64
+	ErrorRate sql.NullFloat64
+	RPS       sql.NullFloat64
+	// ResponseBytes is the data received per request
+	ResponseBytes sql.NullFloat64
+}
+
+// MarshalJSON writes the row with exportColumns as keys
+func (r historyRow) MarshalJSON() ([]byte, error) {
+	nullable := func(v sql.NullFloat64) *float64 {
+		if !v.Valid {
+			return nil
+		}
+		return &v.Float64
+	}
+	return json.Marshal(struct {
+		Timestamp     string   `json:"timestamp"`
+		Session       string   `json:"session"`
+		Endpoint      string   `json:"endpoint"`
+		Avg           *float64 `json:"avg"`
+		P95           *float64 `json:"p95"`
+		ErrorRate     *float64 `json:"error_rate"`
+		RPS           *float64 `json:"rps"`
+		ResponseBytes *float64 `json:"response_bytes"`
+	}{r.Timestamp, r.Session, r.Endpoint, nullable(r.Avg), nullable(r.P95), nullable(r.ErrorRate), nullable(r.RPS), nullable(r.ResponseBytes)})
+}
+
+// Handle processes the export_history request
+func (t *ExportHistoryTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	filter, err := historyFilterFromRequest(request)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	format := request.GetString("format", "csv")
+	if format != "csv" && format != "json" {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid format %q: must be csv or json", format)), nil
+	}
+
+	from, args := filter.From(t.deps.DB)
+	rows, err := t.deps.DB.Query(`
+		SELECT
+			tr.started_at,
+			COALESCE((
+				SELECT s.session_name
+				FROM tests te
+				JOIN test_sessions s ON te.session_id = s.id
+				WHERE te.id = tr.test_id), ''),
+			m.endpoint,
+			m.avg_response_time,
+			m.p95_response_time,
+			m.error_rate,
+			m.requests_per_second,
+			CASE WHEN m.requests > 0 THEN CAST(m.data_received AS REAL) / m.requests END`+from+`
+		ORDER BY tr.started_at DESC, m.id DESC`, args...)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Query failed: %v", err)), nil
+	}
+	history := []historyRow{}
+	for rows.Next() {
+		var r historyRow
+		if err := rows.Scan(&r.Timestamp, &r.Session, &r.Endpoint, &r.Avg, &r.P95, &r.ErrorRate, &r.RPS, &r.ResponseBytes); err != nil {
+			rows.Close()
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to read metrics: %v", err)), nil
+		}
+		history = append(history, r)
+	}
+	rows.Close()
+
+	var export []byte
+	if format == "csv" {
+		export, err = historyCSV(history)
+	} else {
+		export, err = json.MarshalIndent(history, "", "  ")
+	}
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to encode export: %v", err)), nil
+	}
+
+	if len(export) <= MaxInlineExportBytes {
+		return mcpgolang.NewToolResultText(string(export)), nil
+	}
+
+	resultsDir, err := ResultsDir()
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	path := filepath.Join(resultsDir, fmt.Sprintf("history-%s.%s", time.Now().Format("20060102-150405"), format))
+	if err := os.WriteFile(path, export, 0600); err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to write export: %v", err)), nil
+	}
+	t.deps.Logger.LogInfo("History exported to file", map[string]interface{}{
+		"path":  path,
+		"rows":  len(history),
+		"bytes": len(export),
+	})
+	return mcpgolang.NewToolResultText(fmt.Sprintf("Exported %d rows to %s (%d KB, too large to return inline)",
+		len(history), path, len(export)/1024)), nil
+}
+
+// historyCSV renders rows with a header of exportColumns
+func historyCSV(history []historyRow) ([]byte, error) {
+	cell := func(v sql.NullFloat64) string {
+		if !v.Valid {
+			return ""
+		}
+		return strconv.FormatFloat(v.Float64, 'f', -1, 64)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(exportColumns)
+	for _, r := range history {
+		w.Write([]string{r.Timestamp, r.Session, r.Endpoint, cell(r.Avg), cell(r.P95), cell(r.ErrorRate), cell(r.RPS), cell(r.ResponseBytes)})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
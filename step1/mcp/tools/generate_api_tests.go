@@ -2,7 +2,11 @@ package tools
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	mcpgolang "github.com/mark3labs/mcp-go/mcp"
@@ -20,42 +24,463 @@ func NewGenerateAPITestsTool(deps *SharedDependencies) *GenerateAPITestsTool {
 
 // Handle processes the generate_api_tests request
 func (t *GenerateAPITestsTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
-	specId, err := request.RequireString("specId")
-	if err != nil {
-		return mcpgolang.NewToolResultError("Missing required specId"), nil
+	specId := request.GetString("specId", "")
+	protocol := request.GetString("protocol", ProtocolHTTP)
+	switch protocol {
+	case ProtocolHTTP:
+		if specId == "" {
+			return mcpgolang.NewToolResultError("Missing required specId"), nil
+		}
+	case ProtocolGRPC:
+		// gRPC services have no discovered spec, so a session will do
+		if specId == "" && request.GetString("sessionId", "") == "" {
+			return mcpgolang.NewToolResultError("protocol=grpc requires specId or sessionId"), nil
+		}
+	default:
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid protocol %q: must be http or grpc", protocol)), nil
 	}
 
 	endpoints := request.GetString("endpoints", "")
 	testType := request.GetString("testType", "load")
+	dataFile := request.GetString("dataFile", "")
+	p95ThresholdMs := request.GetFloat("p95ThresholdMs", DefaultP95ThresholdMs)
+	maxErrorRate := request.GetFloat("maxErrorRate", DefaultMaxErrorRate)
+	if err := ValidateThresholds(p95ThresholdMs, maxErrorRate); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if !slices.Contains(TestTypes, testType) {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid testType %q: must be one of %s", testType, strings.Join(TestTypes, ", "))), nil
+	}
+	// maxVus, rampUp and hold name the stress stages and take precedence
+	// over their generic equivalents
+	scenario := ScenarioParams{
+		VUs:              int(request.GetFloat("vus", 0)),
+		Duration:         request.GetString("hold", request.GetString("duration", "")),
+		Target:           int(request.GetFloat("maxVus", request.GetFloat("target", 0))),
+		RampDuration:     request.GetString("rampUp", request.GetString("rampDuration", "")),
+		RampDownDuration: request.GetString("rampDown", ""),
+	}
+	if IsArrivalRate(testType) {
+		// Arrival-rate targets are rates, so maxVus caps the VUs instead, and
+		// each iteration is assumed to take the p95 threshold per request
+		requests := max(len(ParseEndpointSpecs(endpoints)), 1)
+		if protocol == ProtocolGRPC {
+			requests = 1
+		}
+		scenario.VUs = int(request.GetFloat("preAllocatedVus", float64(scenario.VUs)))
+		scenario.Target = int(request.GetFloat("target", 0))
+		scenario.MaxVUs = int(request.GetFloat("maxVus", 0))
+		scenario.IterationTime = time.Duration(p95ThresholdMs*float64(requests)) * time.Millisecond
+	}
+	for _, d := range []string{scenario.Duration, scenario.RampDuration, scenario.RampDownDuration} {
+		if d == "" {
+			continue
+		}
+		if err := ValidateDuration(d); err != nil {
+			return mcpgolang.NewToolResultError(err.Error()), nil
+		}
+	}
+	if scenario.VUs < 0 {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("vus must be at least 1, got %d", scenario.VUs)), nil
+	}
+	if scenario.MaxVUs < 0 {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("maxVus must be at least 1, got %d", scenario.MaxVUs)), nil
+	}
+	// The limit applies to the whole scenario, e.g. a stress test's peak
+	if err := CheckVULimit("Peak VUs", scenario.PeakVUs(testType)); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if sized := scenario.WithDefaults(testType); IsArrivalRate(testType) && sized.MaxVUs < sized.VUs {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("maxVus (%d) must be at least the pre-allocated VUs (%d)", sized.MaxVUs, sized.VUs)), nil
+	}
+
+	// The scheme only sets the default BASE_URL; BASE_URL in envVars still
+	// overrides it at run time
+	tlsOptions := NewTLSOptions(request.GetString("insecureSkipTLSVerify", "false"), request.GetString("http2", "false"))
+	scheme := request.GetString("scheme", tlsOptions.DefaultScheme())
+	if scheme != "http" && scheme != "https" {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid scheme %q: must be http or https", scheme)), nil
+	}
+	if err := tlsOptions.CheckScheme("BASE_URL", scheme); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	// Behind a shared ingress, requests name their virtual host and carry
+	// the path prefix it mounts the service under
+	virtualHost, err := ParseVirtualHost(request.GetString("hostHeader", ""), request.GetString("basePath", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	setup, err := NewSetupRequest(request.GetString("setupRequest", ""), request.GetString("setupBody", ""), request.GetString("tokenJsonPath", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	validateSchema := request.GetString("validateSchema", "false") == "true"
+	if validateSchema && specId == "" {
+		return mcpgolang.NewToolResultError("validateSchema requires specId"), nil
+	}
+
+	var grpcParams GRPCTestParams
+	if protocol == ProtocolGRPC {
+		if dataFile != "" {
+			return mcpgolang.NewToolResultError("dataFile is only supported for http tests"), nil
+		}
+		if setup != nil {
+			return mcpgolang.NewToolResultError("setupRequest is only supported for http tests"), nil
+		}
+		if validateSchema {
+			return mcpgolang.NewToolResultError("validateSchema is only supported for http tests"), nil
+		}
+		if tlsOptions.Set() || request.GetString("scheme", "") != "" {
+			return mcpgolang.NewToolResultError("scheme, insecureSkipTLSVerify and http2 are only supported for http tests"), nil
+		}
+		if virtualHost.Set() {
+			return mcpgolang.NewToolResultError("hostHeader and basePath are only supported for http tests"), nil
+		}
+		params, err := NewGRPCTestParams(request.GetString("protoPath", ""), request.GetString("grpcMethod", ""),
+			request.GetString("grpcTarget", ""), request.GetString("grpcPayload", ""))
+		if err != nil {
+			return mcpgolang.NewToolResultError(err.Error()), nil
+		}
+		grpcParams = params
+	}
 
 	// Get session ID from spec
 	var sessionId int64
-	err = t.deps.DB.QueryRow("SELECT session_id FROM api_specs WHERE id = ?", specId).Scan(&sessionId)
-	if err != nil {
-		return mcpgolang.NewToolResultError(fmt.Sprintf("Spec not found: %v", err)), nil
+	if specId != "" {
+		err := t.deps.DB.QueryRow("SELECT session_id FROM api_specs WHERE id = ?", specId).Scan(&sessionId)
+		if err != nil {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Spec not found: %v", err)), nil
+		}
+	} else {
+		err := t.deps.DB.QueryRow("SELECT id FROM test_sessions WHERE id = ?", request.GetString("sessionId", "")).Scan(&sessionId)
+		if err != nil {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Session not found: %v", err)), nil
+		}
+	}
+
+	// Load CSV rows for data-driven requests
+	var testData interface{}
+	if dataFile != "" {
+		content, err := LoadTestDataCSV(dataFile)
+		if err != nil {
+			return mcpgolang.NewToolResultError(err.Error()), nil
+		}
+		testData = content
+	}
+
+	// Response schemas come from the stored spec document
+	var schemas map[string]*ResponseSchema
+	schemaChecks := ""
+	if validateSchema {
+		schemas, err = t.responseSchemas(specId)
+		if err != nil {
+			return mcpgolang.NewToolResultError(err.Error()), nil
+		}
+		targets := apiTestTargets(endpoints)
+		checked := 0
+		for _, target := range targets {
+			if schemas[target.Method+" "+target.Path] != nil {
+				checked++
+			}
+		}
+		schemaChecks = fmt.Sprintf("\nResponse schema checks: %d of %d endpoints\n", checked, len(targets))
+	}
+
+	// SLAs declared in the spec replace the defaults for their endpoints
+	var slas map[string]EndpointSLA
+	slaThresholds := ""
+	if specId != "" && protocol == ProtocolHTTP {
+		slas, err = t.endpointSLAs(specId)
+		if err != nil {
+			return mcpgolang.NewToolResultError(err.Error()), nil
+		}
+		if len(slas) > 0 {
+			targets := apiTestTargets(endpoints)
+			slaThresholds = fmt.Sprintf("\nSLA thresholds: %d of %d endpoints\n", slaCoverage(targets, slas), len(targets))
+		}
 	}
 
 	// Generate k6 test script
-	script := t.generateK6APITest(specId, endpoints, testType)
+	name := "api-test"
+	script := ""
+	if protocol == ProtocolGRPC {
+		name = "grpc-test"
+		script = GenerateK6GRPCTest(testType, scenario, p95ThresholdMs, maxErrorRate, grpcParams)
+	} else {
+		script = t.generateK6APITest(specId, endpoints, testType, scenario, p95ThresholdMs, maxErrorRate, testData != nil, setup, schemas, slas, LocalBaseURL(scheme, "8080"), tlsOptions, virtualHost)
+	}
+
+	// The setup request is part of the script; its config is also kept on
+	// the test so it can be seen without reading the script
+	var setupConfig interface{}
+	if setup != nil {
+		setupConfig = setup.Config()
+	}
 
-	// Store test with session
-	result, err := t.deps.DB.Exec("INSERT INTO tests (session_id, name, type, script) VALUES (?, ?, ?, ?)",
-		sessionId, fmt.Sprintf("api-test-%s", time.Now().Format("20060102-150405")), testType, script)
+	// Store test with session; the CSV is kept with the test so re-runs are
+	// reproducible, and the scenario length bounds how long a run may take
+	testId, err := t.deps.DB.Insert("INSERT INTO tests (session_id, name, type, script, test_data, scenario_duration, setup_config) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		sessionId, fmt.Sprintf("%s-%s", name, time.Now().Format("20060102-150405")), testType, script, testData,
+		scenario.TotalDuration(testType).String(), setupConfig)
 	if err != nil {
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to store test: %v", err)), nil
 	}
 
-	testId, _ := result.LastInsertId()
+	sizing := ""
+	if sized := scenario.WithDefaults(testType); IsArrivalRate(testType) {
+		sizing = fmt.Sprintf("\nVUs: %d pre-allocated, up to %d for %d iterations/s at an assumed %s per iteration\n",
+			sized.VUs, sized.MaxVUs, sized.Target, sized.IterationTime)
+	}
+	if protocol != ProtocolGRPC {
+		if warning := HighLoadWarning(scenario.PeakVUs(testType), len(apiTestTargets(endpoints))); warning != "" {
+			sizing += "\n" + warning + "\n"
+		}
+	}
 
-	return mcpgolang.NewToolResultText(fmt.Sprintf("Generated %s test with ID: %d\n\nScript preview:\n%s...",
-		testType, testId, script[:200])), nil
+	if virtualHost.HostHeader != "" {
+		sizing += fmt.Sprintf("\nHost header: %s\n", virtualHost.HostHeader)
+	}
+	if virtualHost.BasePath != "" {
+		sizing += fmt.Sprintf("\nBase path: %s, appended to BASE_URL\n", virtualHost.BasePath)
+	}
+
+	return mcpgolang.NewToolResultText(fmt.Sprintf("Generated %s test with ID: %d\n%s%s%s\nScript preview:\n%s...",
+		testType, testId, sizing, schemaChecks, slaThresholds, script[:200])), nil
 }
 
-func (t *GenerateAPITestsTool) generateK6APITest(specId, endpoints, testType string) string {
-	// Simplified test generation
-	return fmt.Sprintf(`import http from 'k6/http';
-import { check } from 'k6';
+// responseSchemas reads the response schemas from a spec's stored document
+func (t *GenerateAPITestsTool) responseSchemas(specId string) (map[string]*ResponseSchema, error) {
+	var specURL, content sql.NullString
+	if err := t.deps.DB.QueryRow("SELECT spec_url, spec_content FROM api_specs WHERE id = ?", specId).Scan(&specURL, &content); err != nil {
+		return nil, fmt.Errorf("Spec not found: %v", err)
+	}
+	if !content.Valid || content.String == "" {
+		return nil, fmt.Errorf("Spec %s has no stored document to read response schemas from; run discover_specs again", specId)
+	}
+	doc := []byte(content.String)
+	return ParseResponseSchemas(doc, SpecFormat("", specURL.String, doc))
+}
+
+// EndpointSLA is the budget an endpoint declares in its spec; either part
+// may be unset, leaving the test's default in place
+type EndpointSLA struct {
+	ResponseTimeMs sql.NullInt64
+	ErrorRate      sql.NullFloat64
+}
+
+// endpointSLAs returns the SLAs of a spec's endpoints, keyed by method and
+// path like response schemas; endpoints without one are left out
+func (t *GenerateAPITestsTool) endpointSLAs(specId string) (map[string]EndpointSLA, error) {
+	rows, err := t.deps.DB.Query(`
+		SELECT method, path, sla_response_time, sla_error_rate
+		FROM endpoints
+		WHERE spec_id = ? AND (sla_response_time IS NOT NULL OR sla_error_rate IS NOT NULL)`, specId)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load endpoint SLAs: %v", err)
+	}
+	defer rows.Close()
+	return scanEndpointSLAs(rows)
+}
+
+// SessionEndpointSLAs returns the SLAs declared in a session's discovered
+// specs, keyed like endpointSLAs. A non-empty service limits them to that
+// service's specs. When specs disagree, the most recently discovered wins.
+func SessionEndpointSLAs(db *DB, sessionId int64, service string) (map[string]EndpointSLA, error) {
+	query := `
+		SELECT e.method, e.path, e.sla_response_time, e.sla_error_rate
+		FROM endpoints e
+		JOIN api_specs a ON e.spec_id = a.id
+		LEFT JOIN services s ON a.service_id = s.id
+		WHERE a.session_id = ? AND (e.sla_response_time IS NOT NULL OR e.sla_error_rate IS NOT NULL)`
+	args := []interface{}{sessionId}
+	if service != "" {
+		query += " AND s.name = ?"
+		args = append(args, service)
+	}
+	query += " ORDER BY a.id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load endpoint SLAs: %v", err)
+	}
+	defer rows.Close()
+	return scanEndpointSLAs(rows)
+}
+
+// scanEndpointSLAs reads method, path and SLA rows; later rows replace
+// earlier ones for the same endpoint
+func scanEndpointSLAs(rows *sql.Rows) (map[string]EndpointSLA, error) {
+	slas := map[string]EndpointSLA{}
+	for rows.Next() {
+		var method, path string
+		var sla EndpointSLA
+		if err := rows.Scan(&method, &path, &sla.ResponseTimeMs, &sla.ErrorRate); err != nil {
+			return nil, fmt.Errorf("Failed to read endpoint SLAs: %v", err)
+		}
+		slas[method+" "+path] = sla
+	}
+	return slas, rows.Err()
+}
+
+// slaCoverage counts the targets that have an SLA
+func slaCoverage(targets []EndpointSpec, slas map[string]EndpointSLA) int {
+	covered := 0
+	for _, target := range targets {
+		if _, ok := slas[target.Method+" "+target.Path]; ok {
+			covered++
+		}
+	}
+	return covered
+}
+
+// withEndpointThresholds adds thresholds for each target with an SLA to a
+// thresholds block, selecting its requests by the name and method tags, and
+// by the service tag when service is set. k6 then fails the run itself,
+// exiting with K6ThresholdsFailedExitCode, when an endpoint misses its SLA.
+// Aborting blocks get aborting endpoint thresholds too.
+func withEndpointThresholds(thresholds string, aborting bool, targets []EndpointSpec, slas map[string]EndpointSLA, service string) string {
+	serviceTag := ""
+	if service != "" {
+		serviceTag = ",service:" + service
+	}
+	threshold := func(metric string, target EndpointSpec, expr string) string {
+		if aborting {
+			expr = fmt.Sprintf("{ threshold: '%s', abortOnFail: true, delayAbortEval: '10s' }", expr)
+		} else {
+			expr = "'" + expr + "'"
+		}
+		return fmt.Sprintf("    '%s{name:%s,method:%s%s}': [%s],\n", metric, target.Path, target.Method, serviceTag, expr)
+	}
+
+	var lines strings.Builder
+	for _, target := range targets {
+		sla, ok := slas[target.Method+" "+target.Path]
+		if !ok {
+			continue
+		}
+		if sla.ResponseTimeMs.Valid {
+			lines.WriteString(threshold("http_req_duration", target, fmt.Sprintf("p(95)<%d", sla.ResponseTimeMs.Int64)))
+		}
+		if sla.ErrorRate.Valid {
+			lines.WriteString(threshold("http_req_failed", target, fmt.Sprintf("rate<%g", sla.ErrorRate.Float64)))
+		}
+	}
+	if lines.Len() == 0 {
+		return thresholds
+	}
+	return strings.TrimSuffix(thresholds, "  },") + lines.String() + "  },"
+}
+
+// apiTestTargets returns the requests a generated test makes
+func apiTestTargets(endpoints string) []EndpointSpec {
+	targets := ParseEndpointSpecs(endpoints)
+	if len(targets) == 0 {
+		targets = []EndpointSpec{{Method: "GET", Path: "/api/endpoint"}}
+	}
+	return targets
+}
+
+func (t *GenerateAPITestsTool) generateK6APITest(specId, endpoints, testType string, scenario ScenarioParams, p95ThresholdMs, maxErrorRate float64, hasData bool, setup *SetupRequest, schemas map[string]*ResponseSchema, slas map[string]EndpointSLA, baseURL string, tlsOptions TLSOptions, virtualHost VirtualHost) string {
+	targets := apiTestTargets(endpoints)
+
+	// Endpoints with a response schema carry it for the schema check, and
+	// when the spec declares SLAs each carries its response time budget
+	var targetList strings.Builder
+	for _, target := range targets {
+		extra := ""
+		if len(slas) > 0 {
+			maxMs := p95ThresholdMs
+			if sla := slas[target.Method+" "+target.Path]; sla.ResponseTimeMs.Valid {
+				maxMs = float64(sla.ResponseTimeMs.Int64)
+			}
+			extra = fmt.Sprintf(", maxMs: %g", maxMs)
+		}
+		if s := schemas[target.Method+" "+target.Path]; s != nil {
+			encoded, _ := json.Marshal(s)
+			extra += ", schema: " + string(encoded)
+		}
+		targetList.WriteString(fmt.Sprintf("  { method: '%s', path: '%s'%s },\n", target.Method, target.Path, extra))
+	}
+
+	extraChecks := ""
+	validator := ""
+	if len(slas) > 0 {
+		extraChecks = "\n      ['response time < ' + ep.maxMs + 'ms']: (r) => r.timings.duration < ep.maxMs,"
+	}
+	if schemas != nil {
+		extraChecks += "\n      'body matches schema': (r) => bodyMatchesSchema(r, ep.schema),"
+		validator = ResponseSchemaValidator
+	}
+
+	imports := ""
+	dataLoader := ""
+	requestBlock := `  endpoints.forEach((ep) => {
+    const res = http.request(ep.method, BASE_URL + ep.path, null, { headers: authHeaders(setupData), tags: { name: ep.path } });
+    check(res, {
+      'status is 2xx': (r) => r.status >= 200 && r.status < 300,` + extraChecks + `
+    });
+  });`
+
+	if hasData {
+		imports = `import { SharedArray } from 'k6/data';
+import papaparse from 'https://jslib.k6.io/papaparse/5.1.1/index.js';
+`
+		dataLoader = `
+// Rows from the CSV stored with this test, written next to the script at run time
+const data = new SharedArray('test data', function () {
+  return papaparse.parse(open('./` + TestDataFileName + `'), { header: true, skipEmptyLines: true }).data;
+});
+`
+		// {column} placeholders in the path or query string take the row's value;
+		// remaining columns form the JSON body for methods that send one
+		requestBlock = `  const row = data[Math.floor(Math.random() * data.length)];
 
+  endpoints.forEach((ep) => {
+    const used = new Set();
+    const path = ep.path.replace(/\{(\w+)\}/g, (match, key) => {
+      if (!(key in row)) {
+        return match;
+      }
+      used.add(key);
+      return encodeURIComponent(row[key]);
+    });
+
+    // Tag with the path template so substituted values don't split the metrics
+    let body = null;
+    const params = { headers: authHeaders(setupData), tags: { name: ep.path } };
+    if (ep.method !== 'GET' && ep.method !== 'DELETE' && ep.method !== 'HEAD') {
+      const payload = {};
+      Object.keys(row).filter((key) => !used.has(key)).forEach((key) => {
+        payload[key] = row[key];
+      });
+      body = JSON.stringify(payload);
+      params.headers['Content-Type'] = 'application/json';
+    }
+
+    const res = http.request(ep.method, BASE_URL + path, body, params);
+    check(res, {
+      'status is 2xx': (r) => r.status >= 200 && r.status < 300,` + extraChecks + `
+    });
+  });`
+	}
+
+	setupFunction := ""
+	if setup != nil {
+		setupFunction = setup.SetupFunction()
+	}
+
+	thresholds := GenerateThresholds(p95ThresholdMs, maxErrorRate)
+	if testType == "breakpoint" {
+		thresholds = GenerateAbortingThresholds(p95ThresholdMs, maxErrorRate)
+	}
+	thresholds = tlsOptions.Apply(withEndpointThresholds(thresholds, testType == "breakpoint", targets, slas, ""))
+
+	return fmt.Sprintf(`import http from 'k6/http';
+import { check, fail } from 'k6';
+%s
 export const options = {
   scenarios: {
     %s_test: {
@@ -63,15 +488,33 @@ export const options = {
       %s
     },
   },
+  %s
 };
 
-export default function () {
-  // Generated from spec %s
-  // Testing endpoints: %s
-  const res = http.get('http://localhost:8080/api/endpoint');
-  check(res, {
-    'status is 200': (r) => r.status === 200,
-  });
-}`, testType, GetExecutorType(testType), GetScenarioConfig(testType), specId, endpoints)
+// Pass secrets and config with the run tools' envVars, e.g. API_TOKEN=...,
+// rather than editing them into the stored script
+const BASE_URL = %s;
+const TOKEN = __ENV.API_TOKEN;
+
+// Sent with every request, such as the Host a shared ingress routes by
+const HEADERS = %s;
+
+// A token from the setup request, when there is one, takes precedence
+function authHeaders(setupData) {
+  const headers = Object.assign({}, HEADERS);
+  const token = (setupData && setupData.token) || TOKEN;
+  if (token) {
+    headers.Authorization = 'Bearer ' + token;
+  }
+  return headers;
 }
 
+const endpoints = [
+%s];
+%s%s%s
+export default function (setupData) {
+  // Generated from spec %s
+%s
+}`, imports, testType, GetExecutorType(testType), GetScenarioConfig(testType, scenario),
+		thresholds, virtualHost.BaseURLJS(baseURL), virtualHost.HeadersJS(), targetList.String(), validator, dataLoader, setupFunction, specId, requestBlock)
+}
@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Protocols generate_api_tests can generate scripts for
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
+// DefaultGRPCTarget is the address gRPC scripts connect to unless grpcTarget
+// or GRPC_TARGET says otherwise
+const DefaultGRPCTarget = "localhost:50051"
+
+// GRPCTestParams describes the single method a gRPC test invokes
+type GRPCTestParams struct {
+	// ProtoPath is the absolute path of the .proto file defining the method
+	ProtoPath string
+	// Method is the fully qualified method, e.g. "helloworld.Greeter/SayHello"
+	Method string
+	// Target is the host:port to connect to
+	Target string
+	// Payload is the request message as JSON
+	Payload string
+}
+
+// NewGRPCTestParams validates the gRPC parameters: the proto file must exist,
+// the method must be Service/Method and the payload a JSON object
+func NewGRPCTestParams(protoPath, method, target, payload string) (GRPCTestParams, error) {
+	if protoPath == "" {
+		return GRPCTestParams{}, fmt.Errorf("protoPath is required when protocol is grpc")
+	}
+	absProto, err := filepath.Abs(protoPath)
+	if err != nil {
+		return GRPCTestParams{}, fmt.Errorf("invalid protoPath: %w", err)
+	}
+	if info, err := os.Stat(absProto); err != nil || info.IsDir() {
+		return GRPCTestParams{}, fmt.Errorf("proto file %s not found", absProto)
+	}
+
+	method = strings.TrimPrefix(method, "/")
+	service, name, ok := strings.Cut(method, "/")
+	if !ok || service == "" || name == "" || strings.Contains(name, "/") {
+		return GRPCTestParams{}, fmt.Errorf("grpcMethod %q must be package.Service/Method", method)
+	}
+
+	if target == "" {
+		target = DefaultGRPCTarget
+	}
+
+	if payload == "" {
+		payload = "{}"
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		return GRPCTestParams{}, fmt.Errorf("grpcPayload must be a JSON object: %w", err)
+	}
+	compact, _ := json.Marshal(message)
+
+	return GRPCTestParams{
+		ProtoPath: absProto,
+		Method:    method,
+		Target:    target,
+		Payload:   string(compact),
+	}, nil
+}
+
+// GenerateGRPCThresholds returns a k6 thresholds block for gRPC scripts.
+// gRPC has no failed-request metric, so the error budget applies to checks.
+func GenerateGRPCThresholds(p95ThresholdMs, maxErrorRate float64, abortOnFail bool) string {
+	if abortOnFail {
+		return fmt.Sprintf(`thresholds: {
+    grpc_req_duration: [{ threshold: 'p(95)<%g', abortOnFail: true, delayAbortEval: '10s' }],
+    checks: [{ threshold: 'rate>%g', abortOnFail: true, delayAbortEval: '10s' }],
+  },`, p95ThresholdMs, 1-maxErrorRate)
+	}
+	return fmt.Sprintf(`thresholds: {
+    grpc_req_duration: ['p(95)<%g'],
+    checks: ['rate>%g'],
+  },`, p95ThresholdMs, 1-maxErrorRate)
+}
+
+// GenerateK6GRPCTest returns a k6 script that loads the proto file and
+// invokes one method with a fixed payload under the test type's scenario
+func GenerateK6GRPCTest(testType string, scenario ScenarioParams, p95ThresholdMs, maxErrorRate float64, g GRPCTestParams) string {
+	jsString := func(s string) string {
+		quoted, _ := json.Marshal(s)
+		return string(quoted)
+	}
+
+	return fmt.Sprintf(`import grpc from 'k6/net/grpc';
+import { check } from 'k6';
+
+export const options = {
+  scenarios: {
+    %s_test: {
+      executor: '%s',
+      %s
+    },
+  },
+  %s
+};
+
+// Override with envVars, e.g. GRPC_TARGET=api:50051 GRPC_TLS=true
+const TARGET = __ENV.GRPC_TARGET || %s;
+const METHOD = %s;
+const PAYLOAD = %s;
+
+const client = new grpc.Client();
+client.load([%s], %s);
+
+export default function () {
+  // Connections can only be opened from VU code, so connect once per VU
+  if (__ITER === 0) {
+    client.connect(TARGET, { plaintext: __ENV.GRPC_TLS !== 'true' });
+  }
+
+  const res = client.invoke(METHOD, PAYLOAD, { tags: { name: METHOD } });
+  check(res, {
+    'status is OK': (r) => r && r.status === grpc.StatusOK,
+  });
+}`, testType, GetExecutorType(testType), GetScenarioConfig(testType, scenario),
+		GenerateGRPCThresholds(p95ThresholdMs, maxErrorRate, testType == "breakpoint"),
+		jsString(g.Target), jsString(g.Method), g.Payload,
+		jsString(filepath.Dir(g.ProtoPath)), jsString(filepath.Base(g.ProtoPath)))
+}
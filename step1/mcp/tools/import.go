@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestTypeCustom is the default stored type of imported tests
+const TestTypeCustom = "custom"
+
+// ImportTestTypes are the types an imported test can be stored as. Browser
+// tests get screenshots collected when they run.
+var ImportTestTypes = append(slices.Clone(TestTypes), TestTypeBrowser, TestTypeWebSocket, TestTypeCustom)
+
+// ImportTestTool handles the import_test tool
+type ImportTestTool struct {
+	deps *SharedDependencies
+}
+
+// NewImportTestTool creates a new instance of ImportTestTool
+func NewImportTestTool(deps *SharedDependencies) *ImportTestTool {
+	return &ImportTestTool{deps: deps}
+}
+
+// Handle processes the import_test request
+func (t *ImportTestTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	script, err := request.RequireString("script")
+	if err != nil {
+		return mcpgolang.NewToolResultError("Missing required script"), nil
+	}
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcpgolang.NewToolResultError("Missing required name"), nil
+	}
+	testType := request.GetString("type", TestTypeCustom)
+	if !slices.Contains(ImportTestTypes, testType) {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid type %q: must be one of %s", testType, strings.Join(ImportTestTypes, ", "))), nil
+	}
+
+	// A single line naming an existing file is a path to the script
+	source := "inline script"
+	if !strings.Contains(script, "\n") {
+		if info, err := os.Stat(script); err == nil && info.Mode().IsRegular() {
+			content, err := os.ReadFile(script)
+			if err != nil {
+				return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to read %s: %v", script, err)), nil
+			}
+			source = script
+			script = string(content)
+		}
+	}
+
+	// Use the given session, else the most recent one
+	var sessionId int64
+	if id := request.GetString("sessionId", ""); id != "" {
+		err = t.deps.DB.QueryRow("SELECT id FROM test_sessions WHERE id = ?", id).Scan(&sessionId)
+	} else {
+		err = t.deps.DB.QueryRow("SELECT id FROM test_sessions ORDER BY started_at DESC, id DESC LIMIT 1").Scan(&sessionId)
+	}
+	if err != nil {
+		return mcpgolang.NewToolResultError("No active session. Run setup_test_environment first."), nil
+	}
+
+	inspection, err := InspectK6Script(ctx, script, "")
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if !inspection.Valid {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Script is not valid k6, so it was not imported:\n\n%s", inspection.Problem)), nil
+	}
+
+	// The stored duration lets run_performance_test run the script's own load
+	scenarioDuration := sql.NullString{String: inspection.TotalDuration, Valid: inspection.TotalDuration != ""}
+	testId, err := t.deps.DB.Insert("INSERT INTO tests (session_id, name, type, script, scenario_duration) VALUES (?, ?, ?, ?, ?)",
+		sessionId, name, testType, script, scenarioDuration)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to store test: %v", err)), nil
+	}
+
+	t.deps.Logger.LogInfo("Test imported", map[string]interface{}{
+		"test_id":    testId,
+		"session_id": sessionId,
+		"type":       testType,
+		"source":     source,
+	})
+
+	load := "k6 did not report how long the script runs, so run_performance_test uses 10 VUs for 30s unless given vus and duration"
+	if scenarioDuration.Valid {
+		load = fmt.Sprintf("The script's own load runs for up to %s", inspection.TotalDuration)
+	}
+	return mcpgolang.NewToolResultText(fmt.Sprintf("Imported %s test '%s' from %s with ID: %d in session %d\n\n%s. Run it with run_performance_test.",
+		testType, name, source, testId, sessionId, load)), nil
+}
@@ -0,0 +1,436 @@
+package tools
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// K6ThresholdsFailedExitCode is the exit code k6 uses when thresholds are crossed
+const K6ThresholdsFailedExitCode = 99
+
+// K6ThresholdsCrossed reports whether err is k6 exiting because thresholds
+// were crossed, in which case the run itself completed
+func K6ThresholdsCrossed(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == K6ThresholdsFailedExitCode
+}
+
+// K6ExitCode returns the exit code of a k6 run from the error it returned:
+// 0 when it succeeded, and invalid when k6 didn't exit on its own, e.g. it
+// couldn't be started or was killed at the timeout
+func K6ExitCode(err error) sql.NullInt64 {
+	if err == nil {
+		return sql.NullInt64{Int64: 0, Valid: true}
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return sql.NullInt64{Int64: int64(exitErr.ExitCode()), Valid: true}
+	}
+	return sql.NullInt64{}
+}
+
+// K6ExitStatus describes a stored exit code, telling a run that crossed its
+// thresholds apart from one where k6 itself failed
+func K6ExitStatus(code sql.NullInt64) string {
+	switch {
+	case !code.Valid:
+		return "unknown"
+	case code.Int64 == 0:
+		return "passed"
+	case code.Int64 == K6ThresholdsFailedExitCode:
+		return "thresholds crossed"
+	default:
+		return "errored"
+	}
+}
+
+// K6SummaryTrendStats are the trend statistics requested from k6 for the
+// end-of-test summary; k6 omits p(99) by default
+const K6SummaryTrendStats = "avg,min,med,max,p(90),p(95),p(99)"
+
+// K6ResultsPath returns where a run's NDJSON metrics stream is written
+func K6ResultsPath(resultsDir string, runId int64) string {
+	return filepath.Join(resultsDir, fmt.Sprintf("k6-results-%d.json", runId))
+}
+
+// K6CSVPath returns where a run's CSV output is written when it is asked for
+func K6CSVPath(resultsDir string, runId int64) string {
+	return filepath.Join(resultsDir, fmt.Sprintf("k6-results-%d.csv", runId))
+}
+
+// K6SummaryPath returns where a run's end-of-test summary is exported
+func K6SummaryPath(resultsDir string, runId int64) string {
+	return filepath.Join(resultsDir, fmt.Sprintf("k6-summary-%d.json", runId))
+}
+
+// K6Sample represents a single line of k6's NDJSON (--out json) output:
+// a Point sample, or the Metric line declaring a metric's type
+type K6Sample struct {
+	Type   string `json:"type"`
+	Metric string `json:"metric"`
+	Data   struct {
+		Time  time.Time         `json:"time"`
+		Value float64           `json:"value"`
+		Tags  map[string]string `json:"tags"`
+		// MetricType is set on Metric lines: counter, gauge, rate or trend
+		MetricType string `json:"type"`
+	} `json:"data"`
+}
+
+// EndpointMetrics holds aggregated HTTP request metrics for one group of samples
+type EndpointMetrics struct {
+	Name      string
+	Durations []float64
+	Checked   int
+	Failed    int
+	First     time.Time
+	Last      time.Time
+	// DataSent and DataReceived are the bytes k6 counted for the group
+	DataSent     float64
+	DataReceived float64
+}
+
+// Requests returns the number of requests observed
+func (m *EndpointMetrics) Requests() int {
+	return len(m.Durations)
+}
+
+// Avg returns the mean request duration in milliseconds
+func (m *EndpointMetrics) Avg() float64 {
+	if len(m.Durations) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, d := range m.Durations {
+		total += d
+	}
+	return total / float64(len(m.Durations))
+}
+
+// Min returns the fastest request duration in milliseconds
+func (m *EndpointMetrics) Min() float64 {
+	return m.Percentile(0)
+}
+
+// Max returns the slowest request duration in milliseconds
+func (m *EndpointMetrics) Max() float64 {
+	return m.Percentile(100)
+}
+
+// Percentile returns the p-th percentile request duration in milliseconds
+func (m *EndpointMetrics) Percentile(p float64) float64 {
+	if len(m.Durations) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), m.Durations...)
+	sort.Float64s(sorted)
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// ErrorRate returns the fraction of failed requests (0..1)
+func (m *EndpointMetrics) ErrorRate() float64 {
+	if m.Checked == 0 {
+		return 0
+	}
+	return float64(m.Failed) / float64(m.Checked)
+}
+
+// AvgRequestBytes returns the data sent per request
+func (m *EndpointMetrics) AvgRequestBytes() float64 {
+	if len(m.Durations) == 0 {
+		return 0
+	}
+	return m.DataSent / float64(len(m.Durations))
+}
+
+// AvgResponseBytes returns the data received per request
+func (m *EndpointMetrics) AvgResponseBytes() float64 {
+	if len(m.Durations) == 0 {
+		return 0
+	}
+	return m.DataReceived / float64(len(m.Durations))
+}
+
+// RPS returns the observed request throughput
+func (m *EndpointMetrics) RPS() float64 {
+	elapsed := m.Last.Sub(m.First).Seconds()
+	if elapsed <= 0 {
+		return float64(len(m.Durations))
+	}
+	return float64(len(m.Durations)) / elapsed
+}
+
+func (m *EndpointMetrics) observe(at time.Time) {
+	if m.First.IsZero() || at.Before(m.First) {
+		m.First = at
+	}
+	if at.After(m.Last) {
+		m.Last = at
+	}
+}
+
+// merge adds another group's samples to m
+func (m *EndpointMetrics) merge(other *EndpointMetrics) {
+	m.Durations = append(m.Durations, other.Durations...)
+	m.Checked += other.Checked
+	m.Failed += other.Failed
+	m.DataSent += other.DataSent
+	m.DataReceived += other.DataReceived
+	if !other.First.IsZero() {
+		m.observe(other.First)
+		m.observe(other.Last)
+	}
+}
+
+// ParseK6Results reads a k6 NDJSON output file and aggregates HTTP metrics
+// grouped by the value of groupTag (e.g. "name" or "scenario"). Samples
+// without the tag are grouped under "all".
+func ParseK6Results(outputFile string, groupTag string) (map[string]*EndpointMetrics, error) {
+	return parseK6Results(outputFile, func(tags map[string]string) string {
+		return tags[groupTag]
+	}, nil)
+}
+
+// parseK6Results aggregates HTTP metrics grouped by the key derived from
+// each sample's tags; an empty key groups under "all". When custom is not
+// nil, the samples of script-defined metrics are collected into it by name.
+func parseK6Results(outputFile string, groupKey func(tags map[string]string) string, custom map[string]*CustomMetric) (map[string]*EndpointMetrics, error) {
+	file, err := os.Open(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open k6 output: %w", err)
+	}
+	defer file.Close()
+
+	groups := make(map[string]*EndpointMetrics)
+	group := func(sample *K6Sample) *EndpointMetrics {
+		key := groupKey(sample.Data.Tags)
+		if key == "" {
+			key = "all"
+		}
+		m, ok := groups[key]
+		if !ok {
+			m = &EndpointMetrics{Name: key}
+			groups[key] = m
+		}
+		return m
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var sample K6Sample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue
+		}
+		if custom != nil && !IsBuiltinMetric(sample.Metric) {
+			m, ok := custom[sample.Metric]
+			if !ok {
+				m = &CustomMetric{Name: sample.Metric}
+				custom[sample.Metric] = m
+			}
+			// k6 declares each metric before its first sample
+			switch sample.Type {
+			case "Metric":
+				m.Type = sample.Data.MetricType
+			case "Point":
+				m.add(sample.Data.Value, sample.Data.Time)
+			}
+			continue
+		}
+		if sample.Type != "Point" {
+			continue
+		}
+
+		switch sample.Metric {
+		case "http_req_duration", "grpc_req_duration", "ws_session_duration":
+			m := group(&sample)
+			m.Durations = append(m.Durations, sample.Data.Value)
+			m.observe(sample.Data.Time)
+		case "http_req_failed":
+			m := group(&sample)
+			m.Checked++
+			if sample.Data.Value != 0 {
+				m.Failed++
+			}
+		case "data_sent":
+			group(&sample).DataSent += sample.Data.Value
+		case "data_received":
+			group(&sample).DataReceived += sample.Data.Value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return groups, fmt.Errorf("failed to read k6 output: %w", err)
+	}
+
+	return groups, nil
+}
+
+// EndpointSummary is the machine-readable result for one endpoint
+type EndpointSummary struct {
+	Endpoint  string  `json:"endpoint"`
+	Requests  int     `json:"requests"`
+	AvgMs     float64 `json:"avg_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	ErrorRate float64 `json:"error_rate"`
+	RPS       float64 `json:"rps"`
+
+	// DataSent and DataReceived are in bytes, and unset when k6 didn't
+	// attribute any transfer to the endpoint
+	DataSent         int64   `json:"data_sent,omitempty"`
+	DataReceived     int64   `json:"data_received,omitempty"`
+	AvgResponseBytes float64 `json:"avg_response_bytes,omitempty"`
+}
+
+// RunSummary is the machine-readable result of a performance test run
+type RunSummary struct {
+	RunID     int64             `json:"run_id"`
+	TestID    int64             `json:"test_id"`
+	VUs       int               `json:"vus"`
+	Duration  string            `json:"duration"`
+	RerunOf   int64             `json:"rerun_of,omitempty"`
+	Passed    bool              `json:"passed"`
+	Endpoints []EndpointSummary `json:"endpoints"`
+
+	// Interrupted is set when server shutdown stopped k6 before the run's
+	// end, so the endpoints cover only what ran
+	Interrupted bool `json:"interrupted,omitempty"`
+
+	// Artifacts are the paths of the files the run kept, by output name
+	Artifacts map[string]string `json:"artifacts,omitempty"`
+
+	// DroppedIterations counts iterations an arrival-rate executor couldn't
+	// start for lack of VUs, so the requested rate wasn't reached
+	DroppedIterations int64 `json:"dropped_iterations,omitempty"`
+
+	// Tags are the labels the run was stored with
+	Tags RunTags `json:"tags,omitempty"`
+
+	// Metadata records the build and environment the run tested
+	Metadata *RunMetadata `json:"metadata,omitempty"`
+
+	// Screenshots are the paths of the images a browser test saved
+	Screenshots []string `json:"screenshots,omitempty"`
+
+	// CustomMetrics are the metrics the script defined itself
+	CustomMetrics []CustomMetricSummary `json:"custom_metrics,omitempty"`
+}
+
+// SummarizeEndpoints converts parsed metrics to endpoint summaries sorted by name
+func SummarizeEndpoints(metrics map[string]*EndpointMetrics) []EndpointSummary {
+	summaries := []EndpointSummary{}
+	for name, m := range metrics {
+		if m.Requests() == 0 {
+			continue
+		}
+		summaries = append(summaries, EndpointSummary{
+			Endpoint:  name,
+			Requests:  m.Requests(),
+			AvgMs:     m.Avg(),
+			P95Ms:     m.Percentile(95),
+			ErrorRate: m.ErrorRate(),
+			RPS:       m.RPS(),
+
+			DataSent:         int64(m.DataSent),
+			DataReceived:     int64(m.DataReceived),
+			AvgResponseBytes: m.AvgResponseBytes(),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Endpoint < summaries[j].Endpoint
+	})
+	return summaries
+}
+
+// K6Summary is the end-of-test summary written by k6 --summary-export
+type K6Summary struct {
+	Metrics map[string]map[string]interface{} `json:"metrics"`
+}
+
+// ParseK6Summary decodes a k6 --summary-export document
+func ParseK6Summary(content []byte) (*K6Summary, error) {
+	var summary K6Summary
+	if err := json.Unmarshal(content, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse k6 summary: %w", err)
+	}
+	if len(summary.Metrics) == 0 {
+		return nil, fmt.Errorf("k6 summary contains no metrics")
+	}
+	return &summary, nil
+}
+
+// Markdown renders the request totals, latency and error rate as a bullet list
+func (s *K6Summary) Markdown() string {
+	stat := func(metric, name string) float64 {
+		value, _ := s.Stat(metric, name)
+		return value
+	}
+	result := fmt.Sprintf("- Requests: %.0f (%.2f/s)\n", stat("http_reqs", "count"), stat("http_reqs", "rate"))
+	result += fmt.Sprintf("- Response Time: avg %.2f ms, min %.2f ms, max %.2f ms\n",
+		stat("http_req_duration", "avg"), stat("http_req_duration", "min"), stat("http_req_duration", "max"))
+	result += fmt.Sprintf("- Percentiles: p90 %.2f ms, p95 %.2f ms, p99 %.2f ms\n",
+		stat("http_req_duration", "p(90)"), stat("http_req_duration", "p(95)"), stat("http_req_duration", "p(99)"))
+	result += fmt.Sprintf("- Error Rate: %.2f%%\n", stat("http_req_failed", "value")*100)
+	if sent, ok := s.Stat("data_sent", "count"); ok {
+		result += fmt.Sprintf("- Data: %s sent, %s received\n", FormatBytes(sent), FormatBytes(stat("data_received", "count")))
+	}
+	if dropped := s.DroppedIterations(); dropped > 0 {
+		result += fmt.Sprintf("- Dropped Iterations: %d\n", dropped)
+	}
+	return result
+}
+
+// FormatBytes renders a byte count with a binary unit, e.g. 1.5 KB
+func FormatBytes(bytes float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
+
+// DroppedIterations returns how many iterations k6 dropped, which
+// arrival-rate executors do when every VU is busy
+func (s *K6Summary) DroppedIterations() int64 {
+	count, _ := s.Stat("dropped_iterations", "count")
+	return int64(count)
+}
+
+// DroppedIterationsWarning explains dropped iterations, or returns "" when
+// there were none
+func DroppedIterationsWarning(dropped int64) string {
+	if dropped <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("Warning: k6 dropped %d iterations because all VUs were busy, so the requested rate wasn't reached and the results understate the load. Regenerate the test with a higher maxVus or preAllocatedVus.", dropped)
+}
+
+// Stat returns a single statistic (e.g. "avg", "p(95)", "rate") of a metric
+func (s *K6Summary) Stat(metric, stat string) (float64, bool) {
+	values, ok := s.Metrics[metric]
+	if !ok {
+		return 0, false
+	}
+	value, ok := values[stat].(float64)
+	return value, ok
+}
@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// SessionStatusFailed selects sessions with a run that didn't pass. It isn't
+// stored: a session's own status says whether its environment is running.
+const SessionStatusFailed = "failed"
+
+// SessionStatuses are the statuses list_sessions filters by
+var SessionStatuses = []string{"running", "completed", SessionStatusLeftRunning, SessionStatusFailed}
+
+// SessionInfo is a test session as the sessions resource and list_sessions
+// report it
+type SessionInfo struct {
+	ID           int64      `json:"id"`
+	Name         string     `json:"name"`
+	StartedAt    time.Time  `json:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	Status       string     `json:"status"`
+	SourceURL    string     `json:"source_url"`
+	ServiceCount int        `json:"service_count"`
+	RunCount     int        `json:"run_count"`
+	// FailedRuns counts runs where k6 exited non-zero: thresholds crossed,
+	// k6 errored or the run was interrupted
+	FailedRuns int `json:"failed_runs"`
+}
+
+// SessionFilter selects sessions; the zero value selects all of them
+type SessionFilter struct {
+	// Status is one of SessionStatuses
+	Status string
+	// SinceDays keeps sessions started in the last SinceDays days
+	SinceDays int
+}
+
+// failedRunsQuery counts the session s's runs that didn't pass
+const failedRunsQuery = `
+	SELECT COUNT(*) FROM test_runs r JOIN tests t ON r.test_id = t.id
+	WHERE t.session_id = s.id AND r.exit_code IS NOT NULL AND r.exit_code <> 0`
+
+// where returns the WHERE clause selecting the filtered sessions as s, and
+// its arguments
+func (f SessionFilter) where(db *DB) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if f.SinceDays > 0 {
+		conditions = append(conditions, "s.started_at > "+db.DaysAgo())
+		args = append(args, f.SinceDays)
+	}
+	switch f.Status {
+	case "":
+	case SessionStatusFailed:
+		conditions = append(conditions, "("+failedRunsQuery+") > 0")
+	default:
+		conditions = append(conditions, "s.status = ?")
+		args = append(args, f.Status)
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ListSessions returns the page of filtered sessions, newest first, and how
+// many sessions match in all
+func ListSessions(db *DB, filter SessionFilter, page Page) ([]SessionInfo, int, error) {
+	where, args := filter.where(db)
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM test_sessions s"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Sessions that tested a running URL have no compose file
+	rows, err := db.Query(`
+		SELECT s.id, s.session_name, s.started_at, s.completed_at, s.status,
+		       COALESCE(c.source_url, ''),
+		       (SELECT COUNT(*) FROM services sv WHERE sv.session_id = s.id),
+		       (SELECT COUNT(*) FROM test_runs r JOIN tests t ON r.test_id = t.id WHERE t.session_id = s.id),
+		       (`+failedRunsQuery+`)
+		FROM test_sessions s
+		LEFT JOIN compose_files c ON s.compose_file_id = c.id`+where+`
+		ORDER BY s.started_at DESC, s.id DESC
+		LIMIT ? OFFSET ?`, append(args, page.Limit, page.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	sessions := []SessionInfo{}
+	for rows.Next() {
+		var s SessionInfo
+		var completedAt sql.NullTime
+		var status sql.NullString
+		if err := rows.Scan(&s.ID, &s.Name, &s.StartedAt, &completedAt, &status, &s.SourceURL,
+			&s.ServiceCount, &s.RunCount, &s.FailedRuns); err != nil {
+			return nil, 0, err
+		}
+		if completedAt.Valid {
+			s.CompletedAt = &completedAt.Time
+		}
+		s.Status = status.String
+		sessions = append(sessions, s)
+	}
+	return sessions, total, rows.Err()
+}
+
+// ListSessionsTool handles the list_sessions tool
+type ListSessionsTool struct {
+	deps *SharedDependencies
+}
+
+// NewListSessionsTool creates a new instance of ListSessionsTool
+func NewListSessionsTool(deps *SharedDependencies) *ListSessionsTool {
+	return &ListSessionsTool{deps: deps}
+}
+
+// Handle processes the list_sessions request
+func (t *ListSessionsTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	filter := SessionFilter{
+		Status:    request.GetString("status", ""),
+		SinceDays: request.GetInt("sinceDays", 0),
+	}
+	if filter.Status != "" && !slices.Contains(SessionStatuses, filter.Status) {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid status %q: must be one of %s", filter.Status, strings.Join(SessionStatuses, ", "))), nil
+	}
+	if filter.SinceDays < 0 {
+		return mcpgolang.NewToolResultError("sinceDays must not be negative"), nil
+	}
+	page, err := NewPage(request.GetInt("limit", DefaultPageLimit), request.GetInt("offset", 0))
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	sessions, total, err := ListSessions(t.deps.DB, filter, page)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Query failed: %v", err)), nil
+	}
+
+	jsonData, _ := json.MarshalIndent(struct {
+		Sessions []SessionInfo `json:"sessions"`
+		PageInfo
+	}{sessions, page.Info(total)}, "", "  ")
+	return mcpgolang.NewToolResultText(string(jsonData)), nil
+}
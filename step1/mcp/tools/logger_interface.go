@@ -1,7 +1,6 @@
 package tools
 
 import (
-	"database/sql"
 	"time"
 )
 
@@ -18,6 +17,6 @@ type Logger interface {
 // ToolContext holds the context needed by tools including logger
 type ToolContext struct {
 	Logger Logger
-	DB     *sql.DB
+	DB     *DB
 }
 
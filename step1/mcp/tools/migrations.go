@@ -0,0 +1,393 @@
+package tools
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration is one numbered change to the schema. Versions are applied in
+// order, once each, and recorded in schema_migrations; append new changes as
+// new versions rather than editing applied ones.
+type migration struct {
+	Version     int
+	Description string
+	// DDL is SQLite syntax, adapted for Postgres by Schema
+	DDL string
+	// Columns are added after DDL runs, skipping any that already exist:
+	// databases created before migrations may have some of them already
+	Columns []migrationColumn
+	// Apply makes changes SQL can't express in both dialects; it runs last
+	Apply func(db *DB, tx *sql.Tx) error
+}
+
+// migrationColumn is a column added to an existing table
+type migrationColumn struct {
+	Table, Name, Type string
+}
+
+// migrations is the schema history. Version 1 is the original schema; later
+// versions add what the tools have needed since.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "initial schema",
+		DDL: `
+	CREATE TABLE IF NOT EXISTS compose_files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		source_url TEXT NOT NULL,
+		content TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS test_sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		compose_file_id INTEGER,
+		session_name TEXT NOT NULL,
+		started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP,
+		status TEXT,
+		FOREIGN KEY (compose_file_id) REFERENCES compose_files(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS services (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER,
+		name TEXT NOT NULL,
+		image TEXT NOT NULL,
+		ports TEXT,
+		FOREIGN KEY (session_id) REFERENCES test_sessions(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS api_specs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER,
+		service_id INTEGER,
+		spec_url TEXT,
+		spec_content TEXT,
+		version TEXT,
+		discovered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES test_sessions(id),
+		FOREIGN KEY (service_id) REFERENCES services(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS endpoints (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		spec_id INTEGER,
+		path TEXT NOT NULL,
+		method TEXT NOT NULL,
+		sla_response_time INTEGER,
+		sla_error_rate REAL,
+		FOREIGN KEY (spec_id) REFERENCES api_specs(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		script TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES test_sessions(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS test_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		test_id INTEGER,
+		started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP,
+		vus INTEGER,
+		duration TEXT,
+		results TEXT,
+		FOREIGN KEY (test_id) REFERENCES tests(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS metrics (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id INTEGER,
+		endpoint TEXT,
+		avg_response_time REAL,
+		min_response_time REAL,
+		max_response_time REAL,
+		error_rate REAL,
+		requests_per_second REAL,
+		FOREIGN KEY (run_id) REFERENCES test_runs(id)
+	);`,
+	},
+	{
+		Version:     2,
+		Description: "run details, test data and per-service metrics",
+		Columns: []migrationColumn{
+			{"test_sessions", "project_name", "TEXT"},
+			{"tests", "test_data", "TEXT"},
+			{"tests", "scenario_duration", "TEXT"},
+			{"test_runs", "summary", "TEXT"},
+			{"test_runs", "results_file", "TEXT"},
+			{"test_runs", "stderr", "TEXT"},
+			{"metrics", "service", "TEXT"},
+			{"metrics", "p95_response_time", "REAL"},
+		},
+	},
+	{
+		Version:     3,
+		Description: "history query indexes",
+		// History queries join metrics to runs and filter by start time and endpoint
+		DDL: `
+	CREATE INDEX IF NOT EXISTS idx_metrics_run_id ON metrics(run_id);
+	CREATE INDEX IF NOT EXISTS idx_metrics_endpoint ON metrics(endpoint);
+	CREATE INDEX IF NOT EXISTS idx_test_runs_started_at ON test_runs(started_at);`,
+	},
+	{
+		Version:     4,
+		Description: "SHA-256 compose file hashes",
+		Apply:       rehashComposeFiles,
+	},
+	{
+		Version:     5,
+		Description: "service logs of failed runs",
+		Columns: []migrationColumn{
+			{"test_runs", "service_logs", "TEXT"},
+		},
+	},
+	{
+		Version:     6,
+		Description: "setup requests of generated tests",
+		Columns: []migrationColumn{
+			{"tests", "setup_config", "TEXT"},
+		},
+	},
+	{
+		Version:     7,
+		Description: "k6 exit codes of runs",
+		Columns: []migrationColumn{
+			{"test_runs", "exit_code", "INTEGER"},
+		},
+	},
+	{
+		Version:     8,
+		Description: "run tags",
+		DDL: `
+	CREATE TABLE IF NOT EXISTS run_tags (
+		run_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (run_id, key),
+		FOREIGN KEY (run_id) REFERENCES test_runs(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_run_tags_key_value ON run_tags(key, value);`,
+	},
+	{
+		Version:     9,
+		Description: "browser test screenshots",
+		DDL: `
+	CREATE TABLE IF NOT EXISTS run_screenshots (
+		run_id INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		PRIMARY KEY (run_id, path),
+		FOREIGN KEY (run_id) REFERENCES test_runs(id)
+	);`,
+	},
+	{
+		Version:     10,
+		Description: "compose profiles of sessions",
+		Columns: []migrationColumn{
+			{"test_sessions", "profiles", "TEXT"},
+		},
+	},
+	{
+		Version:     11,
+		Description: "custom k6 metrics",
+		DDL: `
+	CREATE TABLE IF NOT EXISTS custom_metrics (
+		run_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		samples INTEGER NOT NULL,
+		value REAL NOT NULL,
+		min REAL,
+		max REAL,
+		p90 REAL,
+		p95 REAL,
+		PRIMARY KEY (run_id, name),
+		FOREIGN KEY (run_id) REFERENCES test_runs(id)
+	);`,
+	},
+	{
+		Version:     12,
+		Description: "per-endpoint request counts and data transfer",
+		Columns: []migrationColumn{
+			{"metrics", "requests", "INTEGER"},
+			{"metrics", "data_sent", "INTEGER"},
+			{"metrics", "data_received", "INTEGER"},
+		},
+	},
+	{
+		Version:     13,
+		Description: "run metadata",
+		Columns: []migrationColumn{
+			{"test_runs", "metadata", "TEXT"},
+		},
+	},
+	{
+		Version:     14,
+		Description: "run status for interrupted runs",
+		Columns: []migrationColumn{
+			{"test_runs", "status", "TEXT"},
+		},
+	},
+}
+
+// rehashComposeFiles replaces MD5 compose hashes with the SHA-256 that
+// StoreComposeFile deduplicates by. Neither database has SHA-256 built in,
+// so the hashes are computed here.
+func rehashComposeFiles(db *DB, tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, content FROM compose_files")
+	if err != nil {
+		return err
+	}
+	hashes := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes[id] = ComposeHash(content)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, hash := range hashes {
+		if _, err := tx.Exec(db.Rebind("UPDATE compose_files SET hash = ? WHERE id = ?"), hash, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrate brings the schema up to date, applying each migration newer than
+// the recorded version in its own transaction. It returns the versions it
+// applied.
+func (db *DB) Migrate() ([]int, error) {
+	if _, err := db.Exec(db.Schema(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`)); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []int{}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := db.applyMigration(m); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+		applied = append(applied, m.Version)
+	}
+	return applied, nil
+}
+
+// SchemaVersion returns the latest applied migration, or 0 for a new database
+func (db *DB) SchemaVersion() (int, error) {
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if m.DDL != "" {
+		if _, err := tx.Exec(db.Schema(m.DDL)); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range m.Columns {
+		var exists int
+		if err := tx.QueryRow(db.Rebind(db.columnExistsQuery()), c.Table, c.Name).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to inspect %s.%s: %w", c.Table, c.Name, err)
+		}
+		if exists > 0 {
+			continue
+		}
+		if _, err := tx.Exec(db.Schema(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.Table, c.Name, c.Type))); err != nil {
+			return err
+		}
+	}
+
+	if m.Apply != nil {
+		if err := m.Apply(db, tx); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(db.Rebind("INSERT INTO schema_migrations (version, description) VALUES (?, ?)"), m.Version, m.Description); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// resetTables are the tables Reset drops, each before the tables it
+// references. Tables added by new migrations belong here too.
+var resetTables = []string{
+	"custom_metrics", "run_screenshots", "run_tags", "metrics", "test_runs", "tests", "endpoints", "api_specs",
+	"services", "test_sessions", "compose_files", "schema_migrations",
+}
+
+// Reset drops every table in one transaction, then migrates the empty
+// database to the latest schema. It returns how many rows each table held.
+func (db *DB) Reset() (map[string]int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	counts := map[string]int64{}
+	for _, table := range resetTables {
+		var count int64
+		if err := tx.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		counts[table] = count
+		if _, err := tx.Exec("DROP TABLE " + table); err != nil {
+			return nil, fmt.Errorf("failed to drop %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		return counts, err
+	}
+	return counts, nil
+}
+
+// columnExistsQuery counts the columns named by its two placeholders, table
+// then column
+func (db *DB) columnExistsQuery() string {
+	if db.IsPostgres() {
+		return "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?"
+	}
+	return "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+}
@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistoryQueryUsesIndexes(t *testing.T) {
+	db := openTestDB(t)
+	tests := []struct {
+		name    string
+		filter  historyFilter
+		indexes []string
+	}{
+		{name: "days", filter: historyFilter{Days: 7}, indexes: []string{"idx_test_runs_started_at", "idx_metrics_run_id"}},
+		{name: "service", filter: historyFilter{Days: 7, Service: "api"}, indexes: []string{"idx_test_runs_started_at", "idx_metrics_run_id"}},
+		{name: "endpoint", filter: historyFilter{Days: 7, Endpoint: "/users"}, indexes: []string{"idx_metrics_endpoint"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, args := tt.filter.From(db)
+			rows, err := db.Query(`EXPLAIN QUERY PLAN
+				SELECT tr.started_at, m.endpoint, m.avg_response_time, m.error_rate, m.requests_per_second`+from+`
+				ORDER BY tr.started_at DESC, m.id DESC
+				LIMIT 20`, args...)
+			if err != nil {
+				t.Fatalf("EXPLAIN QUERY PLAN failed: %v", err)
+			}
+			defer rows.Close()
+
+			var plan []string
+			for rows.Next() {
+				var id, parent, unused int
+				var detail string
+				if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+					t.Fatalf("failed to read the plan: %v", err)
+				}
+				plan = append(plan, detail)
+			}
+			for _, index := range tt.indexes {
+				if !strings.Contains(strings.Join(plan, "\n"), index) {
+					t.Errorf("plan doesn't use %s:\n%s", index, strings.Join(plan, "\n"))
+				}
+			}
+		})
+	}
+}
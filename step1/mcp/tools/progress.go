@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ProgressInterval is how often long k6 runs report estimated progress
+const ProgressInterval = 5 * time.Second
+
+// ProgressPercent estimates how far through a run of the expected length it
+// is after elapsed, to one decimal place. The estimate stops at 99 because k6
+// takes a little longer than its scenario to wind down and write results.
+func ProgressPercent(elapsed, expected time.Duration) float64 {
+	if expected <= 0 {
+		return 0
+	}
+	percent := float64(elapsed) / float64(expected) * 100
+	return math.Round(math.Min(percent, 99)*10) / 10
+}
+
+// TrackRunProgress calls report with the estimated completion every
+// ProgressInterval until the returned stop function is called or ctx ends.
+// expected is the run's total length: the duration, or the sum of the stages
+// for staged tests.
+func TrackRunProgress(ctx context.Context, expected time.Duration, report func(data map[string]interface{})) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	start := time.Now()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				elapsed := time.Since(start)
+				report(map[string]interface{}{
+					"percent":           ProgressPercent(elapsed, expected),
+					"elapsed":           elapsed.Round(time.Second).String(),
+					"expected_duration": expected.String(),
+				})
+			}
+		}
+	}()
+
+	// Waiting for the goroutine means no report arrives after the run's result
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+type progressKey struct{}
+
+// progressReporter tracks a request's progress token and the last value sent
+// for it; clients expect progress to increase with every notification
+type progressReporter struct {
+	token mcpgolang.ProgressToken
+	mu    sync.Mutex
+	last  float64
+}
+
+// WithProgressToken returns ctx carrying the request's progress token, when
+// the client sent one to ask for notifications/progress
+func WithProgressToken(ctx context.Context, request mcpgolang.CallToolRequest) context.Context {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, &progressReporter{token: request.Params.Meta.ProgressToken})
+}
+
+// next returns the progress value for an update: its percent out of 100 when
+// it has one, otherwise one more than the last value with no total. ok is
+// false when the value wouldn't increase, e.g. a later batch restarting at 0.
+func (r *progressReporter) next(data map[string]interface{}) (progress, total float64, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	progress = r.last + 1
+	if percent, isPercent := data["percent"].(float64); isPercent {
+		progress, total = percent, 100
+	}
+	if progress <= r.last {
+		return 0, 0, false
+	}
+	r.last = progress
+	return progress, total, true
+}
+
+// SendProgress logs a progress update and, when the client supplied a
+// progress token, sends it as a notifications/progress message. Every tool
+// reports progress through this one method.
+func (d *SharedDependencies) SendProgress(ctx context.Context, progress string, data map[string]interface{}) {
+	d.Logger.LogInfo("Progress update", map[string]interface{}{
+		"progress":  progress,
+		"component": "progress",
+		"data":      data,
+	})
+
+	reporter, ok := ctx.Value(progressKey{}).(*progressReporter)
+	mcpServer := server.ServerFromContext(ctx)
+	if !ok || mcpServer == nil {
+		return
+	}
+	value, total, ok := reporter.next(data)
+	if !ok {
+		return
+	}
+
+	params := map[string]any{
+		"progressToken": reporter.token,
+		"progress":      value,
+		"message":       progress,
+	}
+	if total > 0 {
+		params["total"] = total
+	}
+	if err := mcpServer.SendNotificationToClient(ctx, "notifications/progress", params); err != nil {
+		d.Logger.LogDebug("Failed to send progress notification", map[string]interface{}{
+			"progress": progress,
+			"error":    err.Error(),
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OwnerLabel is the container label naming the server that started a compose
+// project, so the startup sweep can tell its own leftovers from the in-flight
+// runs of another server on the same host
+const OwnerLabel = "io.speak-perf.owner"
+
+// serverOwner is this server's OwnerLabel value: its PID and start time, so a
+// PID reused by a later process isn't taken for it
+var serverOwner = fmt.Sprintf("%d@%d", os.Getpid(), time.Now().Unix())
+
+// ownerStartSlack is how far a process's start time, as the OS reports it,
+// may be from the one in its label. The label is taken as the server
+// initializes, after the process started.
+const ownerStartSlack = time.Minute
+
+// writeOwnerOverride writes a compose override file labelling every service
+// of the compose file at composePath with serverOwner, and returns its path.
+// The caller removes the file once the project is up.
+func writeOwnerOverride(composePath string) (string, error) {
+	content, err := os.ReadFile(composePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read compose file: %w", err)
+	}
+	var compose ComposeFile
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return "", fmt.Errorf("failed to parse compose file: %w", err)
+	}
+
+	services := make(map[string]map[string]map[string]string, len(compose.Services))
+	for name := range compose.Services {
+		services[name] = map[string]map[string]string{"labels": {OwnerLabel: serverOwner}}
+	}
+	override, err := yaml.Marshal(map[string]interface{}{"services": services})
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp("", "compose-owner-*.yaml")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(override); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// projectOwners returns the OwnerLabel values of each compose project's
+// containers. Containers started before owners were recorded have none.
+func projectOwners(ctx context.Context) (map[string][]string, error) {
+	output, err := exec.CommandContext(ctx, "docker", "ps", "--all",
+		"--filter", "label=com.docker.compose.project",
+		"--format", fmt.Sprintf(`{{.Label "com.docker.compose.project"}}\t{{.Label %q}}`, OwnerLabel)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list compose containers: %w", err)
+	}
+	return parseProjectOwners(string(output)), nil
+}
+
+// parseProjectOwners reads the project and owner lines projectOwners asks
+// docker ps for. Each project lists its distinct owners.
+func parseProjectOwners(output string) map[string][]string {
+	owners := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		project, owner, _ := strings.Cut(line, "\t")
+		owner = strings.TrimSpace(owner)
+		if project == "" {
+			continue
+		}
+		if _, ok := owners[project]; !ok {
+			owners[project] = []string{}
+		}
+		if owner != "" && !slices.Contains(owners[project], owner) {
+			owners[project] = append(owners[project], owner)
+		}
+	}
+	return owners
+}
+
+// ownerAlive reports whether the server an OwnerLabel value names is still
+// running. An owner it can't read is taken to be alive, so its project is
+// left alone.
+func ownerAlive(owner string) bool {
+	if owner == serverOwner {
+		return true
+	}
+	pidText, startText, ok := strings.Cut(owner, "@")
+	pid, pidErr := strconv.Atoi(pidText)
+	startUnix, startErr := strconv.ParseInt(startText, 10, 64)
+	if !ok || pidErr != nil || startErr != nil || pid <= 0 {
+		return true
+	}
+	if !processRunning(pid) {
+		return false
+	}
+	// A process that started at another time only reuses the PID
+	if started, ok := processStartTime(pid); ok {
+		if diff := started.Sub(time.Unix(startUnix, 0)); diff > ownerStartSlack || diff < -ownerStartSlack {
+			return false
+		}
+	}
+	return true
+}
+
+// processRunning reports whether a process with the PID exists. Errors other
+// than the process being gone, such as lacking permission to signal it,
+// count as running.
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH)
+}
+
+// clockTicksPerSecond is the unit of a Linux process's start time in
+// /proc/<pid>/stat; it is 100 on the platforms Linux supports
+const clockTicksPerSecond = 100
+
+// processStartTime returns when the process with the PID started, read from
+// /proc on Linux. ok is false where /proc isn't available.
+func processStartTime(pid int) (time.Time, bool) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return time.Time{}, false
+	}
+	procStat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parseProcessStartTime(string(stat), string(procStat))
+}
+
+// parseProcessStartTime reads a process's start time from its /proc/<pid>/stat
+// line, in clock ticks since boot, and the boot time from /proc/stat
+func parseProcessStartTime(stat, procStat string) (time.Time, bool) {
+	// The command name is in parentheses and may hold spaces, so the fields
+	// are counted from the last ')': starttime is the 22nd field, the 20th
+	// after the name
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return time.Time{}, false
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return time.Time{}, false
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	for _, line := range strings.Split(procStat, "\n") {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			boot, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return time.Unix(boot, 0).Add(time.Duration(ticks) * time.Second / clockTicksPerSecond), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProjectOwners(t *testing.T) {
+	output := "perftest-session-1\t123@1760000000\n" +
+		"perftest-session-1\t123@1760000000\n" +
+		"perftest-session-1\t456@1760000100\n" +
+		"quick-123\t\n" +
+		"\t789@1760000000\n"
+
+	owners := parseProjectOwners(output)
+	want := map[string][]string{
+		"perftest-session-1": {"123@1760000000", "456@1760000100"},
+		// Containers from before the owner label have none
+		"quick-123": {},
+	}
+	if !reflect.DeepEqual(owners, want) {
+		t.Errorf("owners = %v, want %v", owners, want)
+	}
+}
+
+func TestOwnerAlive(t *testing.T) {
+	if !ownerAlive(serverOwner) {
+		t.Error("this server's own projects have a dead owner")
+	}
+	if !ownerAlive("not an owner") {
+		t.Error("a project with an unreadable owner would be removed")
+	}
+
+	// A process that has exited, whose PID nothing has reused yet
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("can't run a process: %v", err)
+	}
+	exited := fmt.Sprintf("%d@%d", cmd.Process.Pid, time.Now().Unix())
+	if ownerAlive(exited) {
+		t.Errorf("owner %s of an exited process is alive", exited)
+	}
+
+	// This process's PID, as a server started a day earlier would have
+	// recorded it
+	if _, ok := processStartTime(os.Getpid()); ok {
+		reused := fmt.Sprintf("%d@%d", os.Getpid(), time.Now().Add(-24*time.Hour).Unix())
+		if ownerAlive(reused) {
+			t.Errorf("owner %s whose PID was reused is alive", reused)
+		}
+	}
+}
+
+func TestParseProcessStartTime(t *testing.T) {
+	procStat := "cpu  1 2 3\nbtime 1760000000\nprocesses 42\n"
+	// The command name holds spaces and a ')'; starttime is 12345 ticks
+	stat := "4242 (my (odd) server) S 1 4242 4242 0 -1 4194560 100 0 0 0 5 3 0 0 20 0 8 0 12345 1000000 500"
+
+	started, ok := parseProcessStartTime(stat, procStat)
+	if !ok {
+		t.Fatal("start time not parsed")
+	}
+	if want := time.Unix(1760000000, 0).Add(123450 * time.Millisecond); !started.Equal(want) {
+		t.Errorf("started %v, want %v", started, want)
+	}
+
+	if _, ok := parseProcessStartTime(stat, "cpu  1 2 3\n"); ok {
+		t.Error("start time parsed without a boot time")
+	}
+	if _, ok := parseProcessStartTime("4242 (server) S 1", procStat); ok {
+		t.Error("start time parsed from a short stat line")
+	}
+}
+
+func TestWriteOwnerOverride(t *testing.T) {
+	composePath := filepath.Join(t.TempDir(), "docker-compose.yml")
+	compose := "services:\n  api:\n    image: api:latest\n  db:\n    image: postgres:16\n"
+	if err := os.WriteFile(composePath, []byte(compose), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	override, err := writeOwnerOverride(composePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(override)
+
+	content, err := os.ReadFile(override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range []string{"api:", "db:"} {
+		if !strings.Contains(string(content), service) {
+			t.Errorf("override doesn't label %s\n%s", service, content)
+		}
+	}
+	if !strings.Contains(string(content), OwnerLabel+": "+serverOwner) {
+		t.Errorf("override doesn't set %s to %s\n%s", OwnerLabel, serverOwner, content)
+	}
+}
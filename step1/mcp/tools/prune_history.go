@@ -0,0 +1,164 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// PruneHistoryTool handles the prune_history tool
+type PruneHistoryTool struct {
+	deps *SharedDependencies
+}
+
+// NewPruneHistoryTool creates a new instance of PruneHistoryTool
+func NewPruneHistoryTool(deps *SharedDependencies) *PruneHistoryTool {
+	return &PruneHistoryTool{deps: deps}
+}
+
+// Handle processes the prune_history request
+func (t *PruneHistoryTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	days := request.GetFloat("olderThanDays", 0)
+	if days < 1 || days != float64(int(days)) {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("olderThanDays must be a whole number of days of at least 1, got %v", days)), nil
+	}
+	olderThanDays := int(days)
+	dryRun := request.GetString("dryRun", "false") == "true"
+
+	// Runs and their metrics go; tests and sessions stay so they can be rerun
+	runs := "SELECT id FROM test_runs WHERE started_at < " + t.deps.DB.DaysAgo()
+
+	report := fmt.Sprintf("# Prune History\n\nTest runs started more than %d days ago.\n\n", olderThanDays)
+	if dryRun {
+		var runCount, metricCount int64
+		if err := t.deps.DB.QueryRow("SELECT COUNT(*) FROM test_runs WHERE id IN ("+runs+")", olderThanDays).Scan(&runCount); err != nil {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to count test runs: %v", err)), nil
+		}
+		if err := t.deps.DB.QueryRow("SELECT COUNT(*) FROM metrics WHERE run_id IN ("+runs+")", olderThanDays).Scan(&metricCount); err != nil {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to count metrics: %v", err)), nil
+		}
+		report += "Dry run: nothing was removed.\n\n"
+		report += fmt.Sprintf("- Would remove %d test runs\n- Would remove %d metrics\n", runCount, metricCount)
+		return mcpgolang.NewToolResultText(report), nil
+	}
+
+	files, runCount, metricCount, err := t.prune(runs, olderThanDays)
+	if err != nil {
+		t.deps.Logger.LogError("Failed to prune history", err, map[string]interface{}{
+			"older_than_days": olderThanDays,
+		})
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to prune history: %v", err)), nil
+	}
+	report += fmt.Sprintf("- Removed %d test runs\n- Removed %d metrics\n", runCount, metricCount)
+
+	// The k6 output files of the removed runs are no longer reachable
+	removedFiles := 0
+	for _, file := range files {
+		if err := os.Remove(file); err == nil {
+			removedFiles++
+		} else if !os.IsNotExist(err) {
+			report += fmt.Sprintf("- Failed to remove %s: %v\n", file, err)
+		}
+	}
+	report += fmt.Sprintf("- Removed %d result files\n", removedFiles)
+
+	// SQLite keeps freed pages until it is vacuumed; Postgres autovacuum
+	// reclaims them on its own
+	if runCount > 0 && !t.deps.DB.IsPostgres() {
+		if _, err := t.deps.DB.Exec("VACUUM"); err != nil {
+			report += fmt.Sprintf("\nVACUUM failed, so the file has not shrunk: %v\n", err)
+		} else {
+			report += "\nThe database was vacuumed to reclaim the space.\n"
+		}
+	}
+
+	t.deps.Logger.LogInfo("History pruned", map[string]interface{}{
+		"older_than_days": olderThanDays,
+		"removed_runs":    runCount,
+		"removed_metrics": metricCount,
+		"removed_files":   removedFiles,
+	})
+
+	return mcpgolang.NewToolResultText(report), nil
+}
+
+// prune deletes the runs selected by runs, and their metrics, in one
+// transaction. It returns the results files of the deleted runs and how many
+// runs and metrics were deleted.
+func (t *PruneHistoryTool) prune(runs string, olderThanDays int) ([]string, int64, int64, error) {
+	db := t.deps.DB
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// Screenshots come before the directories that hold them
+	rows, err := tx.Query(db.Rebind("SELECT path FROM run_screenshots WHERE run_id IN ("+runs+")"), olderThanDays)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	files := []string{}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return nil, 0, 0, err
+		}
+		files = append(files, path)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	rows, err = tx.Query(db.Rebind("SELECT id, results_file FROM test_runs WHERE results_file IS NOT NULL AND id IN ("+runs+")"), olderThanDays)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	for rows.Next() {
+		var id int64
+		var file sql.NullString
+		if err := rows.Scan(&id, &file); err != nil {
+			rows.Close()
+			return nil, 0, 0, err
+		}
+		if file.String != "" {
+			// CSV and summary files kept with the outputs parameter sit
+			// next to the JSON results
+			dir := filepath.Dir(file.String)
+			files = append(files, file.String, K6CSVPath(dir, id), K6SummaryPath(dir, id), K6ScreenshotDir(dir, id))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	// Metrics, tags and screenshots first, since they reference the runs
+	result, err := tx.Exec(db.Rebind("DELETE FROM metrics WHERE run_id IN ("+runs+")"), olderThanDays)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	metricCount, _ := result.RowsAffected()
+	for _, table := range []string{"run_tags", "run_screenshots", "custom_metrics"} {
+		if _, err := tx.Exec(db.Rebind("DELETE FROM "+table+" WHERE run_id IN ("+runs+")"), olderThanDays); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	result, err = tx.Exec(db.Rebind("DELETE FROM test_runs WHERE id IN ("+runs+")"), olderThanDays)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	runCount, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, 0, err
+	}
+	return files, runCount, metricCount, nil
+}
@@ -2,7 +2,6 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	mcpgolang "github.com/mark3labs/mcp-go/mcp"
@@ -20,31 +19,33 @@ func NewQueryHistoryTool(deps *SharedDependencies) *QueryHistoryTool {
 
 // Handle processes the query_test_history request
 func (t *QueryHistoryTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
-	// service := request.GetString("service", "") // Not used yet
-	endpoint := request.GetString("endpoint", "")
-	days := int(request.GetFloat("days", 7))
+	filter, err := historyFilterFromRequest(request)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	page, err := NewPage(request.GetInt("limit", DefaultPageLimit), request.GetInt("offset", 0))
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	from, args := filter.From(t.deps.DB)
+
+	var total int
+	if err := t.deps.DB.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Query failed: %v", err)), nil
+	}
 
 	query := `
 		SELECT 
 			tr.started_at,
 			m.endpoint,
+			COALESCE(m.service, ''),
 			m.avg_response_time,
 			m.error_rate,
-			m.requests_per_second
-		FROM metrics m
-		JOIN test_runs tr ON m.run_id = tr.id
-		WHERE tr.started_at > datetime('now', '-' || ? || ' days')`
+			m.requests_per_second` + from + `
+		ORDER BY tr.started_at DESC, m.id DESC
+		LIMIT ? OFFSET ?`
 
-	args := []interface{}{days}
-
-	if endpoint != "" {
-		query += " AND m.endpoint = ?"
-		args = append(args, endpoint)
-	}
-
-	query += " ORDER BY tr.started_at DESC"
-
-	rows, err := t.deps.DB.Query(query, args...)
+	rows, err := t.deps.DB.Query(query, append(args, page.Limit, page.Offset)...)
 	if err != nil {
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Query failed: %v", err)), nil
 	}
@@ -52,20 +53,103 @@ func (t *QueryHistoryTool) Handle(ctx context.Context, request mcpgolang.CallToo
 
 	results := []map[string]interface{}{}
 	for rows.Next() {
-		var timestamp, endpoint string
+		var timestamp, endpoint, service string
 		var avgTime, errorRate, rps float64
-		rows.Scan(&timestamp, &endpoint, &avgTime, &errorRate, &rps)
+		rows.Scan(&timestamp, &endpoint, &service, &avgTime, &errorRate, &rps)
 
 		results = append(results, map[string]interface{}{
 			"timestamp": timestamp,
 			"endpoint":  endpoint,
+			"service":   service,
 			"avgTime":   avgTime,
 			"errorRate": errorRate,
 			"rps":       rps,
 		})
 	}
 
-	jsonData, _ := json.MarshalIndent(results, "", "  ")
-	return mcpgolang.NewToolResultText(string(jsonData)), nil
+	info := page.Info(total)
+	report := ToolReport{
+		Title:   "Test History",
+		Status:  "found",
+		Summary: fmt.Sprintf("%d of %d matching rows from the last %d days", len(results), total, filter.Days),
+		Data: struct {
+			Results []map[string]interface{} `json:"results"`
+			PageInfo
+		}{results, info},
+	}
+	if len(results) == 0 {
+		report.Status = "empty"
+	}
+	report.AddMetric("rows", float64(len(results)))
+	report.AddMetric("total", float64(total))
+
+	if len(results) > 0 {
+		table := "| Started | Service | Endpoint | Avg (ms) | Error Rate | RPS |\n|---|---|---|---|---|---|\n"
+		for _, r := range results {
+			table += fmt.Sprintf("| %s | %s | %s | %.2f | %.2f%% | %.2f |\n",
+				r["timestamp"], r["service"], r["endpoint"], r["avgTime"], r["errorRate"].(float64)*100, r["rps"])
+		}
+		report.AddSection("", table)
+	}
+	if info.HasMore {
+		report.AddSection("", fmt.Sprintf("More rows match; pass offset=%d for the next page.", info.Offset+info.Limit))
+	}
+	return report.DataResult(), nil
+}
+
+// historyFilter selects the metrics rows of query_test_history and export_history
+type historyFilter struct {
+	Service  string
+	Endpoint string
+	Days     int
+	// Tags must all be on a row's run
+	Tags RunTags
+}
+
+// historyFilterFromRequest reads the service, endpoint, days and tags parameters
+func historyFilterFromRequest(request mcpgolang.CallToolRequest) (historyFilter, error) {
+	tags, err := ParseRunTags(request.GetString("tags", ""))
+	if err != nil {
+		return historyFilter{}, fmt.Errorf("Invalid tags: %v", err)
+	}
+	return historyFilter{
+		Service:  request.GetString("service", ""),
+		Endpoint: request.GetString("endpoint", ""),
+		Days:     int(request.GetFloat("days", 7)),
+		Tags:     tags,
+	}, nil
 }
 
+// From returns the FROM and WHERE clauses selecting the filtered metrics as
+// m, joined to their runs as tr, and their arguments
+func (f historyFilter) From(db *DB) (string, []interface{}) {
+	from := `
+		FROM metrics m
+		JOIN test_runs tr ON m.run_id = tr.id
+		WHERE tr.started_at > ` + db.DaysAgo()
+
+	args := []interface{}{f.Days}
+
+	if f.Endpoint != "" {
+		from += " AND m.endpoint = ?"
+		args = append(args, f.Endpoint)
+	}
+
+	// Metrics record the service they were measured for when the run knew
+	// it. Older rows, and runs whose target wasn't known, have no service;
+	// those match when the run's session (metrics -> test_runs -> tests ->
+	// test_sessions -> services) has only the requested service.
+	if f.Service != "" {
+		from += ` AND (m.service = ? OR (m.service IS NULL AND (
+			SELECT MIN(sv.name)
+			FROM tests t
+			JOIN services sv ON sv.session_id = t.session_id
+			WHERE t.id = tr.test_id
+			HAVING COUNT(*) = 1) = ?))`
+		args = append(args, f.Service, f.Service)
+	}
+
+	// Runs must carry every requested tag
+	tagFilter, tagArgs := f.Tags.Filter("tr.id")
+	return from + tagFilter, append(args, tagArgs...)
+}
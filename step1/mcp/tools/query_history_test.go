@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestQueryHistoryServiceFilter(t *testing.T) {
+	db := openTestDB(t)
+
+	// One session with two services, and one run that measured both
+	sessionId := mustInsert(t, db, "INSERT INTO test_sessions (session_name, status) VALUES ('two-services', 'completed')")
+	mustInsert(t, db, "INSERT INTO services (session_id, name, image) VALUES (?, 'api', 'api:latest')", sessionId)
+	mustInsert(t, db, "INSERT INTO services (session_id, name, image) VALUES (?, 'web', 'web:latest')", sessionId)
+	testId := mustInsert(t, db, "INSERT INTO tests (session_id, name, type, script) VALUES (?, 'all-services', 'load', '')", sessionId)
+	runId := mustInsert(t, db, "INSERT INTO test_runs (test_id, vus, duration) VALUES (?, 10, '30s')", testId)
+	for _, row := range []struct{ service, endpoint string }{
+		{"api", "/users"},
+		{"api", "/orders"},
+		{"web", "/"},
+	} {
+		mustInsert(t, db, `INSERT INTO metrics (run_id, endpoint, service, avg_response_time, error_rate, requests_per_second)
+			VALUES (?, ?, ?, 10, 0, 5)`, runId, row.endpoint, row.service)
+	}
+	// Without a service, a row of a two-service session can't be attributed
+	mustInsert(t, db, `INSERT INTO metrics (run_id, endpoint, avg_response_time, error_rate, requests_per_second)
+		VALUES (?, '/unattributed', 10, 0, 5)`, runId)
+
+	tool := NewQueryHistoryTool(&SharedDependencies{DB: db})
+	tests := []struct {
+		service   string
+		endpoints map[string]bool
+	}{
+		{service: "api", endpoints: map[string]bool{"/users": true, "/orders": true}},
+		{service: "web", endpoints: map[string]bool{"/": true}},
+		{service: "worker", endpoints: map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			var request mcpgolang.CallToolRequest
+			request.Params.Arguments = map[string]any{"service": tt.service}
+			result, err := tool.Handle(context.Background(), request)
+			if err != nil || result.IsError {
+				t.Fatalf("query failed: %v %+v", err, result)
+			}
+
+			var response struct {
+				Results []struct {
+					Endpoint string `json:"endpoint"`
+					Service  string `json:"service"`
+				} `json:"results"`
+				Total int `json:"total"`
+			}
+			if err := json.Unmarshal([]byte(result.Content[0].(mcpgolang.TextContent).Text), &response); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if response.Total != len(tt.endpoints) || len(response.Results) != len(tt.endpoints) {
+				t.Fatalf("got %d rows (total %d), want %d: %+v", len(response.Results), response.Total, len(tt.endpoints), response.Results)
+			}
+			for _, row := range response.Results {
+				if row.Service != tt.service || !tt.endpoints[row.Endpoint] {
+					t.Errorf("unexpected row %+v", row)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryHistoryContentOrder(t *testing.T) {
+	db := openTestDB(t)
+	sessionId := mustInsert(t, db, "INSERT INTO test_sessions (session_name, status) VALUES ('one-service', 'completed')")
+	mustInsert(t, db, "INSERT INTO services (session_id, name, image) VALUES (?, 'api', 'api:latest')", sessionId)
+	testId := mustInsert(t, db, "INSERT INTO tests (session_id, name, type, script) VALUES (?, 'api', 'load', '')", sessionId)
+	runId := mustInsert(t, db, "INSERT INTO test_runs (test_id, vus, duration) VALUES (?, 10, '30s')", testId)
+	mustInsert(t, db, `INSERT INTO metrics (run_id, endpoint, service, avg_response_time, error_rate, requests_per_second)
+		VALUES (?, '/users', 'api', 10, 0, 5)`, runId)
+
+	var request mcpgolang.CallToolRequest
+	request.Params.Arguments = map[string]any{}
+	result, err := NewQueryHistoryTool(&SharedDependencies{DB: db}).Handle(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("query failed: %v %+v", err, result)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("got %d content blocks, want JSON and markdown", len(result.Content))
+	}
+
+	// The JSON clients read before the markdown was added stays first
+	var response struct {
+		Results []map[string]interface{} `json:"results"`
+		Total   int                      `json:"total"`
+		HasMore bool                     `json:"hasMore"`
+	}
+	if err := json.Unmarshal([]byte(result.Content[0].(mcpgolang.TextContent).Text), &response); err != nil {
+		t.Fatalf("first block isn't the JSON results: %v", err)
+	}
+	if response.Total != 1 || len(response.Results) != 1 || response.Results[0]["endpoint"] != "/users" {
+		t.Errorf("unexpected results %+v", response)
+	}
+
+	markdown := result.Content[1].(mcpgolang.TextContent).Text
+	if !strings.HasPrefix(markdown, "# Test History") || !strings.Contains(markdown, "| /users |") {
+		t.Errorf("second block isn't the markdown report:\n%s", markdown)
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // QuickPerformanceTestTool handles the quick_performance_test tool
@@ -22,7 +24,7 @@ func NewQuickPerformanceTestTool(deps *SharedDependencies) *QuickPerformanceTest
 }
 
 // Handle processes the quick_performance_test request
-func (t *QuickPerformanceTestTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+func (t *QuickPerformanceTestTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (toolResult *mcpgolang.CallToolResult, err error) {
 	composeSource, err := request.RequireString("composeSource")
 	if err != nil {
 		t.deps.Logger.LogError("Missing required composeSource", err, nil)
@@ -31,7 +33,38 @@ func (t *QuickPerformanceTestTool) Handle(ctx context.Context, request mcpgolang
 
 	vus := int(request.GetFloat("vus", 50))
 	duration := request.GetString("duration", "2m")
+	if err := ValidateLoad(vus, duration); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	p95ThresholdMs := request.GetFloat("p95ThresholdMs", DefaultP95ThresholdMs)
+	maxErrorRate := request.GetFloat("maxErrorRate", DefaultMaxErrorRate)
+	if err := ValidateThresholds(p95ThresholdMs, maxErrorRate); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
 	// targetService := request.GetString("targetService", "") // TODO: implement service targeting
+	dryRun := request.GetString("dryRun", "false") == "true"
+	keepContainers := KeepContainers(request.GetString("keepContainers", ""))
+	k6ExtraArgs, err := ParseK6ExtraArgs(request.GetString("k6ExtraArgs", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid k6ExtraArgs: %v", err)), nil
+	}
+	envVars, err := ParseK6EnvVars(request.GetString("envVars", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid envVars: %v", err)), nil
+	}
+
+	startupWait, err := StartupWait(request.GetString("startupWait", ""), DefaultStartupWait)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	profiles := ParseProfiles(request.GetString("profiles", ""))
+
+	maxDuration, err := MaxTestDuration(duration)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	// The wait counts against the run's limit
+	maxDuration += startupWait
 
 	t.deps.Logger.LogInfo("Starting quick performance test", map[string]interface{}{
 		"composeSource": composeSource,
@@ -41,19 +74,60 @@ func (t *QuickPerformanceTestTool) Handle(ctx context.Context, request mcpgolang
 	})
 
 	// Quick test - simpler flow
-	report := fmt.Sprintf("# Quick Performance Test\n\n")
-	report += fmt.Sprintf("- Target: %s\n", composeSource)
-	report += fmt.Sprintf("- VUs: %d\n", vus)
-	report += fmt.Sprintf("- Duration: %s\n\n", duration)
+	run := quickRun{Target: composeSource, VUs: vus, Duration: duration, Profiles: profiles}
+	report := ToolReport{Title: "Quick Performance Test", Status: "passed", Data: &run}
+	details := fmt.Sprintf("- Target: %s\n", composeSource)
+	details += fmt.Sprintf("- VUs: %d\n", vus)
+	details += fmt.Sprintf("- Duration: %s\n", duration)
+	if len(profiles) > 0 {
+		details += fmt.Sprintf("- Profiles: %s\n", strings.Join(profiles, ", "))
+	}
 
 	// Fetch and store compose
-	content, err := FetchComposeContent(composeSource)
+	content, err := FetchComposeContent(ctx, composeSource)
 	if err != nil {
 		t.deps.Logger.LogError("Failed to fetch compose content", err, map[string]interface{}{"composeSource": composeSource})
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to fetch compose: %v", err)), nil
 	}
 
-	composeFileId, err := StoreComposeFile(t.deps.DB, composeSource, content)
+	compose, warnings, err := ValidateCompose(content)
+	if err != nil {
+		t.deps.Logger.LogError("Compose validation failed", err, map[string]interface{}{"composeSource": composeSource})
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if err := ValidateProfiles(compose, profiles); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	for _, warning := range warnings {
+		details += fmt.Sprintf("- Warning: %s\n", warning)
+	}
+
+	// Simple test script
+	testScript := fmt.Sprintf(`import http from 'k6/http';
+import { check } from 'k6';
+
+export const options = {
+  %s
+};
+
+export default function () {
+  const res = http.get('http://localhost:8082/');
+  check(res, { 'status ok': (r) => r.status < 400 });
+}`, GenerateThresholds(p95ThresholdMs, maxErrorRate))
+
+	if dryRun {
+		args := append([]string{"run", "--vus", fmt.Sprintf("%d", vus), "--duration", duration, "--out", "json=<results file>"}, k6ExtraArgs...)
+		args = append(args, envVars.Masked().Args()...)
+		args = append(args, "script.js")
+		report.Status = "dry run"
+		report.Summary = DryRunNotice
+		report.AddSection("", details+fmt.Sprintf("- Command: `%s %s`\n", K6Binary(), strings.Join(args, " ")))
+		report.AddSection("Docker Compose", "```yaml\n"+strings.TrimRight(content, "\n")+"\n```")
+		report.AddSection("k6 Script", "```javascript\n"+testScript+"\n```")
+		return report.Result(), nil
+	}
+
+	composeFile, err := StoreComposeFile(t.deps.DB, composeSource, content)
 	if err != nil {
 		t.deps.Logger.LogError("Failed to store compose file", err, map[string]interface{}{"composeSource": composeSource})
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to store compose file: %v", err)), nil
@@ -61,13 +135,14 @@ func (t *QuickPerformanceTestTool) Handle(ctx context.Context, request mcpgolang
 
 	// Quick session
 	sessionName := fmt.Sprintf("quick-%d", time.Now().Unix())
-	result, err := t.deps.DB.Exec("INSERT INTO test_sessions (compose_file_id, session_name, status) VALUES (?, ?, ?)",
-		composeFileId, sessionName, "running")
+	sessionId, err := t.deps.DB.Insert("INSERT INTO test_sessions (compose_file_id, session_name, status, profiles) VALUES (?, ?, ?, ?)",
+		composeFile.ID, sessionName, "running", ProfilesColumn(profiles))
 	if err != nil {
 		t.deps.Logger.LogError("Failed to create session", err, map[string]interface{}{"sessionName": sessionName})
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to create session: %v", err)), nil
 	}
-	sessionId, _ := result.LastInsertId()
+	SetSpanAttributes(ctx, attribute.Int64("session.id", sessionId))
+	run.SessionID = sessionId
 
 	// Write and start
 	composePath, err := WriteComposeToTemp(content, sessionId)
@@ -77,15 +152,27 @@ func (t *QuickPerformanceTestTool) Handle(ctx context.Context, request mcpgolang
 	}
 	defer os.RemoveAll(filepath.Dir(composePath))
 
+	// Pull first, under its own timeout, so a slow pull neither counts
+	// against the run nor overlaps the wait for services to start
 	projectName := fmt.Sprintf("quick-%d", sessionId)
+	if err := PullImages(ctx, t.deps, composePath, projectName, profiles); err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to pull images: %v", err)), nil
+	}
+
+	// Bound the rest of the run so a client that gives up doesn't leave containers behind
+	ctx, cancel := context.WithTimeout(ctx, maxDuration)
+	defer cancel()
+
 	containerStart := time.Now()
-	startCmd := exec.CommandContext(ctx, "docker", "compose", "-f", composePath, "-p", projectName, "up", "-d")
-	containerOutput, err := startCmd.CombinedOutput()
+	project, ctx, containerOutput, err := StartComposeProject(ctx, t.deps, composePath, projectName, profiles)
 	if err != nil {
 		t.deps.Logger.LogContainerOperation("start", projectName, time.Since(containerStart), err, map[string]interface{}{
 			"output":     string(containerOutput),
 			"session_id": sessionId,
 		})
+		if ctx.Err() == context.DeadlineExceeded {
+			return mcpgolang.NewToolResultError(timeoutError(maxDuration, duration).Error()), nil
+		}
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to start containers: %v\n%s", err, containerOutput)), nil
 	}
 	t.deps.Logger.LogContainerOperation("start", projectName, time.Since(containerStart), nil, map[string]interface{}{
@@ -94,28 +181,39 @@ func (t *QuickPerformanceTestTool) Handle(ctx context.Context, request mcpgolang
 	})
 
 	defer func() {
+		if keepContainers {
+			if err := KeepProject(t.deps.DB, project, sessionId); err != nil {
+				t.deps.Logger.LogError("Failed to mark session left running", err, map[string]interface{}{
+					"session_id": sessionId,
+				})
+			}
+			// Reports carry the hint themselves; errors before the run get it appended
+			if toolResult != nil && toolResult.IsError && len(toolResult.Content) == 1 {
+				toolResult.Content = append(toolResult.Content, mcpgolang.NewTextContent(KeptProjectHint(projectName)))
+			}
+			return
+		}
+
 		stopStart := time.Now()
-		stopCmd := exec.Command("docker", "compose", "-f", composePath, "-p", projectName, "down", "-v")
-		err := stopCmd.Run()
+		err := project.Stop()
 		t.deps.Logger.LogContainerOperation("stop", projectName, time.Since(stopStart), err, map[string]interface{}{
 			"session_id": sessionId,
 		})
 	}()
 
 	t.deps.Logger.LogInfo("Waiting for services to start", map[string]interface{}{
-		"wait_time":  "10s",
+		"wait_time":  startupWait.String(),
 		"session_id": sessionId,
 	})
-	time.Sleep(10 * time.Second)
-
-	// Simple test script
-	testScript := `import http from 'k6/http';
-import { check } from 'k6';
-
-export default function () {
-  const res = http.get('http://localhost:8082/');
-  check(res, { 'status ok': (r) => r.status < 400 });
-}`
+	if err := WaitForStartup(ctx, startupWait); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return mcpgolang.NewToolResultError(timeoutError(maxDuration, duration).Error()), nil
+		}
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if err := CheckServicesStarted(t.deps, project); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
 
 	// Run quick test
 	tmpFile, err := os.CreateTemp("", "k6-quick-*.js")
@@ -127,25 +225,66 @@ export default function () {
 	tmpFile.Close()
 	defer os.Remove(tmpFile.Name())
 
+	resultsDir, err := ResultsDir()
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	outputFile := filepath.Join(resultsDir, fmt.Sprintf("k6-quick-%d.json", sessionId))
+
 	testStart := time.Now()
 	t.deps.Logger.LogInfo("Starting k6 test execution", map[string]interface{}{
 		"vus":         vus,
 		"duration":    duration,
 		"script_path": tmpFile.Name(),
+		"output_file": outputFile,
 		"session_id":  sessionId,
+		"env_vars":    envVars.Keys(),
 	})
 
-	k6Cmd := exec.CommandContext(ctx, "k6", "run", "--vus", fmt.Sprintf("%d", vus), "--duration", duration, tmpFile.Name())
-	output, err := k6Cmd.CombinedOutput()
+	args := append([]string{"run", "--vus", fmt.Sprintf("%d", vus), "--duration", duration,
+		"--out", fmt.Sprintf("json=%s", outputFile)}, k6ExtraArgs...)
+	args = append(args, envVars.Args()...)
+	k6Cmd := exec.CommandContext(ctx, K6Binary(), append(args, tmpFile.Name())...)
+	expected, _ := time.ParseDuration(duration)
+	stopProgress := TrackRunProgress(ctx, expected, func(data map[string]interface{}) {
+		data["session_id"] = sessionId
+		t.deps.SendProgress(ctx, "Running quick test", data)
+	})
+	output, stderr, err := RunK6(ctx, k6Cmd)
+	stopProgress()
 	testDuration := time.Since(testStart)
 
+	if ctx.Err() == context.DeadlineExceeded {
+		t.deps.Logger.LogError("k6 test timed out", ctx.Err(), map[string]interface{}{
+			"session_id":   sessionId,
+			"max_duration": maxDuration.String(),
+		})
+		return mcpgolang.NewToolResultError(timeoutError(maxDuration, duration).Error()), nil
+	}
+
 	if err != nil {
 		t.deps.Logger.LogError("k6 test execution failed", err, map[string]interface{}{
 			"session_id": sessionId,
 			"duration":   testDuration.String(),
 			"output":     string(output),
+			"stderr":     string(stderr),
 		})
-		return mcpgolang.NewToolResultError(fmt.Sprintf("k6 test failed: %v\n%s", err, output)), nil
+		report.Status = "failed"
+		report.Summary = "k6 test failed"
+		report.AddSection("", details)
+		report.AddSection("", K6Failure("k6 test failed", err, output, stderr))
+		// Quick runs have no run record, so the logs are only returned
+		if logs, logErr := project.ServiceLogs(); logErr == nil {
+			report.AddSection("", ServiceLogsSection(logs))
+		} else {
+			t.deps.Logger.LogError("Failed to collect service logs", logErr, map[string]interface{}{
+				"session_id": sessionId,
+			})
+		}
+		report.AddSection("", t.teardownNote(keepContainers, projectName))
+		result := report.Result()
+		result.IsError = true
+		return result, nil
 	}
 
 	t.deps.Logger.LogInfo("k6 test completed successfully", map[string]interface{}{
@@ -154,7 +293,31 @@ export default function () {
 		"output_size": len(output),
 	})
 
-	report += "## Results\n```\n" + string(output) + "\n```"
+	run.ResultsFile = outputFile
+	report.Summary = fmt.Sprintf("Quick test completed in %s", testDuration.Round(time.Second))
+	report.Artifacts = map[string]string{"results": outputFile}
+	report.AddMetric("duration_seconds", testDuration.Seconds())
+	report.AddSection("", details)
+	report.AddSection("Results", "```\n"+strings.TrimSpace(string(output))+"\n```")
+	report.AddSection("", t.teardownNote(keepContainers, projectName))
+
+	return report.Result(), nil
+}
+
+// quickRun is the data of a quick_performance_test report
+type quickRun struct {
+	Target      string   `json:"target"`
+	VUs         int      `json:"vus"`
+	Duration    string   `json:"duration"`
+	Profiles    []string `json:"profiles,omitempty"`
+	SessionID   int64    `json:"session_id,omitempty"`
+	ResultsFile string   `json:"results_file,omitempty"`
+}
 
-	return mcpgolang.NewToolResultText(report), nil
+// teardownNote tells how to reach containers that were left running
+func (t *QuickPerformanceTestTool) teardownNote(keepContainers bool, projectName string) string {
+	if !keepContainers {
+		return ""
+	}
+	return KeptProjectHint(projectName)
 }
@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// RerunTestTool handles the rerun_test tool
+type RerunTestTool struct {
+	deps *SharedDependencies
+}
+
+// NewRerunTestTool creates a new instance of RerunTestTool
+func NewRerunTestTool(deps *SharedDependencies) *RerunTestTool {
+	return &RerunTestTool{deps: deps}
+}
+
+// Handle processes the rerun_test request
+func (t *RerunTestTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	runId, err := request.RequireString("runId")
+	if err != nil {
+		return mcpgolang.NewToolResultError("Missing required runId"), nil
+	}
+
+	k6ExtraArgs, err := ParseK6ExtraArgs(request.GetString("k6ExtraArgs", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid k6ExtraArgs: %v", err)), nil
+	}
+	// Values aren't stored with runs, so secrets must be supplied again
+	envVars, err := ParseK6EnvVars(request.GetString("envVars", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid envVars: %v", err)), nil
+	}
+
+	tags, err := ParseRunTags(request.GetString("tags", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid tags: %v", err)), nil
+	}
+	metadata, err := ParseRunMetadata(request.GetString("gitSha", ""), request.GetString("buildId", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	startupWait, err := StartupWait(request.GetString("startupWait", ""), DefaultStartupWait)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	projectName := request.GetString("projectName", "")
+	if projectName != "" {
+		if err := ValidateProjectName(projectName); err != nil {
+			return mcpgolang.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	// Reuse the original run's test and load profile
+	var testId int64
+	var vus int
+	var duration string
+	err = t.deps.DB.QueryRow("SELECT test_id, vus, duration FROM test_runs WHERE id = ?", runId).Scan(&testId, &vus, &duration)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Run not found: %v", err)), nil
+	}
+
+	// The rerun keeps the original run's tags; tags given here override them
+	var originalRunId int64
+	fmt.Sscanf(runId, "%d", &originalRunId)
+	originalTags, err := LoadRunTags(t.deps.DB, originalRunId)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to load run tags: %v", err)), nil
+	}
+	for key, value := range tags {
+		originalTags[key] = value
+	}
+
+	// Likewise the build it tested, since the environment is the same; the
+	// compose hash and k6 version are those of the new run
+	originalMetadata, err := LoadRunMetadata(t.deps.DB, originalRunId)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to load run metadata: %v", err)), nil
+	}
+	if metadata.GitSha == "" {
+		metadata.GitSha = originalMetadata.GitSha
+	}
+	if metadata.BuildID == "" {
+		metadata.BuildID = originalMetadata.BuildID
+	}
+
+	t.deps.Logger.LogInfo("Re-running performance test", map[string]interface{}{
+		"original_run_id": runId,
+		"test_id":         testId,
+		"vus":             vus,
+		"duration":        duration,
+	})
+
+	// The test's session still points at the compose content the original
+	// run used, so the environment matches
+	run, err := NewRunPerformanceTestTool(t.deps).execute(ctx, fmt.Sprintf("%d", testId), vus, duration, runOptions{
+		MetricsOutput:    "json",
+		KeepContainers:   KeepContainers(request.GetString("keepContainers", "")),
+		K6ExtraArgs:      k6ExtraArgs,
+		EnvVars:          envVars,
+		Tags:             originalTags,
+		Metadata:         metadata,
+		StartupWait:      startupWait,
+		ProjectName:      projectName,
+		ReuseEnvironment: request.GetString("reuseEnvironment", "false") == "true",
+	})
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	run.Summary.RerunOf = originalRunId
+
+	return run.ToolResult(fmt.Sprintf("Original run ID: %d, new run ID: %d", originalRunId, run.Summary.RunID)), nil
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// ResetConfirmation is the confirm value reset_database requires
+const ResetConfirmation = "yes"
+
+// ResetDatabaseTool handles the reset_database tool
+type ResetDatabaseTool struct {
+	deps *SharedDependencies
+}
+
+// NewResetDatabaseTool creates a new instance of ResetDatabaseTool
+func NewResetDatabaseTool(deps *SharedDependencies) *ResetDatabaseTool {
+	return &ResetDatabaseTool{deps: deps}
+}
+
+// Handle processes the reset_database request
+func (t *ResetDatabaseTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	if request.GetString("confirm", "") != ResetConfirmation {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Refusing to reset the database: this deletes all test history. Pass confirm=%q to proceed.", ResetConfirmation)), nil
+	}
+	// Running tests would write their results into the dropped tables
+	if active := ActiveProjects(); len(active) > 0 {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Refusing to reset the database while tests are running: %s", strings.Join(active, ", "))), nil
+	}
+
+	counts, err := t.deps.DB.Reset()
+	if err != nil {
+		t.deps.Logger.LogError("Failed to reset database", err, nil)
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to reset database: %v", err)), nil
+	}
+	version, err := t.deps.DB.SchemaVersion()
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	report := "# Database Reset\n\nAll tables were dropped and recreated.\n\n"
+	report += "| Table | Rows removed |\n|---|---|\n"
+	var total int64
+	for _, table := range resetTables {
+		report += fmt.Sprintf("| %s | %d |\n", table, counts[table])
+		total += counts[table]
+	}
+	report += fmt.Sprintf("\nSchema version: %d\n", version)
+	report += "\nResult files in the results directory were left in place.\n"
+
+	t.deps.Logger.LogInfo("Database reset", map[string]interface{}{
+		"removed_rows":   total,
+		"schema_version": version,
+	})
+
+	return mcpgolang.NewToolResultText(report), nil
+}
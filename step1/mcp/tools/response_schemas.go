@@ -0,0 +1,282 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxSchemaDepth bounds how deeply nested response schemas are checked
+const maxSchemaDepth = 8
+
+// ResponseSchema is the part of an endpoint's response schema that generated
+// checks verify: types, required fields and nested properties. Constraints
+// such as formats and patterns are left out to keep the per-iteration cost low.
+type ResponseSchema struct {
+	Type       string                     `json:"type,omitempty"`
+	Nullable   bool                       `json:"nullable,omitempty"`
+	Required   []string                   `json:"required,omitempty"`
+	Properties map[string]*ResponseSchema `json:"properties,omitempty"`
+	Items      *ResponseSchema            `json:"items,omitempty"`
+}
+
+// ParseResponseSchemas reads the 2xx JSON response schema of each operation in
+// an OpenAPI 3 or Swagger 2 document, keyed by "METHOD path" with paths
+// prefixed as ParseSpecEndpoints does. Operations without one are left out.
+func ParseResponseSchemas(doc []byte, format string) (map[string]*ResponseSchema, error) {
+	var spec map[string]interface{}
+	var err error
+	if format == SpecFormatJSON {
+		err = json.Unmarshal(doc, &spec)
+	} else {
+		err = yaml.Unmarshal(doc, &spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s spec: %w", format, err)
+	}
+
+	basePath, _ := spec["basePath"].(string)
+	serverURL := ""
+	if servers, ok := spec["servers"].([]interface{}); ok && len(servers) > 0 {
+		if server, ok := servers[0].(map[string]interface{}); ok {
+			serverURL, _ = server["url"].(string)
+		}
+	}
+	prefix := specPathPrefix(basePath, serverURL)
+
+	schemas := map[string]*ResponseSchema{}
+	paths, _ := spec["paths"].(map[string]interface{})
+	for path, item := range paths {
+		operations, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for method, operation := range operations {
+			if !specMethods[strings.ToLower(method)] {
+				continue
+			}
+			node := successResponseSchema(spec, operation)
+			if node == nil {
+				continue
+			}
+			if schema := toResponseSchema(spec, node, map[string]bool{}, 0); schema != nil {
+				schemas[strings.ToUpper(method)+" "+prefix+path] = schema
+			}
+		}
+	}
+	return schemas, nil
+}
+
+// successResponseSchema returns the schema of an operation's first 2xx
+// response: the JSON content of an OpenAPI 3 response, or a Swagger 2
+// response's schema
+func successResponseSchema(spec map[string]interface{}, operation interface{}) interface{} {
+	op, ok := resolveRef(spec, operation, map[string]bool{}).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	// YAML reads unquoted status codes as integers, which yaml.v3 decodes
+	// into a map with interface{} keys
+	codes := map[string]interface{}{}
+	switch responses := op["responses"].(type) {
+	case map[string]interface{}:
+		for code, response := range responses {
+			codes[code] = response
+		}
+	case map[interface{}]interface{}:
+		for code, response := range responses {
+			codes[fmt.Sprint(code)] = response
+		}
+	}
+	keys := []string{}
+	for code := range codes {
+		if strings.HasPrefix(code, "2") {
+			keys = append(keys, code)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, code := range keys {
+		response, ok := resolveRef(spec, codes[code], map[string]bool{}).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if schema, ok := response["schema"]; ok {
+			return schema
+		}
+		content, ok := response["content"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		mediaTypes := []string{}
+		for mediaType := range content {
+			if strings.Contains(mediaType, "json") {
+				mediaTypes = append(mediaTypes, mediaType)
+			}
+		}
+		sort.Strings(mediaTypes)
+		for _, mediaType := range mediaTypes {
+			if media, ok := content[mediaType].(map[string]interface{}); ok && media["schema"] != nil {
+				return media["schema"]
+			}
+		}
+	}
+	return nil
+}
+
+// resolveRef follows local $refs such as "#/components/schemas/User",
+// returning nil for external or circular ones
+func resolveRef(spec map[string]interface{}, node interface{}, seen map[string]bool) interface{} {
+	for {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return node
+		}
+		ref, ok := object["$ref"].(string)
+		if !ok {
+			return node
+		}
+		if seen[ref] || !strings.HasPrefix(ref, "#/") {
+			return nil
+		}
+		seen[ref] = true
+
+		var target interface{} = spec
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			parent, ok := target.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			target = parent[part]
+		}
+		node = target
+	}
+}
+
+// toResponseSchema reduces a JSON Schema to a ResponseSchema. A nil result
+// means the value isn't checked, as for oneOf/anyOf or circular references.
+func toResponseSchema(spec map[string]interface{}, node interface{}, seen map[string]bool, depth int) *ResponseSchema {
+	if depth > maxSchemaDepth {
+		return nil
+	}
+	// Each branch of the schema tracks its own references, so a type used
+	// twice isn't mistaken for a cycle
+	branch := map[string]bool{}
+	for ref := range seen {
+		branch[ref] = true
+	}
+	object, ok := resolveRef(spec, node, branch).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if object["oneOf"] != nil || object["anyOf"] != nil {
+		return nil
+	}
+
+	schema := &ResponseSchema{}
+	if nullable, ok := object["nullable"].(bool); ok {
+		schema.Nullable = nullable
+	}
+	if nullable, ok := object["x-nullable"].(bool); ok {
+		schema.Nullable = schema.Nullable || nullable
+	}
+	switch t := object["type"].(type) {
+	case string:
+		schema.Type = t
+	case []interface{}:
+		// OpenAPI 3.1 writes nullable types as ["string", "null"]
+		for _, name := range t {
+			if name == "null" {
+				schema.Nullable = true
+			} else if name, ok := name.(string); ok && schema.Type == "" {
+				schema.Type = name
+			}
+		}
+	}
+
+	// allOf combines the required fields and properties of its parts
+	parts := []map[string]interface{}{object}
+	if allOf, ok := object["allOf"].([]interface{}); ok {
+		for _, part := range allOf {
+			if part, ok := resolveRef(spec, part, branch).(map[string]interface{}); ok {
+				parts = append(parts, part)
+			}
+		}
+	}
+	for _, part := range parts {
+		if required, ok := part["required"].([]interface{}); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					schema.Required = append(schema.Required, name)
+				}
+			}
+		}
+		if properties, ok := part["properties"].(map[string]interface{}); ok {
+			if schema.Properties == nil {
+				schema.Properties = map[string]*ResponseSchema{}
+			}
+			for name, property := range properties {
+				if property := toResponseSchema(spec, property, branch, depth+1); property != nil {
+					schema.Properties[name] = property
+				}
+			}
+		}
+	}
+	if schema.Type == "" && (schema.Properties != nil || schema.Required != nil) {
+		schema.Type = "object"
+	}
+	if schema.Type == "array" {
+		schema.Items = toResponseSchema(spec, object["items"], branch, depth+1)
+	}
+	return schema
+}
+
+// ResponseSchemaValidator is the JavaScript generated checks call to compare
+// a response body with a ResponseSchema
+const ResponseSchemaValidator = `
+// Checks a 2xx response's body against the endpoint's schema; other
+// responses are left to the status check
+function bodyMatchesSchema(res, schema) {
+  if (!schema || res.status < 200 || res.status >= 300) {
+    return true;
+  }
+  try {
+    return matchesSchema(res.json(), schema);
+  } catch (e) {
+    return false;
+  }
+}
+
+// Compares a response body with the spec's schema: types and required fields
+function matchesSchema(value, schema) {
+  if (value === null) {
+    return !schema.type || !!schema.nullable;
+  }
+  switch (schema.type) {
+    case 'array':
+      return Array.isArray(value) && (!schema.items || value.every((item) => matchesSchema(item, schema.items)));
+    case 'integer':
+      return Number.isInteger(value);
+    case 'number':
+      return typeof value === 'number';
+    case 'string':
+    case 'boolean':
+      return typeof value === schema.type;
+    case 'object':
+      if (typeof value !== 'object' || Array.isArray(value)) {
+        return false;
+      }
+  }
+  if (typeof value !== 'object' || Array.isArray(value)) {
+    return true;
+  }
+  const properties = schema.properties || {};
+  return (schema.required || []).every((key) => key in value) &&
+    Object.keys(properties).every((key) => !(key in value) || matchesSchema(value[key], properties[key]));
+}
+`
@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// K6InterruptGrace is how long k6 gets to stop once its run is cancelled, by
+// server shutdown or the run's timeout, before it is killed. On SIGINT k6
+// stops its executors, then writes its summary and closes its outputs.
+const K6InterruptGrace = 10 * time.Second
+
+// RunShutdownWait bounds how long shutdown waits for interrupted runs to
+// record their results: k6's grace, plus time to parse what it wrote
+const RunShutdownWait = K6InterruptGrace + 20*time.Second
+
+// RunStatusInterrupted is the status of a run cut short by server shutdown.
+// Other runs have no status unless they timed out; their exit code tells how
+// they ended.
+const RunStatusInterrupted = "interrupted"
+
+// RunStatusTimedOut is the status of a run stopped at its timeout
+const RunStatusTimedOut = "timed out"
+
+var (
+	shuttingDown atomic.Bool
+
+	activeRunsMu sync.Mutex
+	activeRuns   = make(map[int64]bool)
+	activeRunsWg sync.WaitGroup
+)
+
+// BeginShutdown records that the server is shutting down, so runs cancelled
+// from now on are recorded as interrupted rather than failed. Call it before
+// cancelling the context the tools run under.
+func BeginShutdown() {
+	shuttingDown.Store(true)
+}
+
+// RunInterrupted reports whether a run under ctx was cancelled by shutdown
+func RunInterrupted(ctx context.Context) bool {
+	return shuttingDown.Load() && ctx.Err() == context.Canceled
+}
+
+// TrackRun registers a recorded run until the returned function is called,
+// once its results are stored, so shutdown can wait for it
+func TrackRun(runId int64) func() {
+	activeRunsMu.Lock()
+	activeRuns[runId] = true
+	activeRunsMu.Unlock()
+	activeRunsWg.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			activeRunsMu.Lock()
+			delete(activeRuns, runId)
+			activeRunsMu.Unlock()
+			activeRunsWg.Done()
+		})
+	}
+}
+
+// WaitForRuns waits up to timeout for tracked runs to finish recording and
+// returns the ids of those that didn't
+func WaitForRuns(timeout time.Duration) []int64 {
+	done := make(chan struct{})
+	go func() {
+		activeRunsWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	activeRunsMu.Lock()
+	defer activeRunsMu.Unlock()
+	pending := make([]int64, 0, len(activeRuns))
+	for runId := range activeRuns {
+		pending = append(pending, runId)
+	}
+	return pending
+}
+
+// MarkRunInterrupted sets a recorded run's status to interrupted
+func MarkRunInterrupted(db *DB, runId int64) error {
+	_, err := db.Exec("UPDATE test_runs SET status = ? WHERE id = ?", RunStatusInterrupted, runId)
+	return err
+}
+
+// SalvageRun records a run k6 didn't finish, such as one that shutdown
+// interrupted before its results were stored or one stopped at its timeout:
+// it is completed with status, and the metrics k6 wrote before it stopped
+// are parsed from its results file. A run that was completed in the
+// meantime is left alone.
+func SalvageRun(db *DB, runId int64, status string) error {
+	result, err := db.Exec("UPDATE test_runs SET completed_at = CURRENT_TIMESTAMP, status = ? WHERE id = ? AND completed_at IS NULL",
+		status, runId)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	resultsDir, err := ResultsDir()
+	if err != nil {
+		return err
+	}
+	outputFile := K6ResultsPath(resultsDir, runId)
+	if _, err := os.Stat(outputFile); err != nil {
+		// k6 never got as far as writing results
+		return nil
+	}
+	if _, err := db.Exec("UPDATE test_runs SET results_file = ? WHERE id = ?", outputFile, runId); err != nil {
+		return err
+	}
+
+	var sessionId int64
+	if err := db.QueryRow("SELECT t.session_id FROM test_runs r JOIN tests t ON r.test_id = t.id WHERE r.id = ?", runId).Scan(&sessionId); err != nil {
+		return err
+	}
+	if _, _, err := ParseAndStoreMetrics(db, runId, outputFile, SessionTargetService(db, sessionId)); err != nil {
+		return fmt.Errorf("failed to parse partial results: %w", err)
+	}
+	return nil
+}
+
+// RunStatus describes how a stored run ended: interrupted, timed out, or as
+// K6ExitStatus describes its exit code
+func RunStatus(status sql.NullString, exitCode sql.NullInt64) string {
+	if status.Valid && status.String != "" {
+		return status.String
+	}
+	return K6ExitStatus(exitCode)
+}
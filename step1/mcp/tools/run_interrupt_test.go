@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSalvageRunCompletesTimedOutRun(t *testing.T) {
+	db := openTestDB(t)
+	previous := settings
+	settings.ResultsDir = t.TempDir()
+	t.Cleanup(func() { settings = previous })
+
+	sessionId := mustInsert(t, db, "INSERT INTO test_sessions (session_name) VALUES ('timeout')")
+	testId := mustInsert(t, db, "INSERT INTO tests (session_id, name, type, script) VALUES (?, 'api-test', 'load', '')", sessionId)
+	runId := mustInsert(t, db, "INSERT INTO test_runs (test_id, vus, duration) VALUES (?, 10, '30s')", testId)
+
+	if err := SalvageRun(db, runId, RunStatusTimedOut); err != nil {
+		t.Fatalf("SalvageRun failed: %v", err)
+	}
+	// A run that is already completed keeps its status
+	if err := SalvageRun(db, runId, RunStatusInterrupted); err != nil {
+		t.Fatalf("second SalvageRun failed: %v", err)
+	}
+
+	var completedAt sql.NullString
+	var status sql.NullString
+	var exitCode sql.NullInt64
+	if err := db.QueryRow("SELECT completed_at, status, exit_code FROM test_runs WHERE id = ?", runId).Scan(&completedAt, &status, &exitCode); err != nil {
+		t.Fatalf("failed to read the run: %v", err)
+	}
+	if !completedAt.Valid {
+		t.Error("run was not completed")
+	}
+	if got := RunStatus(status, exitCode); got != RunStatusTimedOut {
+		t.Errorf("status = %q, want %q", got, RunStatusTimedOut)
+	}
+}
+
+func TestRunStatus(t *testing.T) {
+	tests := []struct {
+		status   sql.NullString
+		exitCode sql.NullInt64
+		want     string
+	}{
+		{exitCode: sql.NullInt64{Int64: 0, Valid: true}, want: "passed"},
+		{exitCode: sql.NullInt64{Int64: K6ThresholdsFailedExitCode, Valid: true}, want: "thresholds crossed"},
+		{exitCode: sql.NullInt64{Int64: 105, Valid: true}, want: "errored"},
+		{want: "unknown"},
+		{status: sql.NullString{String: RunStatusInterrupted, Valid: true}, exitCode: sql.NullInt64{Int64: 0, Valid: true}, want: RunStatusInterrupted},
+		{status: sql.NullString{String: RunStatusTimedOut, Valid: true}, want: RunStatusTimedOut},
+	}
+	for _, tt := range tests {
+		if got := RunStatus(tt.status, tt.exitCode); got != tt.want {
+			t.Errorf("RunStatus(%v, %v) = %q, want %q", tt.status, tt.exitCode, got, tt.want)
+		}
+	}
+}
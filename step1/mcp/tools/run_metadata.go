@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RunMetadata records what a run tested, so a result can be tied to the
+// build behind it. Unlike RunTags, it isn't for filtering: it is written once
+// when the run is recorded and never changed.
+type RunMetadata struct {
+	// ComposeHash is the SHA-256 of the compose file, as ComposeHash returns;
+	// unset for runs against a URL that was already running
+	ComposeHash string `json:"compose_hash,omitempty"`
+	// K6Version is the version of k6 that ran the test
+	K6Version string `json:"k6_version,omitempty"`
+	// GitSha and BuildID identify the build under test, as given by the caller
+	GitSha  string `json:"git_sha,omitempty"`
+	BuildID string `json:"build_id,omitempty"`
+}
+
+// MaxBuildIDLength caps buildId, which is stored with every run
+const MaxBuildIDLength = 200
+
+// gitShaRegex matches abbreviated and full SHA-1 and SHA-256 commit hashes
+var gitShaRegex = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+
+// ParseRunMetadata validates the gitSha and buildId parameters; the rest of
+// the metadata is filled in when the run is recorded
+func ParseRunMetadata(gitSha, buildId string) (RunMetadata, error) {
+	gitSha = strings.ToLower(strings.TrimSpace(gitSha))
+	if gitSha != "" && !gitShaRegex.MatchString(gitSha) {
+		return RunMetadata{}, fmt.Errorf("invalid gitSha %q: must be 7 to 64 hex digits", gitSha)
+	}
+	buildId = strings.TrimSpace(buildId)
+	if len(buildId) > MaxBuildIDLength {
+		return RunMetadata{}, fmt.Errorf("buildId is %d characters long, max %d", len(buildId), MaxBuildIDLength)
+	}
+	if strings.ContainsAny(buildId, "\r\n") {
+		return RunMetadata{}, fmt.Errorf("buildId must be a single line")
+	}
+	return RunMetadata{GitSha: gitSha, BuildID: buildId}, nil
+}
+
+// Empty reports whether nothing was recorded
+func (m RunMetadata) Empty() bool {
+	return m == RunMetadata{}
+}
+
+// Lines renders the metadata as markdown list items, one per recorded field
+func (m RunMetadata) Lines() string {
+	lines := ""
+	if m.GitSha != "" {
+		lines += fmt.Sprintf("- Git SHA: %s\n", m.GitSha)
+	}
+	if m.BuildID != "" {
+		lines += fmt.Sprintf("- Build ID: %s\n", m.BuildID)
+	}
+	if m.ComposeHash != "" {
+		lines += fmt.Sprintf("- Compose hash: %s\n", m.ComposeHash)
+	}
+	if m.K6Version != "" {
+		lines += fmt.Sprintf("- k6 version: %s\n", m.K6Version)
+	}
+	return lines
+}
+
+// StoreRunMetadata records the metadata of a run, completing it with the
+// installed k6 version, and returns what was stored
+func StoreRunMetadata(db *DB, runId int64, metadata RunMetadata) (RunMetadata, error) {
+	metadata.K6Version = K6Version()
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return metadata, err
+	}
+	if _, err := db.Exec("UPDATE test_runs SET metadata = ? WHERE id = ?", string(data), runId); err != nil {
+		return metadata, fmt.Errorf("failed to store run metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// LoadRunMetadata returns the metadata of a run, empty for runs recorded
+// before metadata was
+func LoadRunMetadata(db *DB, runId int64) (RunMetadata, error) {
+	var data sql.NullString
+	if err := db.QueryRow("SELECT metadata FROM test_runs WHERE id = ?", runId).Scan(&data); err != nil {
+		return RunMetadata{}, err
+	}
+	var metadata RunMetadata
+	if !data.Valid {
+		return metadata, nil
+	}
+	if err := json.Unmarshal([]byte(data.String), &metadata); err != nil {
+		return RunMetadata{}, fmt.Errorf("invalid metadata stored for run %d: %w", runId, err)
+	}
+	return metadata, nil
+}
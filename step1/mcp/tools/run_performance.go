@@ -2,14 +2,20 @@ package tools
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // RunPerformanceTestTool handles the run_performance_test tool
@@ -29,108 +35,725 @@ func (t *RunPerformanceTestTool) Handle(ctx context.Context, request mcpgolang.C
 		return mcpgolang.NewToolResultError("Missing required testId"), nil
 	}
 
-	vus := int(request.GetFloat("vus", 10))
-	duration := request.GetString("duration", "30s")
+	// Without either, the test's own scenario runs as generated. A vus that
+	// was given is checked even without a duration, so vus=0 is an error
+	// rather than a silent fall back to the scenario.
+	_, vusGiven := request.GetArguments()["vus"]
+	vus := int(request.GetFloat("vus", 0))
+	duration := request.GetString("duration", "")
+	if vusGiven || duration != "" {
+		if !vusGiven {
+			vus = 10
+		}
+		if duration == "" {
+			duration = "30s"
+		}
+		if err := ValidateLoad(vus, duration); err != nil {
+			return mcpgolang.NewToolResultError(err.Error()), nil
+		}
+	}
+	metricsOutput := request.GetString("metricsOutput", "json")
+
+	switch metricsOutput {
+	case "json":
+	case "prometheus":
+		if os.Getenv("K6_PROMETHEUS_RW_SERVER_URL") == "" {
+			return mcpgolang.NewToolResultError("metricsOutput=prometheus requires K6_PROMETHEUS_RW_SERVER_URL to be set to the Prometheus remote-write endpoint (e.g. http://localhost:9090/api/v1/write)"), nil
+		}
+	default:
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid metricsOutput %q: must be json or prometheus", metricsOutput)), nil
+	}
 
-	// Get test script and session
-	var script string
-	var sessionId int64
-	err = t.deps.DB.QueryRow("SELECT script, session_id FROM tests WHERE id = ?", testId).Scan(&script, &sessionId)
+	outputs, err := ParseRunOutputs(request.GetString("outputs", ""))
 	if err != nil {
-		return mcpgolang.NewToolResultError(fmt.Sprintf("Test not found: %v", err)), nil
+		return mcpgolang.NewToolResultError(err.Error()), nil
 	}
 
-	// Get compose file content
-	var content string
-	err = t.deps.DB.QueryRow(`
-		SELECT cf.content 
-		FROM compose_files cf
-		JOIN test_sessions ts ON ts.compose_file_id = cf.id
-		WHERE ts.id = ?`, sessionId).Scan(&content)
+	k6ExtraArgs, err := ParseK6ExtraArgs(request.GetString("k6ExtraArgs", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid k6ExtraArgs: %v", err)), nil
+	}
+	envVars, err := ParseK6EnvVars(request.GetString("envVars", ""))
 	if err != nil {
-		return mcpgolang.NewToolResultError(fmt.Sprintf("Compose file not found: %v", err)), nil
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid envVars: %v", err)), nil
+	}
+	tags, err := ParseRunTags(request.GetString("tags", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid tags: %v", err)), nil
+	}
+	metadata, err := ParseRunMetadata(request.GetString("gitSha", ""), request.GetString("buildId", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	startupWait, err := StartupWait(request.GetString("startupWait", ""), DefaultStartupWait)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	projectName := request.GetString("projectName", "")
+	if projectName != "" {
+		if err := ValidateProjectName(projectName); err != nil {
+			return mcpgolang.NewToolResultError(err.Error()), nil
+		}
+	}
+	opts := runOptions{
+		MetricsOutput:    metricsOutput,
+		Outputs:          outputs,
+		KeepContainers:   KeepContainers(request.GetString("keepContainers", "")),
+		K6ExtraArgs:      k6ExtraArgs,
+		EnvVars:          envVars,
+		Tags:             tags,
+		Metadata:         metadata,
+		StartupWait:      startupWait,
+		ProjectName:      projectName,
+		ReuseEnvironment: request.GetString("reuseEnvironment", "false") == "true",
+	}
+
+	if request.GetString("dryRun", "false") == "true" {
+		return t.dryRun(testId, vus, duration, opts)
 	}
 
-	// Write compose to temp location
-	composePath, err := WriteComposeToTemp(content, sessionId)
+	run, err := t.execute(ctx, testId, vus, duration, opts)
 	if err != nil {
-		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to write compose file: %v", err)), nil
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	return run.ToolResult(fmt.Sprintf("Run ID: %d", run.Summary.RunID)), nil
+}
+
+// PerformanceRun is the outcome of a completed k6 run
+type PerformanceRun struct {
+	Output  []byte
+	Stderr  []byte
+	Summary RunSummary
+	// KeptProject names the compose project when containers were left running
+	KeptProject string
+	// Reused is set when the run used a project that was already running
+	Reused bool
+	// NoContainers is set for runs against a URL that was already running
+	NoContainers bool
+	// ServiceLogs is the excerpt of container logs collected for a failed run
+	ServiceLogs string
+	// IgnoredVUs is the vus asked for a test that ran its own scenarios
+	IgnoredVUs int
+}
+
+// Report builds the run's report: the status and notes, followed by the k6
+// console output, with the RunSummary as its data
+func (r *PerformanceRun) Report(heading string) ToolReport {
+	report := ToolReport{Title: "Performance Test", Status: "passed", Data: r.Summary}
+	status := "Test completed"
+	if r.Summary.Interrupted {
+		report.Status = RunStatusInterrupted
+		status = "Test interrupted by server shutdown; its partial results were recorded"
+	} else if !r.Summary.Passed {
+		report.Status = "thresholds crossed"
+		status = "Test completed with threshold failures"
+	}
+	report.Summary = fmt.Sprintf("%s. %s", status, heading)
+
+	var requests int64
+	for _, e := range r.Summary.Endpoints {
+		requests += int64(e.Requests)
+	}
+	report.AddMetric("endpoints", float64(len(r.Summary.Endpoints)))
+	report.AddMetric("requests", float64(requests))
+	if r.Summary.DroppedIterations > 0 {
+		report.AddMetric("dropped_iterations", float64(r.Summary.DroppedIterations))
+	}
+	report.Artifacts = r.Summary.Artifacts
+
+	teardown := "Containers have been stopped and removed."
+	if r.KeptProject != "" {
+		teardown = KeptProjectHint(r.KeptProject)
+		if r.Reused {
+			teardown = fmt.Sprintf("Reused the running compose project %s, skipping its start.\n", r.KeptProject) + teardown
+		}
+	} else if r.NoContainers {
+		teardown = ""
+	}
+	report.AddSection("", teardown)
+	if r.IgnoredVUs > 0 {
+		report.AddSection("", ScenarioLoadNote(r.IgnoredVUs))
+	}
+	if stderr := strings.TrimSpace(string(r.Stderr)); !r.Summary.Passed && stderr != "" {
+		// k6 names the crossed thresholds on stderr
+		report.AddSection("stderr", "```\n"+stderr+"\n```")
+	}
+	if len(r.Summary.Screenshots) > 0 {
+		report.AddSection("", ScreenshotsSection(r.Summary.Screenshots))
 	}
-	defer os.RemoveAll(filepath.Dir(composePath))
+	if len(r.Summary.CustomMetrics) > 0 {
+		report.AddSection("Custom Metrics", CustomMetricsSection(r.Summary.CustomMetrics))
+	}
+	report.AddSection("", DroppedIterationsWarning(r.Summary.DroppedIterations))
+	if r.ServiceLogs != "" {
+		report.AddSection("", ServiceLogsSection(r.ServiceLogs))
+	}
+	if output := strings.TrimSpace(string(r.Output)); output != "" {
+		report.AddSection("k6 Output", "```\n"+output+"\n```")
+	}
+	return report
+}
+
+// ToolResult renders the run's report as markdown followed by a JSON block
+func (r *PerformanceRun) ToolResult(heading string) *mcpgolang.CallToolResult {
+	return r.Report(heading).Result()
+}
+
+// storedTest is a generated test as loaded for a run
+type storedTest struct {
+	Type      string
+	Script    string
+	SessionID int64
+	TestData  sql.NullString
+	VUs       int
+	Duration  string
+	// IgnoredVUs is the vus asked for a script that defines its own scenarios
+	IgnoredVUs int
+}
+
+// scenariosRegex matches the scenarios block of a script's options
+var scenariosRegex = regexp.MustCompile(`(?m)^\s*scenarios\s*:`)
 
-	// Start Docker Compose environment
-	projectName := fmt.Sprintf("perftest-%d", time.Now().Unix())
-	containerStart := time.Now()
-	startCmd := exec.CommandContext(ctx, "docker", "compose", "-f", composePath, "-p", projectName, "up", "-d")
-	containerOutput, err := startCmd.CombinedOutput()
+// ScriptUsesScenarios reports whether a k6 script defines its own scenarios
+func ScriptUsesScenarios(script string) bool {
+	return scenariosRegex.MatchString(script)
+}
+
+// scriptVUsRegex matches the VU counts a script's options declare
+var scriptVUsRegex = regexp.MustCompile(`\b(?:vus|preAllocatedVUs|maxVUs)\s*:\s*(\d+)`)
+
+// stageTargetRegex matches stage targets, which are VUs unless the script
+// uses an arrival-rate executor
+var stageTargetRegex = regexp.MustCompile(`\btarget\s*:\s*(\d+)`)
+
+// ScriptVUs returns the largest VU count a script declares in its options,
+// or 0 when it declares none. VUs computed at runtime can't be seen, so this
+// is a check against typos and oversized imports, not a guarantee.
+func ScriptVUs(script string) int {
+	matches := scriptVUsRegex.FindAllStringSubmatch(script, -1)
+	if !strings.Contains(script, "arrival-rate") {
+		matches = append(matches, stageTargetRegex.FindAllStringSubmatch(script, -1)...)
+	}
+	peak := 0
+	for _, match := range matches {
+		if vus, err := strconv.Atoi(match[1]); err == nil {
+			peak = max(peak, vus)
+		}
+	}
+	return peak
+}
+
+// ScenarioLoadNote explains why a run didn't use the vus it was given
+func ScenarioLoadNote(vus int) string {
+	return fmt.Sprintf("Note: the requested load (vus=%d) was not applied. The test defines its own scenarios, which k6's --vus/--duration flags would replace, executor options and all, so the scenarios ran as written. Generate the test again with the load you want.", vus)
+}
+
+// loadTest reads a stored test and resolves the load it will run with. A vus
+// of 0 runs the scenario defined in the script, since k6's --vus/--duration
+// flags would replace it; duration then only bounds the run and defaults to
+// the test's stored scenario length. Scripts with a scenarios block always
+// run as written.
+func (t *RunPerformanceTestTool) loadTest(testId string, vus int, duration string) (*storedTest, error) {
+	test := &storedTest{VUs: vus, Duration: duration}
+	var scenarioDuration sql.NullString
+	err := t.deps.DB.QueryRow("SELECT type, script, session_id, test_data, scenario_duration FROM tests WHERE id = ?", testId).Scan(&test.Type, &test.Script, &test.SessionID, &test.TestData, &scenarioDuration)
 	if err != nil {
-		t.deps.Logger.LogContainerOperation("start", projectName, time.Since(containerStart), err, map[string]interface{}{
-			"output":  string(containerOutput),
-			"test_id": testId,
-		})
-		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to start containers: %v\n%s", err, containerOutput)), nil
+		return nil, fmt.Errorf("Test not found: %v", err)
 	}
-	t.deps.Logger.LogContainerOperation("start", projectName, time.Since(containerStart), nil, map[string]interface{}{
-		"test_id":      testId,
-		"compose_path": composePath,
-	})
 
-	// Ensure we clean up containers at the end
-	defer func() {
-		stopStart := time.Now()
-		stopCmd := exec.Command("docker", "compose", "-f", composePath, "-p", projectName, "down", "-v")
-		err := stopCmd.Run()
-		t.deps.Logger.LogContainerOperation("stop", projectName, time.Since(stopStart), err, map[string]interface{}{
-			"test_id": testId,
-		})
-	}()
+	if ScriptUsesScenarios(test.Script) {
+		if test.VUs > 0 {
+			test.IgnoredVUs = test.VUs
+			test.VUs = 0
+		}
+		if test.Duration == "" {
+			test.Duration = scenarioDuration.String
+		}
+		if test.Duration == "" {
+			// Browser tests run a single iteration and store no scenario length
+			test.Duration = "30s"
+		}
+	} else if test.VUs == 0 {
+		if !scenarioDuration.Valid {
+			// Tests without a stored scenario keep the original fixed load
+			test.VUs = 10
+			test.Duration = "30s"
+		} else if test.Duration == "" {
+			test.Duration = scenarioDuration.String
+		}
+	}
 
-	// Wait for services to be ready
-	time.Sleep(10 * time.Second)
+	// The limit may have been lowered since the test was generated or the
+	// run being repeated was made
+	if test.VUs > 0 {
+		err = CheckVULimit("vus", test.VUs)
+	} else {
+		err = CheckVULimit(fmt.Sprintf("The VUs test %s declares", testId), ScriptVUs(test.Script))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return test, nil
+}
 
-	// Write script to temp file
-	tmpFile, err := os.CreateTemp("", "k6-test-*.js")
+// sessionCompose returns the compose file content stored for a session and
+// the profiles it was set up with. The content is empty for run_url_test
+// sessions, whose target is already running.
+func (t *RunPerformanceTestTool) sessionCompose(sessionId int64) (string, []string, error) {
+	var content, profiles sql.NullString
+	err := t.deps.DB.QueryRow(`
+		SELECT cf.content, ts.profiles
+		FROM test_sessions ts
+		LEFT JOIN compose_files cf ON ts.compose_file_id = cf.id
+		WHERE ts.id = ?`, sessionId).Scan(&content, &profiles)
 	if err != nil {
-		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to create temp file: %v", err)), nil
+		return "", nil, fmt.Errorf("Compose file not found: %v", err)
+	}
+	return content.String, ParseProfiles(profiles.String), nil
+}
+
+// Result files a run can keep; see ParseRunOutputs
+const (
+	RunOutputJSON    = "json"
+	RunOutputCSV     = "csv"
+	RunOutputSummary = "summary"
+)
+
+// RunOutputs are the result files run_performance_test can keep
+var RunOutputs = []string{RunOutputJSON, RunOutputCSV, RunOutputSummary}
+
+// ParseRunOutputs reads a comma-separated list of RunOutputs, defaulting to
+// json. The JSON output is written whatever is asked for, because the stored
+// metrics are parsed from it.
+func ParseRunOutputs(value string) ([]string, error) {
+	outputs := []string{}
+	for _, output := range strings.Split(value, ",") {
+		output = strings.TrimSpace(output)
+		if output == "" || slices.Contains(outputs, output) {
+			continue
+		}
+		if !slices.Contains(RunOutputs, output) {
+			return nil, fmt.Errorf("Invalid output %q: must be one of %s", output, strings.Join(RunOutputs, ", "))
+		}
+		outputs = append(outputs, output)
+	}
+	if len(outputs) == 0 {
+		outputs = []string{RunOutputJSON}
+	}
+	return outputs, nil
+}
+
+// runOptions control how a stored test is run, as opposed to the load it runs with
+type runOptions struct {
+	// MetricsOutput is json, or prometheus to also stream to remote write
+	MetricsOutput string
+	// Outputs are the RunOutputs to keep; none keeps json
+	Outputs []string
+	// KeepContainers leaves the compose project running for inspection
+	KeepContainers bool
+	// K6ExtraArgs are validated flags passed to k6 before the script path
+	K6ExtraArgs []string
+	// EnvVars are passed to k6 with -e for the script to read as __ENV.KEY
+	EnvVars K6EnvVars
+	// Tags label the run for filtering history
+	Tags RunTags
+	// Metadata identifies the build under test; the compose hash and k6
+	// version are added when the run is recorded
+	Metadata RunMetadata
+	// StartupWait is how long the compose services get to start; see StartupWait
+	StartupWait time.Duration
+	// ProjectName names the compose project; empty picks one per run
+	ProjectName string
+	// ReuseEnvironment runs against ProjectName if it is already running,
+	// and leaves the project running either way for the next run
+	ReuseEnvironment bool
+}
+
+// runFiles are the files k6 writes for a run
+type runFiles struct {
+	Results string
+	Summary string
+	// CSV is empty unless the csv output was asked for
+	CSV string
+}
+
+// k6RunArgs builds the k6 command line for a stored test run
+func k6RunArgs(vus int, duration string, files runFiles, scriptPath string, opts runOptions) []string {
+	args := []string{"run"}
+	if vus > 0 {
+		args = append(args, "--vus", fmt.Sprintf("%d", vus), "--duration", duration)
+	}
+	args = append(args,
+		"--out", fmt.Sprintf("json=%s", files.Results),
+		"--summary-export", files.Summary,
+		"--summary-trend-stats", K6SummaryTrendStats,
+	)
+	if files.CSV != "" {
+		args = append(args, "--out", fmt.Sprintf("csv=%s", files.CSV))
+	}
+	if opts.MetricsOutput == "prometheus" {
+		// JSON output is kept so aggregate metrics still land in SQLite;
+		// k6 reads the remote-write endpoint from K6_PROMETHEUS_RW_* env vars
+		args = append(args, "--out", "experimental-prometheus-rw")
+	}
+	args = append(args, opts.K6ExtraArgs...)
+	args = append(args, opts.EnvVars.Args()...)
+	return append(args, scriptPath)
+}
+
+// dryRun returns the compose file, k6 script and k6 command a run would use
+// without starting containers or recording a run
+func (t *RunPerformanceTestTool) dryRun(testId string, vus int, duration string, opts runOptions) (*mcpgolang.CallToolResult, error) {
+	test, err := t.loadTest(testId, vus, duration)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	content, profiles, err := t.sessionCompose(test.SessionID)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	opts.EnvVars = opts.EnvVars.Masked()
+	files := runFiles{Results: "<results file>", Summary: "<summary file>"}
+	if slices.Contains(opts.Outputs, RunOutputCSV) {
+		files.CSV = "<csv file>"
+	}
+	args := k6RunArgs(test.VUs, test.Duration, files, "script.js", opts)
+	report := fmt.Sprintf("# Dry Run: Test %s\n\n%s\n\n", testId, DryRunNotice)
+	if test.IgnoredVUs > 0 {
+		report += ScenarioLoadNote(test.IgnoredVUs) + "\n\n"
+	}
+	report += fmt.Sprintf("- Command: `%s %s`\n", K6Binary(), strings.Join(args, " "))
+	if test.TestData.Valid {
+		report += fmt.Sprintf("- Test data: %s is written next to the script\n", TestDataFileName)
+	}
+	if len(opts.Tags) > 0 {
+		report += fmt.Sprintf("- Tags: %s\n", opts.Tags)
+	}
+	report += opts.Metadata.Lines()
+	if len(profiles) > 0 {
+		report += fmt.Sprintf("- Compose profiles: %s\n", strings.Join(profiles, ", "))
+	}
+	if content != "" {
+		report += DryRunSection("Docker Compose", "yaml", content)
+	}
+	report += DryRunSection("k6 Script", "javascript", test.Script)
+	return mcpgolang.NewToolResultText(report), nil
+}
+
+// execute runs a stored test against its session's compose environment and
+// records the run; see loadTest for how vus and duration are resolved. With
+// opts.KeepContainers the compose project is left running for inspection.
+// Returned errors are suitable for showing to the client.
+func (t *RunPerformanceTestTool) execute(ctx context.Context, testId string, vus int, duration string, opts runOptions) (run *PerformanceRun, err error) {
+	test, err := t.loadTest(testId, vus, duration)
+	if err != nil {
+		return nil, err
+	}
+	script, sessionId, testData := test.Script, test.SessionID, test.TestData
+	vus, duration = test.VUs, test.Duration
+
+	maxDuration, err := MaxTestDuration(duration)
+	if err != nil {
+		return nil, err
+	}
+	// The startup wait counts against the run's limit
+	maxDuration += opts.StartupWait
+
+	content, profiles, err := t.sessionCompose(sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions without a compose file test a URL that is already running,
+	// so there is nothing to pull, start or stop
+	var project *ComposeProject
+	var runDir string
+	if content == "" {
+		runDir, err = RunTempDir(sessionId)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create run directory: %v", err)
+		}
+		defer os.RemoveAll(runDir)
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxDuration)
+		defer cancel()
+	} else {
+		// Write compose to temp location; err is not redeclared, so the
+		// deferred teardown below sees what execute returns
+		var composePath string
+		composePath, err = WriteComposeToTemp(content, sessionId)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to write compose file: %v", err)
+		}
+		runDir = filepath.Dir(composePath)
+		defer os.RemoveAll(runDir)
+
+		projectName := opts.ProjectName
+		if projectName == "" {
+			projectName = fmt.Sprintf("perftest-%d", time.Now().Unix())
+			if opts.ReuseEnvironment {
+				projectName = ReusedProjectName(sessionId)
+			}
+		}
+		var reused bool
+		if opts.ProjectName != "" || opts.ReuseEnvironment {
+			if reused, err = ProjectRunning(ctx, projectName); err != nil {
+				return nil, err
+			}
+			// Without reuse the run would tear down a project it didn't start
+			if reused && !opts.ReuseEnvironment {
+				return nil, fmt.Errorf("Compose project %s is already running; pass reuseEnvironment=true to run against it", projectName)
+			}
+		}
+
+		if reused {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, maxDuration)
+			defer cancel()
+
+			project, ctx = AttachComposeProject(ctx, composePath, projectName, profiles)
+			t.deps.Logger.LogInfo("Reusing running compose project", map[string]interface{}{
+				"project_name": projectName,
+				"test_id":      testId,
+			})
+		} else {
+			// Pull first, under its own timeout, so a slow pull neither counts
+			// against the run nor overlaps the wait for services to start
+			if err := PullImages(ctx, t.deps, composePath, projectName, profiles); err != nil {
+				return nil, fmt.Errorf("Failed to pull images: %v", err)
+			}
+
+			// Bound the rest of the run so a client that gives up doesn't leave containers behind
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, maxDuration)
+			defer cancel()
+
+			// Start Docker Compose environment
+			containerStart := time.Now()
+			var containerOutput []byte
+			project, ctx, containerOutput, err = StartComposeProject(ctx, t.deps, composePath, projectName, profiles)
+			if err != nil {
+				t.deps.Logger.LogContainerOperation("start", projectName, time.Since(containerStart), err, map[string]interface{}{
+					"output":  string(containerOutput),
+					"test_id": testId,
+				})
+				if ctx.Err() == context.DeadlineExceeded {
+					return nil, timeoutError(maxDuration, duration)
+				}
+				return nil, fmt.Errorf("Failed to start containers: %v\n%s", err, containerOutput)
+			}
+			t.deps.Logger.LogContainerOperation("start", projectName, time.Since(containerStart), nil, map[string]interface{}{
+				"test_id":      testId,
+				"compose_path": composePath,
+			})
+		}
+
+		// Ensure we clean up containers at the end, unless asked to keep
+		// them or to reuse them on the next run
+		defer func() {
+			if opts.KeepContainers || opts.ReuseEnvironment {
+				if err := KeepProject(t.deps.DB, project, sessionId); err != nil {
+					t.deps.Logger.LogError("Failed to mark session left running", err, map[string]interface{}{
+						"session_id": sessionId,
+					})
+				}
+				t.deps.Logger.LogInfo("Leaving containers running", map[string]interface{}{
+					"project_name": projectName,
+					"test_id":      testId,
+				})
+				if err != nil {
+					err = fmt.Errorf("%v\n\n%s", err, KeptProjectHint(projectName))
+				} else {
+					run.KeptProject = projectName
+					run.Reused = reused
+				}
+				return
+			}
+
+			stopStart := time.Now()
+			err := project.Stop()
+			t.deps.Logger.LogContainerOperation("stop", projectName, time.Since(stopStart), err, map[string]interface{}{
+				"test_id": testId,
+			})
+		}()
+
+		// A reused project's services are already up
+		if !reused {
+			if err := WaitForStartup(ctx, opts.StartupWait); err != nil {
+				if ctx.Err() == context.DeadlineExceeded {
+					return nil, timeoutError(maxDuration, duration)
+				}
+				return nil, err
+			}
+		}
+		if err := CheckServicesStarted(t.deps, project); err != nil {
+			return nil, err
+		}
+	}
+
+	// Write script into the run's temp dir so any data file sits beside it
+	tmpFile, err := os.CreateTemp(runDir, "k6-test-*.js")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create temp file: %v", err)
 	}
 	defer os.Remove(tmpFile.Name())
 
 	tmpFile.WriteString(script)
 	tmpFile.Close()
 
+	// Data-driven tests open() their CSV relative to the script
+	if testData.Valid {
+		dataPath := filepath.Join(filepath.Dir(tmpFile.Name()), TestDataFileName)
+		if err := os.WriteFile(dataPath, []byte(testData.String), 0644); err != nil {
+			return nil, fmt.Errorf("Failed to write test data: %v", err)
+		}
+		defer os.Remove(dataPath)
+	}
+
+	resultsDir, err := ResultsDir()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create test run record
-	result, _ := t.deps.DB.Exec("INSERT INTO test_runs (test_id, vus, duration) VALUES (?, ?, ?)",
+	runId, _ := t.deps.DB.Insert("INSERT INTO test_runs (test_id, vus, duration) VALUES (?, ?, ?)",
 		testId, vus, duration)
-	runId, _ := result.LastInsertId()
+	if err := StoreRunTags(t.deps.DB, runId, opts.Tags); err != nil {
+		t.deps.Logger.LogError("Failed to store run tags", err, map[string]interface{}{"run_id": runId})
+	}
+	if content != "" {
+		opts.Metadata.ComposeHash = ComposeHash(content)
+	}
+	metadata, err := StoreRunMetadata(t.deps.DB, runId, opts.Metadata)
+	if err != nil {
+		t.deps.Logger.LogError("Failed to store run metadata", err, map[string]interface{}{"run_id": runId})
+	}
+	defer TrackRun(runId)()
+	SetSpanAttributes(ctx,
+		attribute.Int64("session.id", sessionId),
+		attribute.String("test.id", testId),
+		attribute.Int64("run.id", runId))
 
 	// Run k6 test
-	outputFile := fmt.Sprintf("/tmp/k6-results-%d.json", runId)
-	cmd := exec.CommandContext(ctx, "k6", "run",
-		"--vus", fmt.Sprintf("%d", vus),
-		"--duration", duration,
-		"--out", fmt.Sprintf("json=%s", outputFile),
-		tmpFile.Name())
+	outputFile := K6ResultsPath(resultsDir, runId)
+	summaryFile := K6SummaryPath(resultsDir, runId)
+	files := runFiles{Results: outputFile, Summary: summaryFile}
+	if slices.Contains(opts.Outputs, RunOutputCSV) {
+		files.CSV = K6CSVPath(resultsDir, runId)
+	}
+
+	// Browser tests save screenshots to a directory per run; one given in
+	// envVars wins, but its screenshots aren't collected
+	var screenshotDir string
+	if test.Type == TestTypeBrowser {
+		screenshotDir = K6ScreenshotDir(resultsDir, runId)
+		if err := os.MkdirAll(screenshotDir, 0755); err != nil {
+			return nil, fmt.Errorf("Failed to create screenshot directory: %v", err)
+		}
+		envVars := K6EnvVars{ScreenshotDirEnv: screenshotDir}
+		for key, value := range opts.EnvVars {
+			envVars[key] = value
+		}
+		opts.EnvVars = envVars
+	}
+	screenshots := func() []string {
+		if screenshotDir == "" {
+			return nil
+		}
+		paths, err := StoreRunScreenshots(t.deps.DB, runId, screenshotDir)
+		if err != nil {
+			t.deps.Logger.LogError("Failed to store screenshots", err, map[string]interface{}{"run_id": runId})
+		}
+		return paths
+	}
+
+	args := k6RunArgs(vus, duration, files, tmpFile.Name(), opts)
+	cmd := exec.CommandContext(ctx, K6Binary(), args...)
 
 	testStart := time.Now()
 	t.deps.Logger.LogInfo("Starting k6 test execution", map[string]interface{}{
-		"test_id":     testId,
-		"run_id":      runId,
-		"vus":         vus,
-		"duration":    duration,
-		"output_file": outputFile,
+		"test_id":        testId,
+		"run_id":         runId,
+		"vus":            vus,
+		"duration":       duration,
+		"output_file":    outputFile,
+		"metrics_output": opts.MetricsOutput,
+		"k6_extra_args":  opts.K6ExtraArgs,
+		"env_vars":       opts.EnvVars.Keys(),
 	})
 
-	output, err := cmd.CombinedOutput()
+	// duration already covers every stage of staged tests
+	expected, _ := time.ParseDuration(duration)
+	stopProgress := TrackRunProgress(ctx, expected, func(data map[string]interface{}) {
+		data["test_id"] = testId
+		data["run_id"] = runId
+		t.deps.SendProgress(ctx, "Running k6 test", data)
+	})
+	output, stderr, err := RunK6(ctx, cmd)
+	stopProgress()
 	testDuration := time.Since(testStart)
 
+	if ctx.Err() == context.DeadlineExceeded {
+		t.deps.Logger.LogError("k6 test timed out", ctx.Err(), map[string]interface{}{
+			"test_id":      testId,
+			"run_id":       runId,
+			"max_duration": maxDuration.String(),
+		})
+		// k6 was interrupted rather than killed, so what it measured is
+		// recorded, and the run doesn't look like it is still going
+		t.deps.DB.Exec("UPDATE test_runs SET results = ?, stderr = ?, exit_code = ? WHERE id = ?", string(output), string(stderr), K6ExitCode(err), runId)
+		if err := SalvageRun(t.deps.DB, runId, RunStatusTimedOut); err != nil {
+			t.deps.Logger.LogError("Failed to record timed out run", err, map[string]interface{}{"run_id": runId})
+		}
+		if paths := screenshots(); len(paths) > 0 {
+			return nil, fmt.Errorf("%v\n\n%s", timeoutError(maxDuration, duration), ScreenshotsSection(paths))
+		}
+		return nil, timeoutError(maxDuration, duration)
+	}
+
+	// k6 exits with 99 when thresholds are crossed; the run itself completed
+	exitCode := K6ExitCode(err)
+	thresholdsPassed := true
+	if K6ThresholdsCrossed(err) {
+		thresholdsPassed = false
+		err = nil
+	}
+
+	// Shutdown interrupts k6, which still writes what it measured, so the
+	// partial results are recorded like a finished run's
+	interrupted := RunInterrupted(ctx)
+	if interrupted {
+		t.deps.Logger.LogInfo("k6 test interrupted by shutdown", map[string]interface{}{
+			"test_id":  testId,
+			"run_id":   runId,
+			"duration": testDuration.String(),
+		})
+		thresholdsPassed = false
+		err = nil
+	}
+
 	if err != nil {
 		t.deps.Logger.LogError("k6 test execution failed", err, map[string]interface{}{
 			"test_id":  testId,
 			"run_id":   runId,
 			"duration": testDuration.String(),
 			"output":   string(output),
+			"stderr":   string(stderr),
 		})
-		return mcpgolang.NewToolResultError(fmt.Sprintf("Test execution failed: %v\n%s", err, output)), nil
+		t.deps.DB.Exec("UPDATE test_runs SET results = ?, stderr = ?, exit_code = ? WHERE id = ?", string(output), string(stderr), exitCode, runId)
+		failure := K6Failure("Test execution failed", err, output, stderr)
+		if paths := screenshots(); len(paths) > 0 {
+			failure += "\n\n" + ScreenshotsSection(paths)
+		}
+		if project != nil {
+			if logs := CollectServiceLogs(t.deps, project, runId); logs != "" {
+				failure += "\n\n" + ServiceLogsSection(logs)
+			}
+		}
+		return nil, errors.New(failure)
 	}
 
 	// Convert testId string to int64 for logging
@@ -142,12 +765,78 @@ func (t *RunPerformanceTestTool) Handle(ctx context.Context, request mcpgolang.C
 		"output_size": len(output),
 	})
 
-	// Update test run
-	t.deps.DB.Exec("UPDATE test_runs SET completed_at = CURRENT_TIMESTAMP, results = ? WHERE id = ?",
-		string(output), runId)
+	// The NDJSON output is always kept, since metrics are parsed from it
+	artifacts := map[string]string{RunOutputJSON: outputFile}
+	if files.CSV != "" {
+		if _, err := os.Stat(files.CSV); err == nil {
+			artifacts[RunOutputCSV] = files.CSV
+		}
+	}
+
+	// Update test run, keeping the compact k6 summary when it was exported.
+	// It is stored with the run, so the file only stays if it was asked for.
+	var summaryExport sql.NullString
+	var droppedIterations int64
+	if content, err := os.ReadFile(summaryFile); err == nil {
+		summaryExport = sql.NullString{String: string(content), Valid: true}
+		if slices.Contains(opts.Outputs, RunOutputSummary) {
+			artifacts[RunOutputSummary] = summaryFile
+		} else {
+			os.Remove(summaryFile)
+		}
+		if summary, err := ParseK6Summary(content); err == nil {
+			droppedIterations = summary.DroppedIterations()
+		}
+	} else {
+		t.deps.Logger.LogError("Failed to read k6 summary export", err, map[string]interface{}{
+			"run_id":       runId,
+			"summary_file": summaryFile,
+		})
+	}
+	t.deps.DB.Exec("UPDATE test_runs SET completed_at = CURRENT_TIMESTAMP, results = ?, stderr = ?, summary = ?, results_file = ?, exit_code = ? WHERE id = ?",
+		string(output), string(stderr), summaryExport, outputFile, exitCode, runId)
+	if interrupted {
+		if err := MarkRunInterrupted(t.deps.DB, runId); err != nil {
+			t.deps.Logger.LogError("Failed to mark run interrupted", err, map[string]interface{}{"run_id": runId})
+		}
+	}
+
+	// Parse and store per-endpoint metrics
+	metrics, customMetrics, err := ParseAndStoreMetrics(t.deps.DB, runId, outputFile, SessionTargetService(t.deps.DB, test.SessionID))
+	if err != nil {
+		t.deps.Logger.LogError("Failed to parse k6 metrics", err, map[string]interface{}{
+			"run_id":      runId,
+			"output_file": outputFile,
+		})
+	}
+
+	// Containers are still up, so their logs can explain a failed run
+	var serviceLogs string
+	if project != nil && !interrupted && RunFailed(thresholdsPassed, metrics) {
+		serviceLogs = CollectServiceLogs(t.deps, project, runId)
+	}
 
-	// Parse and store metrics (simplified)
-	ParseAndStoreMetrics(t.deps.DB, runId, outputFile)
+	return &PerformanceRun{
+		Output:       output,
+		Stderr:       stderr,
+		ServiceLogs:  serviceLogs,
+		NoContainers: project == nil,
+		IgnoredVUs:   test.IgnoredVUs,
+		Summary: RunSummary{
+			RunID:     runId,
+			TestID:    testIdInt,
+			VUs:       vus,
+			Duration:  duration,
+			Passed:    thresholdsPassed,
+			Endpoints: SummarizeEndpoints(metrics),
 
-	return mcpgolang.NewToolResultText(fmt.Sprintf("Test completed. Run ID: %d\n\nContainers have been stopped and removed.\n\n%s", runId, output)), nil
+			Interrupted:       interrupted,
+			Artifacts:         artifacts,
+			DroppedIterations: droppedIterations,
+			Tags:              opts.Tags,
+			Metadata:          &metadata,
+			Screenshots:       screenshots(),
+			CustomMetrics:     customMetrics,
+		},
+	}, nil
 }
@@ -0,0 +1,40 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestRunPerformanceRejectsInvalidVUs(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]any
+	}{
+		{name: "zero vus without duration", args: map[string]any{"testId": "1", "vus": 0}},
+		{name: "negative vus without duration", args: map[string]any{"testId": "1", "vus": -3}},
+		{name: "zero vus with duration", args: map[string]any{"testId": "1", "vus": 0, "duration": "30s"}},
+	}
+
+	// The load is checked before the test is loaded, so no database is needed
+	tool := NewRunPerformanceTestTool(&SharedDependencies{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request mcpgolang.CallToolRequest
+			request.Params.Arguments = tt.args
+			result, err := tool.Handle(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Handle returned an error: %v", err)
+			}
+			if !result.IsError {
+				t.Fatal("expected an error result")
+			}
+			text := result.Content[0].(mcpgolang.TextContent).Text
+			if !strings.Contains(text, "vus must be at least 1") {
+				t.Errorf("error %q does not mention vus", text)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// GetRunResultsTool handles the get_run_results tool
+type GetRunResultsTool struct {
+	deps *SharedDependencies
+}
+
+// NewGetRunResultsTool creates a new instance of GetRunResultsTool
+func NewGetRunResultsTool(deps *SharedDependencies) *GetRunResultsTool {
+	return &GetRunResultsTool{deps: deps}
+}
+
+// Handle processes the get_run_results request
+func (t *GetRunResultsTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	runId, err := request.RequireString("runId")
+	if err != nil {
+		return mcpgolang.NewToolResultError("Missing required runId"), nil
+	}
+
+	format := request.GetString("format", "raw")
+	if format != "raw" && format != "summary" && format != "markdown" {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid format %q: must be raw, summary or markdown", format)), nil
+	}
+
+	var testId int64
+	var vus int
+	var duration, startedAt string
+	var completedAt, results, stderr, summaryExport, resultsFile, metadataJSON, status sql.NullString
+	var exitCode sql.NullInt64
+	err = t.deps.DB.QueryRow(`
+		SELECT test_id, vus, duration, started_at, completed_at, results, stderr, summary, results_file, exit_code, metadata, status
+		FROM test_runs
+		WHERE id = ?`, runId).Scan(&testId, &vus, &duration, &startedAt, &completedAt, &results, &stderr, &summaryExport, &resultsFile, &exitCode, &metadataJSON, &status)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Run not found: %v", err)), nil
+	}
+
+	// Runs recorded before metadata was have none
+	var metadata RunMetadata
+	if metadataJSON.Valid {
+		json.Unmarshal([]byte(metadataJSON.String), &metadata)
+	}
+
+	// Pretty-print the stored summary so it reads the same as a fresh export
+	summaryJSON := ""
+	if summaryExport.Valid {
+		var indented bytes.Buffer
+		if json.Indent(&indented, []byte(summaryExport.String), "", "  ") == nil {
+			summaryJSON = indented.String()
+		} else {
+			summaryJSON = summaryExport.String
+		}
+	}
+
+	switch format {
+	case "summary":
+		if summaryJSON == "" {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("No k6 summary stored for run %s", runId)), nil
+		}
+		return mcpgolang.NewToolResultText(summaryJSON), nil
+
+	case "markdown":
+		run := storedRun{
+			RunID:     runId,
+			TestID:    testId,
+			VUs:       vus,
+			Duration:  duration,
+			StartedAt: startedAt,
+			Metadata:  metadata,
+		}
+		details := fmt.Sprintf("- Test ID: %d\n", testId)
+		details += fmt.Sprintf("- VUs: %d\n", vus)
+		details += fmt.Sprintf("- Duration: %s\n", duration)
+		details += fmt.Sprintf("- Started: %s\n", startedAt)
+		if completedAt.Valid {
+			run.CompletedAt = completedAt.String
+			details += fmt.Sprintf("- Completed: %s\n", completedAt.String)
+		} else {
+			details += "- Completed: not completed\n"
+		}
+		if exitCode.Valid {
+			code := exitCode.Int64
+			run.ExitCode = &code
+			details += fmt.Sprintf("- k6 exit code: %d (%s)\n", exitCode.Int64, K6ExitStatus(exitCode))
+		}
+		switch RunStatus(status, exitCode) {
+		case RunStatusInterrupted:
+			details += "- Interrupted by server shutdown: the metrics cover only what ran before it\n"
+		case RunStatusTimedOut:
+			details += "- Timed out: the metrics cover only what ran before it was stopped\n"
+		}
+		if resultsFile.Valid {
+			run.ResultsFile = resultsFile.String
+			details += fmt.Sprintf("- Raw results file: %s\n", resultsFile.String)
+		}
+		details += metadata.Lines()
+
+		report := ToolReport{
+			Title:   fmt.Sprintf("Run %s", runId),
+			Status:  RunStatus(status, exitCode),
+			Summary: fmt.Sprintf("Run %s of test %d: %s", runId, testId, RunStatus(status, exitCode)),
+			Data:    &run,
+		}
+		if !completedAt.Valid {
+			report.Status = "not completed"
+			report.Summary = fmt.Sprintf("Run %s of test %d has not completed", runId, testId)
+		}
+		run.Status = report.Status
+		if resultsFile.Valid {
+			report.Artifacts = map[string]string{"results": resultsFile.String}
+		}
+		report.AddSection("", details)
+
+		if summaryExport.Valid {
+			if summary, err := ParseK6Summary([]byte(summaryExport.String)); err == nil {
+				report.AddSection("Summary", summary.Markdown())
+				if requests, ok := summary.Stat("http_reqs", "count"); ok {
+					report.AddMetric("requests", requests)
+				}
+				if p95, ok := summary.Stat("http_req_duration", "p(95)"); ok {
+					report.AddMetric("p95_ms", p95)
+				}
+			}
+		}
+
+		report.AddSection("Endpoints", t.endpointTable(runId))
+		if id, err := strconv.ParseInt(runId, 10, 64); err == nil {
+			if custom, err := LoadCustomMetrics(t.deps.DB, id); err == nil && len(custom) > 0 {
+				report.AddSection("Custom Metrics", CustomMetricsSection(custom))
+			}
+		}
+
+		if results.Valid {
+			report.AddSection("k6 Output", "```\n"+results.String+"\n```")
+		}
+		if stderr.Valid && stderr.String != "" {
+			report.AddSection("k6 stderr", "```\n"+stderr.String+"\n```")
+		}
+		return report.Result(), nil
+
+	default:
+		if !results.Valid {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("No output stored for run %s", runId)), nil
+		}
+		result := mcpgolang.NewToolResultText(results.String)
+		if stderr.Valid && stderr.String != "" {
+			result.Content = append(result.Content, mcpgolang.NewTextContent("stderr:\n"+stderr.String))
+		}
+		if summaryJSON != "" {
+			result.Content = append(result.Content, mcpgolang.NewTextContent(summaryJSON))
+		}
+		if exitCode.Valid {
+			result.Content = append(result.Content, mcpgolang.NewTextContent(
+				fmt.Sprintf("k6 exit code: %d (%s)", exitCode.Int64, K6ExitStatus(exitCode))))
+		}
+		switch RunStatus(status, exitCode) {
+		case RunStatusInterrupted:
+			result.Content = append(result.Content, mcpgolang.NewTextContent("Interrupted by server shutdown"))
+		case RunStatusTimedOut:
+			result.Content = append(result.Content, mcpgolang.NewTextContent("Timed out"))
+		}
+		if !metadata.Empty() {
+			data, _ := json.MarshalIndent(metadata, "", "  ")
+			result.Content = append(result.Content, mcpgolang.NewTextContent("metadata:\n"+string(data)))
+		}
+		return result, nil
+	}
+}
+
+// storedRun is the data of get_run_results' markdown report
+type storedRun struct {
+	RunID       string      `json:"run_id"`
+	TestID      int64       `json:"test_id"`
+	VUs         int         `json:"vus"`
+	Duration    string      `json:"duration"`
+	Status      string      `json:"status"`
+	StartedAt   string      `json:"started_at"`
+	CompletedAt string      `json:"completed_at,omitempty"`
+	ExitCode    *int64      `json:"exit_code,omitempty"`
+	ResultsFile string      `json:"results_file,omitempty"`
+	Metadata    RunMetadata `json:"metadata"`
+}
+
+// endpointTable renders the run's stored per-endpoint metrics as a markdown table
+func (t *GetRunResultsTool) endpointTable(runId string) string {
+	rows, err := t.deps.DB.Query(`
+		SELECT endpoint, avg_response_time, p95_response_time, error_rate, requests_per_second,
+		       CASE WHEN requests > 0 THEN CAST(data_received AS REAL) / requests END
+		FROM metrics
+		WHERE run_id = ?
+		ORDER BY endpoint`, runId)
+	if err != nil {
+		return ""
+	}
+	defer rows.Close()
+
+	table := ""
+	for rows.Next() {
+		var endpoint string
+		var avg, p95, errorRate, rps, responseBytes sql.NullFloat64
+		if err := rows.Scan(&endpoint, &avg, &p95, &errorRate, &rps, &responseBytes); err != nil {
+			continue
+		}
+		responseSize := "-"
+		if responseBytes.Valid {
+			responseSize = FormatBytes(responseBytes.Float64)
+		}
+		table += fmt.Sprintf("| %s | %.2f | %.2f | %.2f%% | %.2f | %s |\n",
+			endpoint, avg.Float64, p95.Float64, errorRate.Float64*100, rps.Float64, responseSize)
+	}
+	if table == "" {
+		return ""
+	}
+
+	return "| Endpoint | Avg (ms) | p95 (ms) | Error Rate | RPS | Avg Response |\n" +
+		"|----------|----------|----------|------------|-----|--------------|\n" + table
+}
@@ -0,0 +1,62 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestGetRunResultsMarkdownReport(t *testing.T) {
+	db := openTestDB(t)
+	sessionId := mustInsert(t, db, "INSERT INTO test_sessions (session_name, status) VALUES ('results', 'completed')")
+	testId := mustInsert(t, db, "INSERT INTO tests (session_id, name, type, script) VALUES (?, 'load', 'load', '')", sessionId)
+	runId := mustInsert(t, db, `INSERT INTO test_runs (test_id, vus, duration, completed_at, results, results_file, exit_code)
+		VALUES (?, 5, '30s', CURRENT_TIMESTAMP, 'k6 console output', '/tmp/k6-results.json', 99)`, testId)
+	mustInsert(t, db, `INSERT INTO metrics (run_id, endpoint, avg_response_time, p95_response_time, error_rate, requests_per_second)
+		VALUES (?, '/users', 12, 20, 0.01, 8)`, runId)
+
+	tool := NewGetRunResultsTool(&SharedDependencies{DB: db})
+	var request mcpgolang.CallToolRequest
+	request.Params.Arguments = map[string]any{"runId": fmt.Sprint(runId), "format": "markdown"}
+	result, err := tool.Handle(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("get_run_results failed: %v %+v", err, result)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("got %d content blocks, want markdown and JSON", len(result.Content))
+	}
+
+	markdown := result.Content[0].(mcpgolang.TextContent).Text
+	for _, want := range []string{fmt.Sprintf("# Run %d", runId), "## Endpoints", "| /users |", "## k6 Output", "k6 console output"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, markdown)
+		}
+	}
+
+	var report struct {
+		Status    string            `json:"status"`
+		Artifacts map[string]string `json:"artifacts"`
+		Data      struct {
+			TestID   int64  `json:"test_id"`
+			VUs      int    `json:"vus"`
+			Status   string `json:"status"`
+			ExitCode *int64 `json:"exit_code"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(result.Content[1].(mcpgolang.TextContent).Text), &report); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	if report.Status != "thresholds crossed" || report.Data.Status != report.Status {
+		t.Errorf("status = %q, data status = %q, want thresholds crossed", report.Status, report.Data.Status)
+	}
+	if report.Data.TestID != testId || report.Data.VUs != 5 || report.Data.ExitCode == nil || *report.Data.ExitCode != 99 {
+		t.Errorf("unexpected data %+v", report.Data)
+	}
+	if report.Artifacts["results"] != "/tmp/k6-results.json" {
+		t.Errorf("artifacts = %v", report.Artifacts)
+	}
+}
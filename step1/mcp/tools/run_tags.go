@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RunTags label a run, e.g. branch=main env=staging, so history can be
+// sliced by where and what it ran against
+type RunTags map[string]string
+
+// runTagKeyRegex matches tag names; values may be anything but empty
+var runTagKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_.\-/]+$`)
+
+// ParseRunTags parses whitespace-separated key=value pairs, quoted like
+// k6ExtraArgs, e.g. `branch=main env=staging "owner=perf team"`
+func ParseRunTags(value string) (RunTags, error) {
+	pairs, err := splitArgs(value)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := RunTags{}
+	for _, pair := range pairs {
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || val == "" {
+			return nil, fmt.Errorf("%q must be in key=value form", pair)
+		}
+		if !runTagKeyRegex.MatchString(key) {
+			return nil, fmt.Errorf("invalid tag name %q: use letters, digits and _ . - /", key)
+		}
+		tags[key] = val
+	}
+	return tags, nil
+}
+
+// Keys returns the tag names in sorted order
+func (r RunTags) Keys() []string {
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String renders the tags as key=value pairs in key order
+func (r RunTags) String() string {
+	pairs := make([]string, 0, len(r))
+	for _, key := range r.Keys() {
+		pairs = append(pairs, key+"="+r[key])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// Filter returns a condition, to be ANDed into a WHERE clause, matching runs
+// whose id is runColumn and that carry every tag, and its arguments
+func (r RunTags) Filter(runColumn string) (string, []interface{}) {
+	condition := ""
+	args := []interface{}{}
+	for _, key := range r.Keys() {
+		condition += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM run_tags rt WHERE rt.run_id = %s AND rt.key = ? AND rt.value = ?)", runColumn)
+		args = append(args, key, r[key])
+	}
+	return condition, args
+}
+
+// StoreRunTags records the tags of a run
+func StoreRunTags(db *DB, runId int64, tags RunTags) error {
+	for _, key := range tags.Keys() {
+		if _, err := db.Exec("INSERT INTO run_tags (run_id, key, value) VALUES (?, ?, ?)", runId, key, tags[key]); err != nil {
+			return fmt.Errorf("failed to store tag %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// LoadRunTags returns the tags of a run, empty if it has none
+func LoadRunTags(db *DB, runId int64) (RunTags, error) {
+	rows, err := db.Query("SELECT key, value FROM run_tags WHERE run_id = ?", runId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := RunTags{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// RunURLTestTool handles the run_url_test tool
+type RunURLTestTool struct {
+	deps *SharedDependencies
+}
+
+// NewRunURLTestTool creates a new instance of RunURLTestTool
+func NewRunURLTestTool(deps *SharedDependencies) *RunURLTestTool {
+	return &RunURLTestTool{deps: deps}
+}
+
+// Handle processes the run_url_test request
+func (t *RunURLTestTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	targetURL, err := request.RequireString("url")
+	if err != nil {
+		return mcpgolang.NewToolResultError("Missing required url"), nil
+	}
+	parsed, err := url.Parse(targetURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid url %q: must be an absolute http or https URL", targetURL)), nil
+	}
+	tlsOptions := NewTLSOptions(request.GetString("insecureSkipTLSVerify", "false"), request.GetString("http2", "false"))
+	if err := tlsOptions.CheckScheme(targetURL, parsed.Scheme); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	vus := int(request.GetFloat("vus", 50))
+	duration := request.GetString("duration", "2m")
+	if err := ValidateLoad(vus, duration); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	p95ThresholdMs := request.GetFloat("p95ThresholdMs", DefaultP95ThresholdMs)
+	maxErrorRate := request.GetFloat("maxErrorRate", DefaultMaxErrorRate)
+	if err := ValidateThresholds(p95ThresholdMs, maxErrorRate); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	outputs, err := ParseRunOutputs(request.GetString("outputs", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	k6ExtraArgs, err := ParseK6ExtraArgs(request.GetString("k6ExtraArgs", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid k6ExtraArgs: %v", err)), nil
+	}
+	envVars, err := ParseK6EnvVars(request.GetString("envVars", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid envVars: %v", err)), nil
+	}
+	tags, err := ParseRunTags(request.GetString("tags", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid tags: %v", err)), nil
+	}
+	metadata, err := ParseRunMetadata(request.GetString("gitSha", ""), request.GetString("buildId", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	opts := runOptions{
+		MetricsOutput: "json",
+		Outputs:       outputs,
+		K6ExtraArgs:   k6ExtraArgs,
+		EnvVars:       envVars,
+		Tags:          tags,
+		Metadata:      metadata,
+	}
+
+	script := urlTestScript(targetURL, p95ThresholdMs, maxErrorRate, tlsOptions)
+
+	if request.GetString("dryRun", "false") == "true" {
+		opts.EnvVars = opts.EnvVars.Masked()
+		args := k6RunArgs(vus, duration, runFiles{Results: "<results file>", Summary: "<summary file>"}, "script.js", opts)
+		report := fmt.Sprintf("# Dry Run: %s\n\nDry run: k6 was not run and no test run was recorded.\n\n", targetURL)
+		report += fmt.Sprintf("- Command: `%s %s`\n", K6Binary(), strings.Join(args, " "))
+		if len(tags) > 0 {
+			report += fmt.Sprintf("- Tags: %s\n", tags)
+		}
+		report += metadata.Lines()
+		report += DryRunSection("k6 Script", "javascript", script)
+		return mcpgolang.NewToolResultText(report), nil
+	}
+
+	t.deps.Logger.LogInfo("Starting URL test", map[string]interface{}{
+		"url":       targetURL,
+		"vus":       vus,
+		"duration":  duration,
+		"component": "run_url_test",
+	})
+
+	// The session has no compose file, which tells execute to skip Docker;
+	// reruns of the run do the same
+	sessionId, err := t.deps.DB.Insert("INSERT INTO test_sessions (session_name, status) VALUES (?, ?)",
+		fmt.Sprintf("url-%d", time.Now().Unix()), "running")
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to create session: %v", err)), nil
+	}
+	defer t.deps.DB.Exec("UPDATE test_sessions SET completed_at = CURRENT_TIMESTAMP, status = ? WHERE id = ?",
+		"completed", sessionId)
+
+	testId, err := t.deps.DB.Insert("INSERT INTO tests (session_id, name, type, script, scenario_duration) VALUES (?, ?, ?, ?, ?)",
+		sessionId, fmt.Sprintf("url-test-%s", time.Now().Format("20060102-150405")), "load", script, duration)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to store test: %v", err)), nil
+	}
+
+	run, err := NewRunPerformanceTestTool(t.deps).execute(ctx, fmt.Sprintf("%d", testId), vus, duration, opts)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	return run.ToolResult(fmt.Sprintf("Target: %s, run ID: %d", targetURL, run.Summary.RunID)), nil
+}
+
+// urlTestScript returns a k6 script that GETs targetURL on every iteration
+func urlTestScript(targetURL string, p95ThresholdMs, maxErrorRate float64, tlsOptions TLSOptions) string {
+	// A JSON string is a valid JavaScript string literal
+	literal, _ := json.Marshal(targetURL)
+	return fmt.Sprintf(`import http from 'k6/http';
+import { check } from 'k6';
+
+export const options = {
+  %s
+};
+
+const TARGET_URL = %s;
+
+export default function () {
+  const res = http.get(TARGET_URL);
+  check(res, { 'status ok': (r) => r.status < 400 });
+}`, tlsOptions.Apply(GenerateThresholds(p95ThresholdMs, maxErrorRate)), literal)
+}
@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TestTypeBrowser is the stored type of create_ui_test tests
+const TestTypeBrowser = "browser"
+
+// ScreenshotDirEnv names the directory browser test scripts save screenshots to
+const ScreenshotDirEnv = "SCREENSHOT_DIR"
+
+// K6ScreenshotDir returns where a browser test run saves its screenshots
+func K6ScreenshotDir(resultsDir string, runId int64) string {
+	return filepath.Join(resultsDir, fmt.Sprintf("k6-screenshots-%d", runId))
+}
+
+// StoreRunScreenshots records the screenshots a run saved in dir and returns
+// their paths. The directory is removed if the run saved none.
+func StoreRunScreenshots(db *DB, runId int64, dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		os.Remove(dir)
+		return nil, nil
+	}
+	for _, path := range paths {
+		if _, err := db.Exec("INSERT INTO run_screenshots (run_id, path) VALUES (?, ?)", runId, path); err != nil {
+			return paths, fmt.Errorf("failed to store screenshot %s: %w", path, err)
+		}
+	}
+	return paths, nil
+}
+
+// ScreenshotsSection lists a run's screenshots for the tool result
+func ScreenshotsSection(paths []string) string {
+	section := "Screenshots:\n"
+	for _, path := range paths {
+		section += fmt.Sprintf("- %s\n", path)
+	}
+	return section
+}
@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxTrendSessions caps how many sessions the session trend covers, since
+// each one's metrics are joined against its specs' SLAs
+const MaxTrendSessions = 100
+
+// SessionOutcome is how a session's runs fared against the SLAs declared in
+// its discovered specs
+type SessionOutcome struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+	TotalRuns int       `json:"total_runs"`
+	// SLAChecks counts the endpoint measurements checked against an SLA,
+	// response time and error rate separately
+	SLAChecks     int `json:"sla_checks"`
+	SLAViolations int `json:"sla_violations"`
+	// WorstP95Ms is the slowest endpoint p95 over all the session's runs,
+	// falling back to the average for metrics recorded before p95 was
+	WorstP95Ms *float64 `json:"worst_p95_ms,omitempty"`
+	// Compliance is the fraction of SLA checks that passed, unset when no
+	// run had an SLA to check
+	Compliance *float64 `json:"compliance,omitempty"`
+	// ComplianceChange and Trend compare Compliance with the previous
+	// session that had one
+	PreviousSessionID *int64   `json:"previous_session_id,omitempty"`
+	ComplianceChange  *float64 `json:"compliance_change,omitempty"`
+	Trend             string   `json:"trend,omitempty"`
+}
+
+// SessionOutcomes summarizes the page of sessions, newest first, with each
+// run's endpoints checked against the SLAs declared in the run's own session.
+// One more session than the page is read, so the oldest on the page can
+// still be compared with the session before it.
+func SessionOutcomes(db *DB, page Page) ([]SessionOutcome, error) {
+	if page.Limit > MaxTrendSessions {
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxTrendSessions)
+	}
+
+	rows, err := db.Query(`
+		SELECT id, session_name, started_at
+		FROM test_sessions
+		ORDER BY started_at DESC, id DESC
+		LIMIT ? OFFSET ?`, page.Limit+1, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []SessionOutcome{}
+	index := map[int64]int{}
+	for rows.Next() {
+		var s SessionOutcome
+		if err := rows.Scan(&s.ID, &s.Name, &s.StartedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[s.ID] = len(sessions)
+		sessions = append(sessions, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return sessions, nil
+	}
+
+	// The same window as above, so the joins only touch those sessions
+	window := "SELECT id FROM test_sessions ORDER BY started_at DESC, id DESC LIMIT ? OFFSET ?"
+
+	rows, err = db.Query(`
+		SELECT t.session_id, COUNT(r.id)
+		FROM test_runs r
+		JOIN tests t ON r.test_id = t.id
+		WHERE t.session_id IN (`+window+`)
+		GROUP BY t.session_id`, page.Limit+1, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var sessionId int64
+		var runs int
+		if err := rows.Scan(&sessionId, &runs); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sessions[index[sessionId]].TotalRuns = runs
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// As in analyze_results, the latest spec to declare an endpoint's SLA
+	// wins, but only the session's own specs count here
+	rows, err = db.Query(`
+		SELECT t.session_id, m.endpoint, m.avg_response_time, m.p95_response_time, m.error_rate,
+		       (SELECT e.sla_response_time FROM endpoints e JOIN api_specs a ON e.spec_id = a.id
+		        WHERE a.session_id = t.session_id AND e.path = m.endpoint AND e.sla_response_time IS NOT NULL
+		        ORDER BY e.id DESC LIMIT 1),
+		       (SELECT e.sla_error_rate FROM endpoints e JOIN api_specs a ON e.spec_id = a.id
+		        WHERE a.session_id = t.session_id AND e.path = m.endpoint AND e.sla_error_rate IS NOT NULL
+		        ORDER BY e.id DESC LIMIT 1)
+		FROM metrics m
+		JOIN test_runs r ON m.run_id = r.id
+		JOIN tests t ON r.test_id = t.id
+		WHERE t.session_id IN (`+window+`)`, page.Limit+1, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var sessionId int64
+		var e endpointAnalysis
+		if err := rows.Scan(&sessionId, &e.Endpoint, &e.AvgTime, &e.P95Time, &e.ErrorRate, &e.SLATime, &e.SLAError); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s := &sessions[index[sessionId]]
+		responseTime, _ := e.ResponseTime()
+		if s.WorstP95Ms == nil || responseTime > *s.WorstP95Ms {
+			s.WorstP95Ms = &responseTime
+		}
+		if e.SLATime.Valid {
+			s.SLAChecks++
+			if e.ResponseTimeViolated() {
+				s.SLAViolations++
+			}
+		}
+		if e.SLAError.Valid {
+			s.SLAChecks++
+			if e.ErrorRateViolated() {
+				s.SLAViolations++
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Oldest first, so each session is compared with the last one before it
+	// that had SLAs to check
+	var previous *SessionOutcome
+	for i := len(sessions) - 1; i >= 0; i-- {
+		s := &sessions[i]
+		if s.SLAChecks == 0 {
+			continue
+		}
+		compliance := 1 - float64(s.SLAViolations)/float64(s.SLAChecks)
+		s.Compliance = &compliance
+		if previous != nil {
+			change := compliance - *previous.Compliance
+			s.PreviousSessionID = &previous.ID
+			s.ComplianceChange = &change
+			switch {
+			case change > 0:
+				s.Trend = TrendImproving
+			case change < 0:
+				s.Trend = TrendDegrading
+			default:
+				s.Trend = TrendStable
+			}
+		}
+		previous = s
+	}
+
+	if len(sessions) > page.Limit {
+		sessions = sessions[:page.Limit]
+	}
+	return sessions, nil
+}
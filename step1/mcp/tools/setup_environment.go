@@ -7,7 +7,7 @@ import (
 	"time"
 
 	mcpgolang "github.com/mark3labs/mcp-go/mcp"
-	"gopkg.in/yaml.v3"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // SetupEnvironmentTool handles the setup_test_environment tool
@@ -27,48 +27,64 @@ func (t *SetupEnvironmentTool) Handle(ctx context.Context, request mcpgolang.Cal
 		t.deps.Logger.LogError("Missing required composePath", err, nil)
 		return mcpgolang.NewToolResultError("Missing required composePath"), nil
 	}
+	profiles := ParseProfiles(request.GetString("profiles", ""))
 
 	t.deps.Logger.LogInfo("Setting up test environment", map[string]interface{}{
 		"composePath": composePath,
+		"profiles":    profiles,
 		"component":   "setup_environment",
 	})
-	t.sendProgress(ctx, "Fetching compose file", map[string]interface{}{"composePath": composePath})
+	t.deps.SendProgress(ctx, "Fetching compose file", map[string]interface{}{"composePath": composePath})
 
 	// Fetch compose content
-	content, err := FetchComposeContent(composePath)
+	content, err := FetchComposeContent(ctx, composePath)
 	if err != nil {
 		t.deps.Logger.LogError("Failed to fetch compose content", err, map[string]interface{}{"composePath": composePath})
 		return mcpgolang.NewToolResultError(err.Error()), nil
 	}
 
-	// Parse to validate
-	var compose ComposeFile
-	if err := yaml.Unmarshal([]byte(content), &compose); err != nil {
-		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid compose file: %v", err)), nil
+	// Validate before anything is stored or started
+	compose, warnings, err := ValidateCompose(content)
+	if err != nil {
+		t.deps.Logger.LogError("Compose validation failed", err, map[string]interface{}{"composePath": composePath})
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if err := ValidateProfiles(compose, profiles); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	// Only the services the profiles start are recorded
+	compose = compose.WithProfiles(profiles)
+	if len(warnings) > 0 {
+		t.deps.Logger.LogInfo("Compose validation warnings", map[string]interface{}{
+			"composePath": composePath,
+			"warnings":    warnings,
+		})
 	}
 
 	// Store in database
 	dbStart := time.Now()
-	composeFileId, err := StoreComposeFile(t.deps.DB, composePath, content)
+	composeFile, err := StoreComposeFile(t.deps.DB, composePath, content)
 	if err != nil {
 		t.deps.Logger.LogError("Failed to store compose file", err, map[string]interface{}{"composePath": composePath})
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to store compose file: %v", err)), nil
 	}
 	t.deps.Logger.LogDatabaseOperation("store_compose_file", time.Since(dbStart), nil, map[string]interface{}{
-		"compose_file_id": composeFileId,
+		"compose_file_id": composeFile.ID,
 		"source":          composePath,
+		"hash":            composeFile.Hash,
+		"reused":          composeFile.Reused,
 	})
 
 	// Create test session
 	sessionName := fmt.Sprintf("session-%d", time.Now().Unix())
 	dbStart = time.Now()
-	result, err := t.deps.DB.Exec("INSERT INTO test_sessions (compose_file_id, session_name, status) VALUES (?, ?, ?)",
-		composeFileId, sessionName, "initialized")
+	sessionId, err := t.deps.DB.Insert("INSERT INTO test_sessions (compose_file_id, session_name, status, profiles) VALUES (?, ?, ?, ?)",
+		composeFile.ID, sessionName, "initialized", ProfilesColumn(profiles))
 	if err != nil {
 		t.deps.Logger.LogError("Failed to create session", err, map[string]interface{}{"sessionName": sessionName})
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to create session: %v", err)), nil
 	}
-	sessionId, _ := result.LastInsertId()
+	SetSpanAttributes(ctx, attribute.Int64("session.id", sessionId))
 	t.deps.Logger.LogDatabaseOperation("create_session", time.Since(dbStart), nil, map[string]interface{}{
 		"session_id":   sessionId,
 		"session_name": sessionName,
@@ -105,33 +121,25 @@ func (t *SetupEnvironmentTool) Handle(ctx context.Context, request mcpgolang.Cal
 	response := fmt.Sprintf("Test environment configured:\n")
 	response += fmt.Sprintf("- Session ID: %d\n", sessionId)
 	response += fmt.Sprintf("- Source: %s\n", composePath)
+	response += fmt.Sprintf("- Compose SHA-256: %s\n", composeFile.Hash)
+	if composeFile.Reused {
+		response += fmt.Sprintf("- Reused existing compose (id %d)\n", composeFile.ID)
+	} else {
+		response += fmt.Sprintf("- Stored new compose (id %d)\n", composeFile.ID)
+	}
+	if len(profiles) > 0 {
+		response += fmt.Sprintf("- Profiles: %s\n", strings.Join(profiles, ", "))
+	}
 	response += fmt.Sprintf("- Services: %d\n", len(compose.Services))
 	for name, service := range compose.Services {
 		response += fmt.Sprintf("  • %s (%s)\n", name, service.Image)
 	}
-
-	return mcpgolang.NewToolResultText(response), nil
-}
-
-func (t *SetupEnvironmentTool) sendProgress(ctx context.Context, progress string, data map[string]interface{}) {
-	// Log the progress
-	t.deps.Logger.LogInfo("Progress update", map[string]interface{}{
-		"progress":  progress,
-		"component": "progress",
-		"data":      data,
-	})
-
-	// Send progress notification to client
-	progressData := map[string]interface{}{
-		"progress":  progress,
-		"timestamp": time.Now().Format(time.RFC3339),
-	}
-	for k, v := range data {
-		progressData[k] = v
+	if len(warnings) > 0 {
+		response += "\nWarnings:\n"
+		for _, warning := range warnings {
+			response += fmt.Sprintf("- %s\n", warning)
+		}
 	}
 
-	// TODO: Send notification when MCP-Go library supports it
-	// For now, we'll just log the progress
-	t.deps.Logger.LogDebug("Progress notification prepared", progressData)
+	return mcpgolang.NewToolResultText(response), nil
 }
-
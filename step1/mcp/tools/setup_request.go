@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SetupRequest is a request made once in k6's setup(), such as a login,
+// whose JSON response holds a token for every request the test makes
+type SetupRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Body is sent as JSON; ${NAME} placeholders are filled from __ENV at run
+	// time, so credentials can be passed with envVars rather than stored
+	Body string `json:"body,omitempty"`
+	// TokenJSONPath locates the token in the response, in the path syntax of
+	// k6's Response.json(), e.g. "access_token" or "data.token"
+	TokenJSONPath string `json:"tokenJsonPath"`
+}
+
+// NewSetupRequest parses the setupRequest ("POST /auth/login"), setupBody and
+// tokenJsonPath parameters. It returns nil when no setup request was asked for.
+func NewSetupRequest(request, body, tokenJSONPath string) (*SetupRequest, error) {
+	request = strings.TrimSpace(request)
+	if request == "" {
+		if body != "" || tokenJSONPath != "" {
+			return nil, fmt.Errorf("setupBody and tokenJsonPath require setupRequest")
+		}
+		return nil, nil
+	}
+
+	specs := ParseEndpointSpecs(request)
+	if len(specs) != 1 || !strings.HasPrefix(specs[0].Path, "/") {
+		return nil, fmt.Errorf("setupRequest %q must be a single request such as \"POST /auth/login\"", request)
+	}
+	if tokenJSONPath == "" {
+		return nil, fmt.Errorf("setupRequest requires tokenJsonPath, the response field holding the token")
+	}
+	if body != "" && !json.Valid([]byte(body)) {
+		return nil, fmt.Errorf("setupBody must be JSON")
+	}
+
+	return &SetupRequest{
+		Method:        specs[0].Method,
+		Path:          specs[0].Path,
+		Body:          body,
+		TokenJSONPath: tokenJSONPath,
+	}, nil
+}
+
+// Config returns the setup request as JSON, for storing with the test
+func (s *SetupRequest) Config() string {
+	config, _ := json.Marshal(s)
+	return string(config)
+}
+
+// SetupFunction returns k6's setup() for the request. The token it returns
+// reaches the default function as setupData.token.
+func (s *SetupRequest) SetupFunction() string {
+	return fmt.Sprintf(`
+// Runs once before the test; the token is passed to every iteration
+const SETUP = %s;
+
+export function setup() {
+  const body = SETUP.body ? SETUP.body.replace(/\$\{(\w+)\}/g, (match, key) => __ENV[key] || '') : null;
+  const res = http.request(SETUP.method, BASE_URL + SETUP.path, body, {
+    headers: Object.assign({ 'Content-Type': 'application/json' }, HEADERS),
+    tags: { name: SETUP.path },
+  });
+  if (res.status < 200 || res.status >= 300) {
+    fail('setup request ' + SETUP.method + ' ' + SETUP.path + ' returned ' + res.status);
+  }
+  const token = res.json(SETUP.tokenJsonPath);
+  if (!token) {
+    fail('setup response has no ' + SETUP.tokenJsonPath);
+  }
+  return { token: token };
+}
+`, s.Config())
+}
@@ -1,16 +1,28 @@
 package tools
 
 import (
-	"crypto/md5"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/csv"
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gopkg.in/yaml.v3"
 )
 
 // ComposeFile represents a Docker Compose file structure
@@ -20,23 +32,136 @@ type ComposeFile struct {
 
 // Service represents a service in Docker Compose
 type Service struct {
-	Image       string   `yaml:"image"`
-	Ports       []string `yaml:"ports"`
-	Environment []string `yaml:"environment"`
-	DependsOn   []string `yaml:"depends_on"`
+	Image       string      `yaml:"image"`
+	Build       interface{} `yaml:"build"`
+	Ports       []string    `yaml:"ports"`
+	Environment []string    `yaml:"environment"`
+	DependsOn   []string    `yaml:"depends_on"`
+	Profiles    []string    `yaml:"profiles"`
 }
 
 // SharedDependencies holds shared resources for tools
 type SharedDependencies struct {
-	DB     *sql.DB
+	DB     *DB
 	Logger Logger
 }
 
-// FetchComposeContent fetches Docker Compose content from URL or file
-func FetchComposeContent(source string) (string, error) {
+// composeFileNames are the file names docker compose looks for in a directory,
+// in order of preference
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// FetchComposeContent fetches Docker Compose content from one or more sources.
+// A comma-separated list of URLs/paths is merged in order, with later files
+// overriding earlier ones (see MergeComposeContents). A directory resolves to
+// its compose file plus any matching override file, as docker compose does.
+// URLs are downloaded under ctx.
+func FetchComposeContent(ctx context.Context, source string) (string, error) {
+	sources, err := resolveComposeSources(source)
+	if err != nil {
+		return "", err
+	}
+	if len(sources) == 1 {
+		return fetchSingleComposeContent(ctx, sources[0])
+	}
+
+	contents := make([]string, 0, len(sources))
+	for _, src := range sources {
+		content, err := fetchSingleComposeContent(ctx, src)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", src, err)
+		}
+		contents = append(contents, content)
+	}
+	return MergeComposeContents(contents)
+}
+
+// resolveComposeSources splits a comma-separated source list and expands
+// directories into their compose (and override) files
+func resolveComposeSources(source string) ([]string, error) {
+	var sources []string
+	for _, src := range strings.Split(source, ",") {
+		src = strings.TrimSpace(src)
+		if src == "" {
+			continue
+		}
+
+		info, err := os.Stat(src)
+		if err != nil || !info.IsDir() {
+			sources = append(sources, src)
+			continue
+		}
+
+		found := false
+		for _, name := range composeFileNames {
+			path := filepath.Join(src, name)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			sources = append(sources, path)
+			ext := filepath.Ext(name)
+			override := filepath.Join(src, strings.TrimSuffix(name, ext)+".override"+ext)
+			if _, err := os.Stat(override); err == nil {
+				sources = append(sources, override)
+			}
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("no compose file (%s) found in directory %s", strings.Join(composeFileNames, ", "), src)
+		}
+	}
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no compose source provided")
+	}
+	return sources, nil
+}
+
+// MergeComposeContents merges compose documents in order. Mappings (including
+// the services map and each service definition) are merged recursively; scalar
+// values and sequences such as ports are replaced by the later file.
+func MergeComposeContents(contents []string) (string, error) {
+	merged := map[string]interface{}{}
+	for i, content := range contents {
+		var doc map[string]interface{}
+		if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+			return "", fmt.Errorf("invalid compose file #%d: %w", i+1, err)
+		}
+		merged = mergeYAMLMaps(merged, doc)
+	}
+
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode merged compose file: %w", err)
+	}
+	return string(out), nil
+}
+
+func mergeYAMLMaps(base, override map[string]interface{}) map[string]interface{} {
+	for key, value := range override {
+		baseMap, baseIsMap := base[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			base[key] = mergeYAMLMaps(baseMap, overrideMap)
+			continue
+		}
+		base[key] = value
+	}
+	return base
+}
+
+// composeDownloadTimeout bounds downloading a compose file from a URL
+const composeDownloadTimeout = 30 * time.Second
+
+func fetchSingleComposeContent(ctx context.Context, source string) (string, error) {
 	// Check if it's a URL
 	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
-		resp, err := http.Get(source)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to download compose file: %w", err)
+		}
+		client := &http.Client{Timeout: composeDownloadTimeout}
+		resp, err := client.Do(req)
 		if err != nil {
 			return "", fmt.Errorf("failed to download compose file: %w", err)
 		}
@@ -61,33 +186,55 @@ func FetchComposeContent(source string) (string, error) {
 	return string(content), nil
 }
 
-// StoreComposeFile stores compose file in database
-func StoreComposeFile(db *sql.DB, source, content string) (int64, error) {
-	// Calculate hash
-	hash := md5.Sum([]byte(content))
-	hashStr := hex.EncodeToString(hash[:])
+// StoredCompose identifies the compose_files row holding some content
+type StoredCompose struct {
+	ID int64
+	// Hash is the hex SHA-256 of the content
+	Hash string
+	// Reused is true when identical content was already stored
+	Reused bool
+}
+
+// ComposeHash returns the hex SHA-256 compose files are deduplicated by
+func ComposeHash(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+// StoreComposeFile stores compose file in database, reusing the existing row
+// when identical content was stored before
+func StoreComposeFile(db *DB, source, content string) (StoredCompose, error) {
+	stored := StoredCompose{Hash: ComposeHash(content)}
 
 	// Check if already exists
-	var existingId int64
-	err := db.QueryRow("SELECT id FROM compose_files WHERE hash = ?", hashStr).Scan(&existingId)
+	err := db.QueryRow("SELECT id FROM compose_files WHERE hash = ?", stored.Hash).Scan(&stored.ID)
 	if err == nil {
-		return existingId, nil
+		stored.Reused = true
+		return stored, nil
 	}
 
 	// Store new compose file
-	result, err := db.Exec("INSERT INTO compose_files (source_url, content, hash) VALUES (?, ?, ?)",
-		source, content, hashStr)
-	if err != nil {
-		return 0, err
+	stored.ID, err = db.Insert("INSERT INTO compose_files (source_url, content, hash) VALUES (?, ?, ?)",
+		source, content, stored.Hash)
+	return stored, err
+}
+
+// TempDirPrefix starts the name of each run's directory under os.TempDir()
+const TempDirPrefix = "k6-test-"
+
+// RunTempDir creates a session's run directory under os.TempDir()
+func RunTempDir(sessionId int64) (string, error) {
+	tempDir := filepath.Join(os.TempDir(), fmt.Sprintf("%s%d-%d", TempDirPrefix, sessionId, time.Now().Unix()))
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", err
 	}
-	return result.LastInsertId()
+	return tempDir, nil
 }
 
 // WriteComposeToTemp writes compose content to temporary directory
 func WriteComposeToTemp(content string, sessionId int64) (string, error) {
-	// Create unique temp directory
-	tempDir := filepath.Join(os.TempDir(), fmt.Sprintf("k6-test-%d-%d", sessionId, time.Now().Unix()))
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
+	tempDir, err := RunTempDir(sessionId)
+	if err != nil {
 		return "", err
 	}
 
@@ -100,6 +247,111 @@ func WriteComposeToTemp(content string, sessionId int64) (string, error) {
 	return composePath, nil
 }
 
+// PublishedPort returns the host port from a compose port mapping such as
+// "8080", "8082:8080", "127.0.0.1:8082:8080", "[::1]:8082:8080" or
+// "8082:8080/tcp", or from one docker ps prints, such as
+// "0.0.0.0:32768->80/tcp"
+func PublishedPort(mapping string) string {
+	mapping = strings.SplitN(mapping, "/", 2)[0]
+	// docker ps: the host address and port, then the container port
+	if host, _, ok := strings.Cut(mapping, "->"); ok {
+		return host[strings.LastIndex(host, ":")+1:]
+	}
+	// An IPv6 host address is bracketed, and its colons aren't separators
+	if strings.HasPrefix(mapping, "[") {
+		if _, rest, ok := strings.Cut(mapping, "]:"); ok {
+			mapping = rest
+		}
+	}
+	parts := strings.Split(mapping, ":")
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return parts[len(parts)-2]
+}
+
+// TargetService picks the service a single-target test runs against and its
+// published port: the named service, or when name is empty the first service
+// with a published port in name order, so the choice is the same every run.
+// Both are empty when no service publishes a port.
+func TargetService(compose ComposeFile, name string) (service, port string, err error) {
+	if name != "" {
+		target, ok := compose.Services[name]
+		if !ok {
+			names := make([]string, 0, len(compose.Services))
+			for n := range compose.Services {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return "", "", fmt.Errorf("targetService %q not found in compose file; services: %s", name, strings.Join(names, ", "))
+		}
+		if len(target.Ports) == 0 {
+			return "", "", fmt.Errorf("targetService %q publishes no ports to test", name)
+		}
+		return name, PublishedPort(target.Ports[0]), nil
+	}
+
+	names := make([]string, 0, len(compose.Services))
+	for n, svc := range compose.Services {
+		if len(svc.Ports) > 0 {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return "", "", nil
+	}
+	sort.Strings(names)
+	return names[0], PublishedPort(compose.Services[names[0]].Ports[0]), nil
+}
+
+// EndpointSpec is an endpoint to exercise in a generated test
+type EndpointSpec struct {
+	Method string
+	Path   string
+}
+
+// ParseEndpointSpecs parses a comma-separated endpoint list where each entry is
+// a path optionally preceded by an HTTP method, e.g. "/users, POST /users,
+// /users/{id}". Entries without a method default to GET.
+func ParseEndpointSpecs(endpoints string) []EndpointSpec {
+	specs := []EndpointSpec{}
+	for _, entry := range strings.Split(endpoints, ",") {
+		fields := strings.Fields(entry)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			specs = append(specs, EndpointSpec{Method: "GET", Path: fields[0]})
+		default:
+			specs = append(specs, EndpointSpec{Method: strings.ToUpper(fields[0]), Path: fields[1]})
+		}
+	}
+	return specs
+}
+
+// TestDataFileName is the name a test's CSV data is written under, next to
+// the script, when the test is run
+const TestDataFileName = "data.csv"
+
+// LoadTestDataCSV reads a CSV file for data-driven tests and checks that it has
+// a header row and at least one data row
+func LoadTestDataCSV(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read data file: %w", err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("invalid CSV data file: %w", err)
+	}
+	if len(records) < 2 {
+		return "", fmt.Errorf("data file %s must have a header row and at least one data row", path)
+	}
+
+	return string(content), nil
+}
+
 // GenerateJSArray converts string slice to JavaScript array literal
 func GenerateJSArray(items []string) string {
 	quoted := make([]string, len(items))
@@ -109,69 +361,981 @@ func GenerateJSArray(items []string) string {
 	return "[" + strings.Join(quoted, ", ") + "]"
 }
 
+const (
+	// DefaultP95ThresholdMs is the p95 latency budget used when none is requested
+	DefaultP95ThresholdMs = 500.0
+	// DefaultMaxErrorRate is the tolerated request failure rate used when none is requested
+	DefaultMaxErrorRate = 0.1
+)
+
+// ValidateThresholds checks user-supplied latency and error-rate budgets
+func ValidateThresholds(p95ThresholdMs, maxErrorRate float64) error {
+	if p95ThresholdMs <= 0 {
+		return fmt.Errorf("p95ThresholdMs must be greater than 0, got %g", p95ThresholdMs)
+	}
+	if maxErrorRate < 0 || maxErrorRate > 1 {
+		return fmt.Errorf("maxErrorRate must be between 0 and 1, got %g", maxErrorRate)
+	}
+	return nil
+}
+
+// MaxDuration is the longest run that may be requested, to catch typos such
+// as an extra zero before they reach k6
+const MaxDuration = 24 * time.Hour
+
+// DefaultMaxVUs is the most VUs a single run may use unless the max_vus
+// setting (MCP_MAX_VUS) says otherwise. k6 and the services under test share
+// the host, so one oversized run can take the whole machine down.
+const DefaultMaxVUs = 2000
+
+// ParseVULimit reads a max_vus setting: a positive number of VUs
+func ParseVULimit(value string) (int, error) {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid MCP_MAX_VUS %q: must be a positive number of VUs", value)
+	}
+	return limit, nil
+}
+
+// VULimit returns the most VUs a single run may use: the max_vus setting
+// (MCP_MAX_VUS), or DefaultMaxVUs when it is unset or invalid. An invalid
+// setting is reported when the server starts.
+func VULimit() int {
+	if value := Settings().MaxVUs; value != "" {
+		if limit, err := ParseVULimit(value); err == nil {
+			return limit
+		}
+	}
+	return DefaultMaxVUs
+}
+
+// CheckVULimit rejects a run whose VUs, described by what, are over VULimit
+func CheckVULimit(what string, vus int) error {
+	if limit := VULimit(); vus > limit {
+		return fmt.Errorf("%s (%d) exceeds the limit of %d VUs per run, which protects the machine k6 and the services run on; it is set with MCP_MAX_VUS", what, vus, limit)
+	}
+	return nil
+}
+
+// HighLoadRequests is the VUs times endpoints above which a test is warned
+// about: the generated scripts don't pause between iterations, so each VU
+// requests its endpoints as fast as they respond
+const HighLoadRequests = 10000
+
+// HighLoadWarning warns when vus requesting endpoints each would send more
+// requests than a shared machine should take, or returns "" when they won't
+func HighLoadWarning(vus, endpoints int) string {
+	if vus*endpoints <= HighLoadRequests {
+		return ""
+	}
+	return fmt.Sprintf("Warning: %d VUs requesting %d endpoints each, with no pause between iterations, can send requests faster than this machine and the services under test can handle. Lower the VUs or test fewer endpoints unless the machine is dedicated to load testing.", vus, endpoints)
+}
+
+// ValidateDuration checks a user-supplied duration before it reaches k6.
+// k6 reads durations in Go's format, so a bare number such as "30" is
+// rejected here rather than left for k6 to report.
+func ValidateDuration(duration string) error {
+	d, err := time.ParseDuration(duration)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid duration %q: must be a positive duration with a unit, such as 30s or 5m", duration)
+	}
+	if d > MaxDuration {
+		return fmt.Errorf("duration %s exceeds the %s limit", duration, MaxDuration)
+	}
+	return nil
+}
+
+// ValidateLoad checks user-supplied vus and duration for k6's --vus and
+// --duration flags
+func ValidateLoad(vus int, duration string) error {
+	if vus <= 0 {
+		return fmt.Errorf("vus must be at least 1, got %d", vus)
+	}
+	if err := CheckVULimit("vus", vus); err != nil {
+		return err
+	}
+	return ValidateDuration(duration)
+}
+
+// DryRunNotice heads dry-run results
+const DryRunNotice = "Dry run: no containers were started, k6 was not run and no test run was recorded."
+
+// DryRunSection renders a file a dry run would use as a fenced markdown block
+func DryRunSection(title, lang, content string) string {
+	return fmt.Sprintf("\n## %s\n```%s\n%s\n```\n", title, lang, strings.TrimRight(content, "\n"))
+}
+
+// ResultsDir returns the directory raw k6 output is kept in: the results_dir
+// setting (MCP_RESULTS_DIR), or ~/.speak-perf-mcp/results by default. The
+// directory is created if missing.
+func ResultsDir() (string, error) {
+	dir := Settings().ResultsDir
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			dir = filepath.Join(os.TempDir(), "speak-perf-mcp", "results")
+		} else {
+			dir = filepath.Join(homeDir, ".speak-perf-mcp", "results")
+		}
+	}
+
+	// Results can contain request data, so keep them private to the user
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create results directory %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// DefaultProbeTimeoutSeconds bounds each HTTP request made while probing for specs
+const DefaultProbeTimeoutSeconds = 5.0
+
+// DefaultSpecPaths are the paths probed for OpenAPI/Swagger documents
+var DefaultSpecPaths = []string{
+	"/swagger.json",
+	"/openapi.json",
+	"/api-docs",
+	"/v2/api-docs",
+	"/v3/api-docs",
+	"/api/swagger.json",
+	"/api/openapi.json",
+	"/api/v3/openapi.json",
+	"/openapi.yaml",
+	"/swagger.yaml",
+	"/v3/api-docs.yaml",
+}
+
+// SpecPathCandidates returns the spec paths to probe: the comma-separated
+// extra paths appended to DefaultSpecPaths, or on their own when replace is set
+func SpecPathCandidates(extra string, replace bool) []string {
+	candidates := []string{}
+	if !replace || strings.TrimSpace(extra) == "" {
+		candidates = append(candidates, DefaultSpecPaths...)
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range candidates {
+		seen[path] = true
+	}
+	for _, path := range strings.Split(extra, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		if !seen[path] {
+			seen[path] = true
+			candidates = append(candidates, path)
+		}
+	}
+	return candidates
+}
+
+// BasePaths maps services to the path prefix they serve under
+type BasePaths struct {
+	Default  string
+	Services map[string]string
+}
+
+// For returns the path prefix for a service
+func (b BasePaths) For(service string) string {
+	if prefix, ok := b.Services[service]; ok {
+		return prefix
+	}
+	return b.Default
+}
+
+// ParseBasePaths parses a comma-separated list of path prefixes, where each
+// entry is either "service=/prefix" or a bare "/prefix" applying to all
+// other services
+func ParseBasePaths(list string) (BasePaths, error) {
+	basePaths := BasePaths{Services: make(map[string]string)}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		service, prefix, scoped := strings.Cut(item, "=")
+		if !scoped {
+			prefix = service
+		}
+		prefix = "/" + strings.Trim(strings.TrimSpace(prefix), "/")
+		if prefix == "/" {
+			prefix = ""
+		}
+
+		if !scoped {
+			basePaths.Default = prefix
+			continue
+		}
+		service = strings.TrimSpace(service)
+		if service == "" {
+			return basePaths, fmt.Errorf("entry %q is missing a service name", item)
+		}
+		basePaths.Services[service] = prefix
+	}
+	return basePaths, nil
+}
+
+const (
+	// DefaultPageLimit is how many rows history queries and list resources
+	// return when no limit is given
+	DefaultPageLimit = 20
+	// MaxPageLimit caps a single page so a large history can't be dumped at once
+	MaxPageLimit = 500
+)
+
+// Page selects a window of rows with LIMIT and OFFSET
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// NewPage validates limit and offset; a limit of 0 means DefaultPageLimit
+func NewPage(limit, offset int) (Page, error) {
+	if limit == 0 {
+		limit = DefaultPageLimit
+	}
+	if limit < 0 || limit > MaxPageLimit {
+		return Page{}, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+	}
+	if offset < 0 {
+		return Page{}, fmt.Errorf("offset must not be negative")
+	}
+	return Page{Limit: limit, Offset: offset}, nil
+}
+
+// PageInfo is the pagination metadata returned alongside a page of rows
+type PageInfo struct {
+	Total   int  `json:"total"`
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	HasMore bool `json:"hasMore"`
+}
+
+// Info describes the page given the total number of matching rows
+func (p Page) Info(total int) PageInfo {
+	return PageInfo{
+		Total:   total,
+		Limit:   p.Limit,
+		Offset:  p.Offset,
+		HasMore: p.Offset+p.Limit < total,
+	}
+}
+
+// ParseHeaderList parses a comma-separated list of "Key: value" pairs, e.g.
+// "Authorization: Bearer abc, X-API-Key: 123"
+func ParseHeaderList(list string) (http.Header, error) {
+	headers := http.Header{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("header %q must be in Key: value form", item)
+		}
+		headers.Add(key, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// TestTimeoutBuffer is added to every test's duration to cover image pulls,
+// container startup, the readiness wait and k6's graceful stop
+const TestTimeoutBuffer = 5 * time.Minute
+
+// MaxTestDuration returns how long a run with the given k6 duration may take
+// in total before it is aborted. Long tests get an extra 25% of slack so
+// legitimately slow stress runs are not cut short.
+func MaxTestDuration(duration string) (time.Duration, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q: must be a positive duration such as 30s or 5m", duration)
+	}
+	return d + d/4 + TestTimeoutBuffer, nil
+}
+
+// timeoutError reports a run aborted by MaxTestDuration; callers tear the
+// compose project down on return
+func timeoutError(maxDuration time.Duration, duration string) error {
+	return fmt.Errorf("Test timed out: exceeded the %s limit for a %s test (duration plus startup allowance); containers have been stopped and removed", maxDuration, duration)
+}
+
+// GenerateAbortingThresholds is GenerateThresholds for breakpoint tests: the
+// first breached threshold stops the run, after a short warm-up
+func GenerateAbortingThresholds(p95ThresholdMs, maxErrorRate float64) string {
+	return fmt.Sprintf(`thresholds: {
+    http_req_duration: [{ threshold: 'p(95)<%g', abortOnFail: true, delayAbortEval: '10s' }],
+    http_req_failed: [{ threshold: 'rate<%g', abortOnFail: true, delayAbortEval: '10s' }],
+  },`, p95ThresholdMs, maxErrorRate)
+}
+
+// GenerateThresholds returns a k6 options thresholds block for the given budgets
+func GenerateThresholds(p95ThresholdMs, maxErrorRate float64) string {
+	return fmt.Sprintf(`thresholds: {
+    http_req_duration: ['p(95)<%g'],
+    http_req_failed: ['rate<%g'],
+  },`, p95ThresholdMs, maxErrorRate)
+}
+
+// TestTypes are the scenario profiles generated tests can use
+var TestTypes = []string{"load", "stress", "spike", "soak", "breakpoint"}
+
 // GetExecutorType returns k6 executor type based on test type
 func GetExecutorType(testType string) string {
 	switch testType {
 	case "stress":
 		return "ramping-vus"
-	case "spike":
+	case "spike", "breakpoint":
 		return "ramping-arrival-rate"
 	default:
 		return "constant-vus"
 	}
 }
 
+// ScenarioParams sizes a generated k6 scenario. Which fields apply depends on
+// the test type; zero values take the type's defaults.
+type ScenarioParams struct {
+	// VUs is the constant VU count (load, soak), the peak VUs for stress when
+	// Target is unset, or the pre-allocated VUs for arrival-rate executors
+	// (spike, breakpoint)
+	VUs int
+	// Duration is the steady-state time: the whole test for load and soak,
+	// the hold at peak for stress, and the baseline before and after a spike
+	Duration string
+	// Target is the peak VUs (stress) or peak iterations per second (spike,
+	// breakpoint)
+	Target int
+	// RampDuration is the time taken to reach Target
+	RampDuration string
+	// RampDownDuration is the time taken to return to zero after a stress
+	// hold; it defaults to RampDuration
+	RampDownDuration string
+	// MaxVUs caps the VUs arrival-rate executors may start when the
+	// pre-allocated ones are busy. When unset it is sized from Target and
+	// IterationTime.
+	MaxVUs int
+	// IterationTime is how long one iteration is assumed to take, used to
+	// size MaxVUs; arrival-rate executors default to DefaultIterationTime
+	IterationTime time.Duration
+}
+
+// DefaultIterationTime is the iteration time assumed when sizing arrival-rate
+// VUs without one, the default p95 threshold
+const DefaultIterationTime = time.Duration(DefaultP95ThresholdMs) * time.Millisecond
+
+// ArrivalRateVUs returns the VUs needed to start rate iterations per second
+// when each takes iterationTime: with fewer, k6 drops iterations
+func ArrivalRateVUs(rate int, iterationTime time.Duration) int {
+	return int(math.Ceil(float64(rate) * iterationTime.Seconds()))
+}
+
+// IsArrivalRate reports whether the test type's executor starts iterations
+// at a rate rather than running a fixed number of VUs
+func IsArrivalRate(testType string) bool {
+	return GetExecutorType(testType) == "ramping-arrival-rate"
+}
+
+// DefaultScenarioParams returns the default sizing for a test type
+func DefaultScenarioParams(testType string) ScenarioParams {
+	switch testType {
+	case "stress":
+		return ScenarioParams{Duration: "5m", Target: 100, RampDuration: "2m"}
+	case "spike":
+		return ScenarioParams{VUs: 50, Duration: "30s", Target: 100, RampDuration: "10s"}
+	case "soak":
+		return ScenarioParams{VUs: 10, Duration: "1h"}
+	case "breakpoint":
+		return ScenarioParams{VUs: 50, Target: 1000, RampDuration: "10m"}
+	default:
+		return ScenarioParams{VUs: 10, Duration: "30s"}
+	}
+}
+
+// WithDefaults fills unset fields from the test type's defaults
+func (p ScenarioParams) WithDefaults(testType string) ScenarioParams {
+	defaults := DefaultScenarioParams(testType)
+	if testType == "stress" && p.Target <= 0 && p.VUs > 0 {
+		// Asking a stress test for N VUs means peaking at N
+		p.Target = p.VUs
+	}
+	if p.VUs <= 0 {
+		p.VUs = defaults.VUs
+	}
+	if p.Duration == "" {
+		p.Duration = defaults.Duration
+	}
+	if p.Target <= 0 {
+		p.Target = defaults.Target
+	}
+	if p.RampDuration == "" {
+		p.RampDuration = defaults.RampDuration
+	}
+	if p.RampDownDuration == "" {
+		p.RampDownDuration = p.RampDuration
+	}
+	if IsArrivalRate(testType) {
+		if p.IterationTime <= 0 {
+			p.IterationTime = DefaultIterationTime
+		}
+		if p.MaxVUs <= 0 {
+			// Enough VUs for the peak rate at the assumed iteration time, but
+			// never fewer than are pre-allocated
+			p.MaxVUs = min(max(p.VUs, ArrivalRateVUs(p.Target, p.IterationTime)), VULimit())
+		}
+	}
+	return p
+}
+
+// PeakVUs returns the most VUs the test type's scenario runs at once
+func (p ScenarioParams) PeakVUs(testType string) int {
+	p = p.WithDefaults(testType)
+	switch {
+	case testType == "stress":
+		return p.Target
+	case IsArrivalRate(testType):
+		return max(p.VUs, p.MaxVUs)
+	default:
+		return p.VUs
+	}
+}
+
+// TotalDuration returns how long the test type's scenario runs with these params
+func (p ScenarioParams) TotalDuration(testType string) time.Duration {
+	p = p.WithDefaults(testType)
+	duration, _ := time.ParseDuration(p.Duration)
+	ramp, _ := time.ParseDuration(p.RampDuration)
+	switch testType {
+	case "stress":
+		rampDown, _ := time.ParseDuration(p.RampDownDuration)
+		return ramp + duration + rampDown
+	case "spike":
+		return 2*duration + ramp
+	case "breakpoint":
+		return ramp
+	default:
+		return duration
+	}
+}
+
 // GetScenarioConfig returns k6 scenario configuration based on test type
-func GetScenarioConfig(testType string) string {
+func GetScenarioConfig(testType string, params ScenarioParams) string {
+	p := params.WithDefaults(testType)
 	switch testType {
 	case "stress":
-		return `stages: [
-        { duration: '2m', target: 100 },
-        { duration: '5m', target: 100 },
-        { duration: '2m', target: 0 },
-      ],`
+		return fmt.Sprintf(`stages: [
+        { duration: '%s', target: %d },
+        { duration: '%s', target: %d },
+        { duration: '%s', target: 0 },
+      ],`, p.RampDuration, p.Target, p.Duration, p.Target, p.RampDownDuration)
 	case "spike":
-		return `startRate: 10,
+		baseline := max(p.Target/10, 1)
+		return fmt.Sprintf(`startRate: %d,
       timeUnit: '1s',
+      preAllocatedVUs: %d,
+      maxVUs: %d,
       stages: [
-        { duration: '30s', target: 10 },
-        { duration: '10s', target: 100 },
-        { duration: '30s', target: 10 },
-      ],`
+        { duration: '%s', target: %d },
+        { duration: '%s', target: %d },
+        { duration: '%s', target: %d },
+      ],`, baseline, p.VUs, p.MaxVUs, p.Duration, baseline, p.RampDuration, p.Target, p.Duration, baseline)
+	case "breakpoint":
+		// Keeps increasing the arrival rate; the aborting thresholds end the
+		// test at the breaking point
+		return fmt.Sprintf(`startRate: 1,
+      timeUnit: '1s',
+      preAllocatedVUs: %d,
+      maxVUs: %d,
+      stages: [
+        { duration: '%s', target: %d },
+      ],`, p.VUs, p.MaxVUs, p.RampDuration, p.Target)
 	default:
-		return `vus: 10,
-      duration: '30s',`
+		// load and soak differ only in duration
+		return fmt.Sprintf(`vus: %d,
+      duration: '%s',`, p.VUs, p.Duration)
+	}
+}
+
+// K6BinaryEnv names the environment variable holding the k6 executable to
+// run, e.g. a build with xk6 extensions
+const K6BinaryEnv = "K6_BINARY"
+
+// K6Binary returns the k6 executable: the k6_binary setting (K6_BINARY) if
+// set, otherwise k6 on PATH
+func K6Binary() string {
+	if binary := Settings().K6Binary; binary != "" {
+		return binary
+	}
+	return "k6"
+}
+
+// reservedK6Flags are set by the tools themselves and can't be passed as
+// extra arguments
+var reservedK6Flags = map[string]bool{
+	"-o":                    true,
+	"--out":                 true,
+	"--summary-export":      true,
+	"--summary-trend-stats": true,
+}
+
+// ParseK6ExtraArgs splits extra k6 flags the way a shell would, honouring
+// quotes and backslash escapes but never expanding anything. Only flags are
+// accepted, with values attached as --flag=value, so a stray token can't
+// become the script path; flags the tools control are rejected.
+func ParseK6ExtraArgs(value string) ([]string, error) {
+	args, err := splitArgs(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			return nil, fmt.Errorf("unexpected argument %q: only flags are allowed, with values attached as --flag=value", arg)
+		}
+		name, _, _ := strings.Cut(arg, "=")
+		// Short flags take their value directly, as in -ojson=out.json
+		if reservedK6Flags[name] || (!strings.HasPrefix(arg, "--") && strings.HasPrefix(arg, "-o")) {
+			return nil, fmt.Errorf("%s is set by the server and can't be passed in k6ExtraArgs", name)
+		}
+		// Values passed this way would be logged; envVars masks them
+		if name == "--env" || (!strings.HasPrefix(arg, "--") && strings.HasPrefix(arg, "-e")) {
+			return nil, fmt.Errorf("pass environment variables with envVars rather than %s", name)
+		}
+	}
+	return args, nil
+}
+
+// K6EnvVars are KEY=VALUE pairs passed to k6 with -e, which scripts read as
+// __ENV.KEY. Values often hold secrets, so only Keys or Masked should be
+// logged or shown to the client.
+type K6EnvVars map[string]string
+
+// envVarKeyRegex matches the names k6 scripts can read as __ENV.KEY
+var envVarKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// maskedEnvValue replaces environment variable values in logs and reports
+const maskedEnvValue = "***"
+
+// ParseK6EnvVars parses whitespace-separated KEY=VALUE pairs, quoted like
+// k6ExtraArgs, e.g. `API_TOKEN=abc "GREETING=hello world"`. Errors never
+// include values.
+func ParseK6EnvVars(value string) (K6EnvVars, error) {
+	pairs, err := splitArgs(value)
+	if err != nil {
+		return nil, err
 	}
+
+	vars := K6EnvVars{}
+	for _, pair := range pairs {
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q must be in KEY=VALUE form", key)
+		}
+		if !envVarKeyRegex.MatchString(key) {
+			return nil, fmt.Errorf("invalid name %q: use letters, digits and underscores, not starting with a digit", key)
+		}
+		vars[key] = val
+	}
+	return vars, nil
 }
 
-// ParseUIInstructions parses natural language to k6 browser commands
+// Keys returns the variable names in sorted order
+func (e K6EnvVars) Keys() []string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Args returns the -e flags for k6, in key order
+func (e K6EnvVars) Args() []string {
+	args := make([]string, 0, 2*len(e))
+	for _, key := range e.Keys() {
+		args = append(args, "-e", key+"="+e[key])
+	}
+	return args
+}
+
+// Masked returns a copy with every value replaced, for display
+func (e K6EnvVars) Masked() K6EnvVars {
+	masked := make(K6EnvVars, len(e))
+	for key := range e {
+		masked[key] = maskedEnvValue
+	}
+	return masked
+}
+
+// splitArgs tokenizes a command-line fragment on whitespace. Single quotes
+// preserve everything literally; inside double quotes and outside quotes a
+// backslash escapes the next character.
+func splitArgs(value string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inToken := false
+	var quote rune
+	escaped := false
+
+	for _, r := range value {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inToken = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inToken = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inToken {
+				args = append(args, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inToken {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+var (
+	k6VersionOnce  sync.Once
+	k6Version      string
+	k6VersionRegex = regexp.MustCompile(`v(\d+)\.(\d+)\.(\d+)`)
+)
+
+// K6Version returns the installed k6 version (e.g. "0.52.0"), or an empty
+// string if k6 could not be run. The result is cached for the process lifetime.
+func K6Version() string {
+	k6VersionOnce.Do(func() {
+		output, err := exec.Command(K6Binary(), "version").Output()
+		if err != nil {
+			return
+		}
+		if m := k6VersionRegex.FindStringSubmatch(string(output)); m != nil {
+			k6Version = fmt.Sprintf("%s.%s.%s", m[1], m[2], m[3])
+		}
+	})
+	return k6Version
+}
+
+var (
+	dockerVersionOnce sync.Once
+	dockerVersion     string
+)
+
+// DockerVersion returns the Docker engine version (e.g. "24.0.7"), or an empty
+// string if docker is not installed or its daemon is unreachable. The result
+// is cached for the process lifetime.
+func DockerVersion() string {
+	dockerVersionOnce.Do(func() {
+		output, err := exec.Command("docker", "version", "--format", "{{.Server.Version}}").Output()
+		if err != nil {
+			return
+		}
+		dockerVersion = strings.TrimSpace(string(output))
+	})
+	return dockerVersion
+}
+
+// RequireK6 returns an actionable error when k6 could not be detected
+func RequireK6() error {
+	if K6Version() == "" {
+		if binary := Settings().K6Binary; binary != "" {
+			return fmt.Errorf("k6 could not be run from %s=%s; check the path and restart the MCP server", K6BinaryEnv, binary)
+		}
+		return fmt.Errorf("k6 is not installed or not on PATH; see https://grafana.com/docs/k6/latest/set-up/install-k6/ and restart the MCP server")
+	}
+	return nil
+}
+
+// RequireDocker returns an actionable error when docker could not be detected
+func RequireDocker() error {
+	if DockerVersion() != "" {
+		return nil
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("docker is not installed or not on PATH; see https://docs.docker.com/get-docker/ and restart the MCP server")
+	}
+	return fmt.Errorf("docker is installed but the Docker daemon is not reachable; start Docker and restart the MCP server")
+}
+
+// RunK6 runs a k6 command with stdout and stderr captured separately. k6
+// writes the end-of-test summary to stdout, and its logs, progress and
+// script errors to stderr. The run is traced as a child of the span in ctx;
+// its arguments can hold secrets, so only the subcommand is recorded.
+// Cancelling a command made with exec.CommandContext interrupts k6 rather
+// than killing it, so it still writes its summary and results; it is killed
+// if it hasn't stopped after K6InterruptGrace.
+func RunK6(ctx context.Context, cmd *exec.Cmd) (stdout, stderr []byte, err error) {
+	_, span := StartSpan(ctx, "k6 "+cmd.Args[1], attribute.String("k6.command", cmd.Args[1]))
+	defer func() {
+		if code := K6ExitCode(err); code.Valid {
+			span.SetAttributes(attribute.Int64("k6.exit_code", code.Int64))
+		}
+		// Crossed thresholds are a result, not a failure to run
+		if K6ThresholdsCrossed(err) {
+			EndSpan(span, nil)
+		} else {
+			EndSpan(span, err)
+		}
+	}()
+
+	if cmd.Cancel != nil {
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		cmd.WaitDelay = K6InterruptGrace
+	}
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err = cmd.Run()
+	return outBuf.Bytes(), errBuf.Bytes(), err
+}
+
+// K6Failure describes a failed k6 run, leading with stderr so script errors
+// aren't buried under the summary
+func K6Failure(heading string, err error, stdout, stderr []byte) string {
+	msg := fmt.Sprintf("%s: %v", heading, err)
+	if s := strings.TrimSpace(string(stderr)); s != "" {
+		msg += "\n\nstderr:\n" + s
+	}
+	if s := strings.TrimSpace(string(stdout)); s != "" {
+		msg += "\n\nstdout:\n" + s
+	}
+	return msg
+}
+
+// UseStableBrowserModule reports whether generated browser tests should use
+// the k6/browser module (k6 v0.52+) rather than k6/experimental/browser.
+// When the version can't be detected the current API is assumed.
+func UseStableBrowserModule() bool {
+	m := k6VersionRegex.FindStringSubmatch("v" + K6Version())
+	if m == nil {
+		return true
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major > 0 || minor >= 52
+}
+
+// ParseUIInstructions parses natural language to k6 browser commands, in the
+// order the instructions give them, so a check runs at its point in the flow
 func ParseUIInstructions(instructions string) []string {
 	// Simple natural language parsing
-	actions := []string{}
-	instructions = strings.ToLower(instructions)
+	steps := []uiStep{}
+	lower := strings.ToLower(instructions)
 
-	// Map common phrases to k6 commands
-	if strings.Contains(instructions, "click") {
-		if strings.Contains(instructions, "button") {
-			actions = append(actions, "await page.locator('button').click();")
-		}
+	// Map common phrases to k6 commands, each at its first mention
+	if at := strings.Index(lower, "click"); at >= 0 && strings.Contains(lower, "button") {
+		steps = append(steps, uiStep{at, uiElementAction("click-button", "button", "click({ timeout: ACTION_TIMEOUT })")})
 	}
-	if strings.Contains(instructions, "type") || strings.Contains(instructions, "enter") {
-		actions = append(actions, "await page.locator('input').type('test data');")
+	if at := firstIndex(lower, "type", "enter"); at >= 0 {
+		steps = append(steps, uiStep{at, uiElementAction("type-input", "input", "type('test data', { timeout: ACTION_TIMEOUT })")})
 	}
-	if strings.Contains(instructions, "wait") {
-		actions = append(actions, "await page.waitForTimeout(1000);")
+	if at := strings.Index(lower, "wait"); at >= 0 {
+		steps = append(steps, uiStep{at, "await page.waitForTimeout(1000);"})
 	}
 
+	steps = append(steps, parseUIAssertions(instructions)...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].at < steps[j].at })
+
+	actions := make([]string, len(steps))
+	for i, step := range steps {
+		actions[i] = step.code
+	}
 	return actions
 }
 
-// ParseAndStoreMetrics parses k6 output and stores metrics (simplified)
-func ParseAndStoreMetrics(db *sql.DB, runId int64, outputFile string) {
-	// Simplified metric parsing - in reality would parse k6 JSON output
-	db.Exec(`INSERT INTO metrics 
-		(run_id, endpoint, avg_response_time, min_response_time, max_response_time, error_rate, requests_per_second) 
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		runId, "/api/endpoint", 150.5, 50.0, 500.0, 0.02, 85.5)
+// uiStep is a k6 browser command and where in the instructions it was asked for
+type uiStep struct {
+	at   int
+	code string
+}
+
+// firstIndex returns the index of the first of words in s, or -1 if there
+// are none
+func firstIndex(s string, words ...string) int {
+	first := -1
+	for _, word := range words {
+		if i := strings.Index(s, word); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	return first
+}
+
+// uiElementAction waits up to ACTION_TIMEOUT for selector to be visible, then
+// calls method on its locator. It runs as a named step of the generated
+// script, which screenshots the page if the step fails.
+func uiElementAction(name, selector, method string) string {
+	return fmt.Sprintf(`await step(page, %s, async () => {
+  await page.waitForSelector(%s, { state: 'visible', timeout: ACTION_TIMEOUT });
+  await page.locator(%s).%s;
+});`, strconv.Quote(name), strconv.Quote(selector), strconv.Quote(selector), method)
+}
+
+var (
+	elementVisiblePattern = regexp.MustCompile(`(?i)expect\s+(?:element|selector)\s+["']([^"']+)["']\s+to\s+be\s+visible`)
+	textVisiblePattern    = regexp.MustCompile(`(?i)expect\s+["']([^"']+)["']\s+to\s+be\s+visible`)
+	elementTextPattern    = regexp.MustCompile(`(?i)expect\s+(?:element|selector)\s+["']([^"']+)["']\s+to\s+(?:have\s+text|contain)\s+["']([^"']+)["']`)
+	urlContainsPattern    = regexp.MustCompile(`(?i)(?:check|verify|expect)\s+(?:that\s+)?(?:the\s+)?url\s+contains\s+["']?([^\s"',]+)["']?`)
+	titleContainsPattern  = regexp.MustCompile(`(?i)(?:check|verify|expect)\s+(?:that\s+)?(?:the\s+)?title\s+contains\s+["']([^"']+)["']`)
+)
+
+// parseUIAssertions turns verification phrases into awaited k6 check() calls
+// against the page state (text, element visibility, URL, title), each at the
+// position of its phrase
+func parseUIAssertions(instructions string) []uiStep {
+	assertions := []uiStep{}
+
+	for _, m := range elementTextPattern.FindAllStringSubmatchIndex(instructions, -1) {
+		selector, text := instructions[m[2]:m[3]], instructions[m[4]:m[5]]
+		assertions = append(assertions, uiStep{m[0], fmt.Sprintf(
+			"check(await page.locator(%s).textContent(), { %s: (t) => t !== null && t.includes(%s) });",
+			strconv.Quote(selector), strconv.Quote(fmt.Sprintf("%s contains %s", selector, text)), strconv.Quote(text))})
+	}
+	for _, m := range elementVisiblePattern.FindAllStringSubmatchIndex(instructions, -1) {
+		selector := instructions[m[2]:m[3]]
+		assertions = append(assertions, uiStep{m[0], fmt.Sprintf(
+			"check(await page.locator(%s).isVisible(), { %s: (v) => v === true });",
+			strconv.Quote(selector), strconv.Quote(fmt.Sprintf("%s is visible", selector)))})
+	}
+	for _, m := range textVisiblePattern.FindAllStringSubmatchIndex(instructions, -1) {
+		text := instructions[m[2]:m[3]]
+		selector := fmt.Sprintf("//*[contains(text(), %s)]", xpathLiteral(text))
+		assertions = append(assertions, uiStep{m[0], fmt.Sprintf(
+			"check(await page.locator(%s).first().isVisible(), { %s: (v) => v === true });",
+			strconv.Quote(selector), strconv.Quote(fmt.Sprintf("'%s' is visible", text)))})
+	}
+	for _, m := range urlContainsPattern.FindAllStringSubmatchIndex(instructions, -1) {
+		fragment := strings.TrimRight(instructions[m[2]:m[3]], ".;:")
+		assertions = append(assertions, uiStep{m[0], fmt.Sprintf(
+			"check(await page.url(), { %s: (u) => u.includes(%s) });",
+			strconv.Quote(fmt.Sprintf("url contains %s", fragment)), strconv.Quote(fragment))})
+	}
+	for _, m := range titleContainsPattern.FindAllStringSubmatchIndex(instructions, -1) {
+		title := instructions[m[2]:m[3]]
+		assertions = append(assertions, uiStep{m[0], fmt.Sprintf(
+			"check(await page.title(), { %s: (t) => t.includes(%s) });",
+			strconv.Quote(fmt.Sprintf("title contains %s", title)), strconv.Quote(title))})
+	}
+
+	return assertions
+}
+
+// xpathLiteral quotes a string for use inside an XPath expression
+func xpathLiteral(s string) string {
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	return `"` + s + `"`
 }
 
+// serviceTag is set on requests by scripts that load several services in
+// one run, so their metrics can be attributed
+const serviceTag = "service"
+
+// ParseAndStoreMetrics parses k6 NDJSON output, groups request metrics by the
+// request name tag and stores one metrics row per endpoint and service.
+// Requests without a service tag are attributed to service, which may be
+// empty when the run's target is unknown. The returned metrics are keyed by
+// endpoint alone, combining services. Metrics the script defined itself are
+// stored in custom_metrics and returned summarized.
+func ParseAndStoreMetrics(db *DB, runId int64, outputFile, service string) (map[string]*EndpointMetrics, []CustomMetricSummary, error) {
+	type groupKey struct{ service, endpoint string }
+	keys := make(map[string]groupKey)
+	custom := make(map[string]*CustomMetric)
+	grouped, err := parseK6Results(outputFile, func(tags map[string]string) string {
+		key := groupKey{service: tags[serviceTag], endpoint: tags["name"]}
+		if key.service == "" {
+			key.service = service
+		}
+		if key.endpoint == "" {
+			key.endpoint = "all"
+		}
+		id := key.service + "\x00" + key.endpoint
+		keys[id] = key
+		return id
+	}, custom)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metrics := make(map[string]*EndpointMetrics)
+	for id, m := range grouped {
+		key := keys[id]
+		combined, ok := metrics[key.endpoint]
+		if !ok {
+			combined = &EndpointMetrics{Name: key.endpoint}
+			metrics[key.endpoint] = combined
+		}
+		combined.merge(m)
+
+		if m.Requests() == 0 {
+			continue
+		}
+		_, err := db.Exec(`INSERT INTO metrics
+			(run_id, endpoint, service, avg_response_time, min_response_time, max_response_time, p95_response_time, error_rate, requests_per_second,
+			 requests, data_sent, data_received)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			runId, key.endpoint, sql.NullString{String: key.service, Valid: key.service != ""},
+			m.Avg(), m.Min(), m.Max(), m.Percentile(95), m.ErrorRate(), m.RPS(),
+			m.Requests(), nullBytes(m.DataSent), nullBytes(m.DataReceived))
+		if err != nil {
+			return metrics, nil, fmt.Errorf("failed to store metrics for %s: %w", key.endpoint, err)
+		}
+	}
+
+	customMetrics := SummarizeCustomMetrics(custom)
+	if err := StoreCustomMetrics(db, runId, customMetrics); err != nil {
+		return metrics, customMetrics, err
+	}
+	return metrics, customMetrics, nil
+}
+
+// nullBytes stores a data transfer total. Any request sends data, so none
+// means k6 attributed it elsewhere, and it is stored as NULL.
+func nullBytes(v float64) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v > 0}
+}
+
+// SessionTargetService returns the name of a session's only service, or an
+// empty string when it has several and a run's target can't be told apart
+func SessionTargetService(db *DB, sessionId int64) string {
+	var name string
+	var count int
+	err := db.QueryRow("SELECT MIN(name), COUNT(*) FROM services WHERE session_id = ?", sessionId).Scan(&name, &count)
+	if err != nil || count != 1 {
+		return ""
+	}
+	return name
+}
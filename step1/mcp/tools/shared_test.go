@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDuration(t *testing.T) {
+	tests := []struct {
+		duration string
+		wantErr  string
+	}{
+		{duration: "30s"},
+		{duration: "5m"},
+		{duration: "24h"},
+		{duration: "30", wantErr: "must be a positive duration with a unit"},
+		{duration: "-5s", wantErr: "must be a positive duration with a unit"},
+		{duration: "0s", wantErr: "must be a positive duration with a unit"},
+		{duration: "", wantErr: "must be a positive duration with a unit"},
+		{duration: "25h", wantErr: "exceeds the 24h0m0s limit"},
+		{duration: "30s; rm -rf /", wantErr: "must be a positive duration with a unit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.duration, func(t *testing.T) {
+			checkError(t, ValidateDuration(tt.duration), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateLoad(t *testing.T) {
+	limit := VULimit()
+	tests := []struct {
+		name     string
+		vus      int
+		duration string
+		wantErr  string
+	}{
+		{name: "valid", vus: 10, duration: "30s"},
+		{name: "at the limit", vus: limit, duration: "30s"},
+		{name: "zero vus", vus: 0, duration: "30s", wantErr: "vus must be at least 1"},
+		{name: "negative vus", vus: -5, duration: "30s", wantErr: "vus must be at least 1"},
+		{name: "vus over the limit", vus: limit + 1, duration: "30s", wantErr: "exceeds the limit"},
+		{name: "bare number duration", vus: 10, duration: "30", wantErr: "must be a positive duration with a unit"},
+		{name: "injected duration", vus: 10, duration: "30s; rm -rf /", wantErr: "must be a positive duration with a unit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, ValidateLoad(tt.vus, tt.duration), tt.wantErr)
+		})
+	}
+}
+
+func TestPublishedPort(t *testing.T) {
+	tests := []struct {
+		mapping string
+		want    string
+	}{
+		{mapping: "8080", want: "8080"},
+		{mapping: "8082:8080", want: "8082"},
+		{mapping: "8082:8080/tcp", want: "8082"},
+		{mapping: "127.0.0.1:8082:8080", want: "8082"},
+		{mapping: "[::1]:8082:8080", want: "8082"},
+		{mapping: "::1:8082:8080", want: "8082"},
+		{mapping: "0.0.0.0:32768->80/tcp", want: "32768"},
+		{mapping: "[::]:32768->80/tcp", want: "32768"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mapping, func(t *testing.T) {
+			if got := PublishedPort(tt.mapping); got != tt.want {
+				t.Errorf("PublishedPort(%q) = %q, want %q", tt.mapping, got, tt.want)
+			}
+		})
+	}
+}
+
+// checkError fails unless err is nil when wantErr is empty, or else
+// contains wantErr
+func checkError(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	switch {
+	case wantErr == "" && err != nil:
+		t.Errorf("unexpected error: %v", err)
+	case wantErr != "" && err == nil:
+		t.Errorf("expected an error containing %q", wantErr)
+	case wantErr != "" && !strings.Contains(err.Error(), wantErr):
+		t.Errorf("error %q does not contain %q", err, wantErr)
+	}
+}
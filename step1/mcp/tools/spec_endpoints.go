@@ -0,0 +1,367 @@
+package tools
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gopkg.in/yaml.v3"
+)
+
+// maxSpecSize bounds how much of a spec document is read
+const maxSpecSize = 10 << 20
+
+// specMethods are the OpenAPI path item keys that name operations
+var specMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// Operation-level vendor extensions declaring an endpoint's performance
+// budget: milliseconds (or a duration such as "250ms") and a 0-1 fraction
+const (
+	ResponseTimeSLAExtension = "x-response-time-sla"
+	ErrorRateSLAExtension    = "x-error-rate-sla"
+)
+
+// SpecEndpoint is one operation declared by an OpenAPI/Swagger document
+type SpecEndpoint struct {
+	Method string
+	Path   string
+	// SLAResponseTime and SLAErrorRate are NULL unless the spec declares them
+	SLAResponseTime sql.NullInt64
+	SLAErrorRate    sql.NullFloat64
+}
+
+// FetchSpec downloads a spec document and works out its format
+func FetchSpec(ctx context.Context, client *http.Client, specURL string, headers http.Header) (doc []byte, format string, err error) {
+	ctx, span := StartSpan(ctx, "fetch spec", attribute.String("url.full", specURL))
+	defer func() { EndSpan(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, specURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("spec returned %s", resp.Status)
+	}
+
+	body, err := decodedBody(resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decompress spec: %w", err)
+	}
+	doc, err = io.ReadAll(io.LimitReader(body, maxSpecSize))
+	if err != nil {
+		return nil, "", err
+	}
+	if problem := specContentProblem(resp.Header.Get("Content-Type"), doc); problem != "" {
+		return nil, "", fmt.Errorf("not a spec: %s", problem)
+	}
+	format = SpecFormat(resp.Header.Get("Content-Type"), specURL, doc)
+	if err := ValidateSpecDocument(doc, format); err != nil {
+		return nil, "", fmt.Errorf("not a spec: %w", err)
+	}
+	return doc, format, nil
+}
+
+// ValidateSpecDocument checks that doc is an OpenAPI or Swagger document: it
+// parses as format and has an openapi or swagger version and a paths object.
+// SPAs answer unknown paths with their index page, and servers send other
+// JSON or YAML that isn't a spec.
+func ValidateSpecDocument(doc []byte, format string) error {
+	var spec map[string]interface{}
+	var err error
+	if format == SpecFormatJSON {
+		err = json.Unmarshal(doc, &spec)
+	} else {
+		err = yaml.Unmarshal(doc, &spec)
+	}
+	if err != nil || spec == nil {
+		return fmt.Errorf("does not parse as a %s object", format)
+	}
+	if spec["openapi"] == nil && spec["swagger"] == nil {
+		return fmt.Errorf("no openapi or swagger version")
+	}
+	if _, ok := spec["paths"].(map[string]interface{}); !ok {
+		return fmt.Errorf("no paths object")
+	}
+	return nil
+}
+
+// decodedBody returns the response body, gunzipped if needed. The transport
+// only decompresses when it asked for gzip itself, not when the request's
+// headers, such as a discovery headers parameter, set Accept-Encoding.
+func decodedBody(resp *http.Response) (io.Reader, error) {
+	if !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return gzip.NewReader(resp.Body)
+	}
+	return resp.Body, nil
+}
+
+// specContentProblem says why a response can't be a JSON or YAML spec, e.g.
+// a login page served with 200, or returns "" if it may be one. The type is
+// checked first; bodies are sniffed too, since servers label pages text/plain
+// or send no type at all.
+func specContentProblem(contentType string, doc []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.Contains(mediaType, "html"):
+		return "HTML page"
+	case mediaType == "", mediaType == "text/plain", mediaType == "application/octet-stream",
+		strings.Contains(mediaType, "json"), strings.Contains(mediaType, "yaml"), strings.Contains(mediaType, "yml"):
+	default:
+		return fmt.Sprintf("%s content, not JSON or YAML", mediaType)
+	}
+	if strings.HasPrefix(http.DetectContentType(doc), "text/html") {
+		return "HTML page"
+	}
+	return ""
+}
+
+// Formats a spec document can be served in
+const (
+	SpecFormatJSON = "json"
+	SpecFormatYAML = "yaml"
+)
+
+// SpecFormat works out whether a spec is JSON or YAML from its Content-Type,
+// then its URL's extension, then whether the document starts like JSON.
+// Servers often send YAML as text/plain, so the type alone isn't enough.
+func SpecFormat(contentType, specURL string, doc []byte) string {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "json"):
+		return SpecFormatJSON
+	case strings.Contains(contentType, "yaml"), strings.Contains(contentType, "yml"):
+		return SpecFormatYAML
+	}
+
+	path := specURL
+	if parsed, err := url.Parse(specURL); err == nil {
+		path = parsed.Path
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return SpecFormatJSON
+	case ".yaml", ".yml":
+		return SpecFormatYAML
+	}
+
+	if trimmed := bytes.TrimSpace(doc); len(trimmed) > 0 && trimmed[0] == '{' {
+		return SpecFormatJSON
+	}
+	return SpecFormatYAML
+}
+
+// ParseSpecEndpoints reads the operations from an OpenAPI 3 or Swagger 2
+// document in format. Both formats decode into the same structure, so a spec
+// yields the same endpoints either way. Paths are prefixed with the Swagger
+// basePath or the path of the first OpenAPI server, so they can be requested
+// directly.
+func ParseSpecEndpoints(doc []byte, format string) ([]SpecEndpoint, error) {
+	var spec struct {
+		BasePath string `json:"basePath" yaml:"basePath"`
+		Servers  []struct {
+			URL string `json:"url" yaml:"url"`
+		} `json:"servers" yaml:"servers"`
+		Paths map[string]map[string]interface{} `json:"paths" yaml:"paths"`
+	}
+	// JSON is also valid YAML, but yaml.v3 rejects things JSON parsers
+	// accept, such as duplicate keys, so JSON gets its own decoder
+	var err error
+	if format == SpecFormatJSON {
+		err = json.Unmarshal(doc, &spec)
+	} else {
+		err = yaml.Unmarshal(doc, &spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s spec: %w", format, err)
+	}
+
+	serverURL := ""
+	if len(spec.Servers) > 0 {
+		serverURL = spec.Servers[0].URL
+	}
+	prefix := specPathPrefix(spec.BasePath, serverURL)
+
+	endpoints := []SpecEndpoint{}
+	for path, item := range spec.Paths {
+		for method := range item {
+			if !specMethods[strings.ToLower(method)] {
+				continue
+			}
+			ep := SpecEndpoint{Method: strings.ToUpper(method), Path: prefix + path}
+			if operation, ok := item[method].(map[string]interface{}); ok {
+				ep.SLAResponseTime = responseTimeSLA(operation[ResponseTimeSLAExtension])
+				ep.SLAErrorRate = errorRateSLA(operation[ErrorRateSLAExtension])
+			}
+			endpoints = append(endpoints, ep)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints, nil
+}
+
+// specPathPrefix returns what a spec's paths are served under: the path of
+// the first OpenAPI server, or the Swagger basePath
+func specPathPrefix(basePath, serverURL string) string {
+	prefix := basePath
+	if serverURL != "" && !strings.Contains(serverURL, "{") {
+		if server, err := url.Parse(serverURL); err == nil {
+			prefix = server.Path
+		}
+	}
+	return strings.TrimSuffix(prefix, "/")
+}
+
+// responseTimeSLA reads an x-response-time-sla value: milliseconds as a
+// number, or a duration string. Anything else leaves the SLA unset.
+func responseTimeSLA(value interface{}) sql.NullInt64 {
+	var ms float64
+	switch v := value.(type) {
+	case int:
+		ms = float64(v)
+	case float64:
+		ms = v
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return sql.NullInt64{}
+			}
+			d = time.Duration(parsed * float64(time.Millisecond))
+		}
+		ms = float64(d) / float64(time.Millisecond)
+	default:
+		return sql.NullInt64{}
+	}
+	if ms <= 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(math.Round(ms)), Valid: true}
+}
+
+// errorRateSLA reads an x-error-rate-sla value, a fraction between 0 and 1.
+// Anything else leaves the SLA unset.
+func errorRateSLA(value interface{}) sql.NullFloat64 {
+	var rate float64
+	switch v := value.(type) {
+	case int:
+		rate = float64(v)
+	case float64:
+		rate = v
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return sql.NullFloat64{}
+		}
+		rate = parsed
+	default:
+		return sql.NullFloat64{}
+	}
+	if rate < 0 || rate > 1 {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: rate, Valid: true}
+}
+
+// StoreSpecEndpoints records a spec's operations, with any SLAs they
+// declare, in the endpoints table
+func StoreSpecEndpoints(db *DB, specId int64, endpoints []SpecEndpoint) error {
+	for _, ep := range endpoints {
+		if _, err := db.Exec("INSERT INTO endpoints (spec_id, path, method, sla_response_time, sla_error_rate) VALUES (?, ?, ?, ?, ?)",
+			specId, ep.Path, ep.Method, ep.SLAResponseTime, ep.SLAErrorRate); err != nil {
+			return fmt.Errorf("failed to store endpoint %s %s: %w", ep.Method, ep.Path, err)
+		}
+	}
+	return nil
+}
+
+// StoreDiscoveredSpec records a discovered spec for the session, along with
+// its document and endpoints when it can be fetched, and returns how many
+// endpoints were stored. serviceId is 0 when the spec's service is unknown.
+func StoreDiscoveredSpec(ctx context.Context, db *DB, client *http.Client, sessionId, serviceId int64, specURL string, headers http.Header) (int, error) {
+	specId, err := db.Insert("INSERT INTO api_specs (session_id, service_id, spec_url) VALUES (?, ?, ?)",
+		sessionId, sql.NullInt64{Int64: serviceId, Valid: serviceId != 0}, specURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store spec: %w", err)
+	}
+
+	doc, format, err := FetchSpec(ctx, client, specURL, headers)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read endpoints from %s: %w", specURL, err)
+	}
+	// The document is kept for what the endpoints table doesn't hold, such
+	// as response schemas
+	if _, err := db.Exec("UPDATE api_specs SET spec_content = ? WHERE id = ?", string(doc), specId); err != nil {
+		return 0, fmt.Errorf("failed to store spec document: %w", err)
+	}
+	endpoints, err := ParseSpecEndpoints(doc, format)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read endpoints from %s: %w", specURL, err)
+	}
+	return len(endpoints), StoreSpecEndpoints(db, specId, endpoints)
+}
+
+// DiscoveredTestPaths returns the distinct GET paths without path parameters
+// from the session's discovered specs, which can be requested as they are.
+// A non-empty service limits them to that service's specs.
+func DiscoveredTestPaths(db *DB, sessionId int64, service string) ([]string, error) {
+	query := `
+		SELECT DISTINCT e.path
+		FROM endpoints e
+		JOIN api_specs a ON e.spec_id = a.id
+		LEFT JOIN services s ON a.service_id = s.id
+		WHERE a.session_id = ? AND e.method = 'GET' AND e.path NOT LIKE '%{%'`
+	args := []interface{}{sessionId}
+	if service != "" {
+		query += " AND s.name = ?"
+		args = append(args, service)
+	}
+	query += " ORDER BY e.path"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := []string{}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
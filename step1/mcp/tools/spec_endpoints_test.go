@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSpecEndpointsJSONAndYAMLMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		json      string
+		yaml      string
+		wantCount int
+		wantFirst string
+	}{
+		{
+			name: "openapi 3",
+			json: `{
+  "openapi": "3.0.0",
+  "servers": [{"url": "http://localhost:8080/api/v1/"}],
+  "paths": {
+    "/pets": {
+      "parameters": [{"name": "limit", "in": "query"}],
+      "get": {"x-response-time-sla": 200, "x-error-rate-sla": 0.01},
+      "post": {"x-response-time-sla": "1.5s"}
+    },
+    "/pets/{id}": {
+      "get": {},
+      "delete": {"x-error-rate-sla": "0.05"}
+    }
+  }
+}`,
+			yaml: `openapi: 3.0.0
+servers:
+  - url: http://localhost:8080/api/v1/
+paths:
+  /pets:
+    parameters:
+      - name: limit
+        in: query
+    get:
+      x-response-time-sla: 200
+      x-error-rate-sla: 0.01
+    post:
+      x-response-time-sla: 1.5s
+  /pets/{id}:
+    get: {}
+    delete:
+      x-error-rate-sla: "0.05"
+`,
+			wantCount: 4,
+			wantFirst: "GET /api/v1/pets",
+		},
+		{
+			name: "swagger 2",
+			json: `{
+  "swagger": "2.0",
+  "basePath": "/v2",
+  "paths": {
+    "/users": {"get": {"x-response-time-sla": "300ms"}, "put": {}}
+  }
+}`,
+			yaml: `swagger: "2.0"
+basePath: /v2
+paths:
+  /users:
+    get:
+      x-response-time-sla: 300ms
+    put: {}
+`,
+			wantCount: 2,
+			wantFirst: "GET /v2/users",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fromJSON, err := ParseSpecEndpoints([]byte(tt.json), SpecFormatJSON)
+			if err != nil {
+				t.Fatalf("JSON spec: %v", err)
+			}
+			fromYAML, err := ParseSpecEndpoints([]byte(tt.yaml), SpecFormatYAML)
+			if err != nil {
+				t.Fatalf("YAML spec: %v", err)
+			}
+			if len(fromJSON) != tt.wantCount {
+				t.Fatalf("parsed %d endpoints, want %d: %+v", len(fromJSON), tt.wantCount, fromJSON)
+			}
+			if first := fromJSON[0].Method + " " + fromJSON[0].Path; first != tt.wantFirst {
+				t.Errorf("first endpoint = %q, want %q", first, tt.wantFirst)
+			}
+			if !reflect.DeepEqual(fromJSON, fromYAML) {
+				t.Errorf("endpoints differ\nJSON: %+v\nYAML: %+v", fromJSON, fromYAML)
+			}
+		})
+	}
+}
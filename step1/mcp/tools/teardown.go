@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// TeardownEnvironmentTool handles the teardown_environment tool
+type TeardownEnvironmentTool struct {
+	deps *SharedDependencies
+}
+
+// NewTeardownEnvironmentTool creates a new instance of TeardownEnvironmentTool
+func NewTeardownEnvironmentTool(deps *SharedDependencies) *TeardownEnvironmentTool {
+	return &TeardownEnvironmentTool{deps: deps}
+}
+
+// Handle processes the teardown_environment request. Only projects the
+// tools left running, with keepContainers or reuseEnvironment, can be torn
+// down, so a stack started by hand is never removed by mistake.
+func (t *TeardownEnvironmentTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	projectName := request.GetString("projectName", "")
+	sessionId := request.GetString("sessionId", "")
+	if (projectName == "") == (sessionId == "") {
+		return mcpgolang.NewToolResultError("Provide either projectName or sessionId"), nil
+	}
+
+	if sessionId != "" {
+		err := t.deps.DB.QueryRow("SELECT project_name FROM test_sessions WHERE id = ? AND status = ? AND project_name IS NOT NULL",
+			sessionId, SessionStatusLeftRunning).Scan(&projectName)
+		if err != nil {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Session %s has no containers left running", sessionId)), nil
+		}
+	} else {
+		kept, err := LeftRunningProjects(t.deps.DB)
+		if err != nil {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to list running environments: %v", err)), nil
+		}
+		if !kept[projectName] {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Compose project %s was not left running by a test run; stop it with docker compose -p %s down", projectName, projectName)), nil
+		}
+	}
+
+	stopStart := time.Now()
+	err := RemoveProject(projectName)
+	t.deps.Logger.LogContainerOperation("stop", projectName, time.Since(stopStart), err, nil)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	t.deps.DB.Exec("UPDATE test_sessions SET status = ?, completed_at = COALESCE(completed_at, CURRENT_TIMESTAMP) WHERE project_name = ? AND status = ?",
+		"completed", projectName, SessionStatusLeftRunning)
+
+	return mcpgolang.NewToolResultText(fmt.Sprintf("Compose project %s has been stopped and removed.\n", projectName)), nil
+}
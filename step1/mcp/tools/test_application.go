@@ -2,16 +2,21 @@ package tools
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	mcpgolang "github.com/mark3labs/mcp-go/mcp"
-	"gopkg.in/yaml.v3"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // TestApplicationTool handles the test_application tool
@@ -25,7 +30,7 @@ func NewTestApplicationTool(deps *SharedDependencies) *TestApplicationTool {
 }
 
 // Handle processes the test_application request
-func (t *TestApplicationTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+func (t *TestApplicationTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (toolResult *mcpgolang.CallToolResult, err error) {
 	composeSource, err := request.RequireString("composeSource")
 	if err != nil {
 		t.deps.Logger.LogError("Missing required composeSource", err, nil)
@@ -34,50 +39,193 @@ func (t *TestApplicationTool) Handle(ctx context.Context, request mcpgolang.Call
 
 	testType := request.GetString("testType", "standard")
 	endpoints := request.GetString("endpoints", "")
+	p95ThresholdMs := request.GetFloat("p95ThresholdMs", DefaultP95ThresholdMs)
+	maxErrorRate := request.GetFloat("maxErrorRate", DefaultMaxErrorRate)
+	if err := ValidateThresholds(p95ThresholdMs, maxErrorRate); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	concurrentRequests := request.GetString("concurrentRequests", "false") == "true"
+	dryRun := request.GetString("dryRun", "false") == "true"
+	keepContainers := KeepContainers(request.GetString("keepContainers", ""))
+	k6ExtraArgs, err := ParseK6ExtraArgs(request.GetString("k6ExtraArgs", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid k6ExtraArgs: %v", err)), nil
+	}
+	envVars, err := ParseK6EnvVars(request.GetString("envVars", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid envVars: %v", err)), nil
+	}
+	tags, err := ParseRunTags(request.GetString("tags", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid tags: %v", err)), nil
+	}
+	metadata, err := ParseRunMetadata(request.GetString("gitSha", ""), request.GetString("buildId", ""))
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	startupWait, err := StartupWait(request.GetString("startupWait", ""), 15*time.Second)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	profiles := ParseProfiles(request.GetString("profiles", ""))
+	tlsOptions := NewTLSOptions(request.GetString("insecureSkipTLSVerify", "false"), request.GetString("http2", "false"))
+	schemes, err := ParseSchemes(request.GetString("schemes", ""), tlsOptions.DefaultScheme())
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Invalid schemes: %v", err)), nil
+	}
 
 	t.deps.Logger.LogInfo("Starting automated application testing", map[string]interface{}{
 		"composeSource": composeSource,
 		"testType":      testType,
 		"endpoints":     endpoints,
+		"env_vars":      envVars.Keys(),
 	})
 
-	// Full automated flow
-	report := "# Automated Application Testing\n\n"
+	// Full automated flow; step is the markdown of the current step, added
+	// to the report as its section when the next one starts
+	run := applicationRun{TestType: testType}
+	report := ToolReport{Title: "Automated Application Testing", Status: "passed", Data: &run}
+	step := ""
 
 	// Step 1: Setup environment
-	report += "## Step 1: Setting up environment\n"
-	t.sendProgress(ctx, "Setting up test environment", map[string]interface{}{"step": 1})
-	content, err := FetchComposeContent(composeSource)
+	t.deps.SendProgress(ctx, "Setting up test environment", map[string]interface{}{"step": 1})
+	content, err := FetchComposeContent(ctx, composeSource)
 	if err != nil {
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to fetch compose file: %v", err)), nil
 	}
 
-	composeFileId, err := StoreComposeFile(t.deps.DB, composeSource, content)
+	compose, warnings, err := ValidateCompose(content)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	for _, warning := range warnings {
+		step += fmt.Sprintf("- Warning: %s\n", warning)
+	}
+	if err := ValidateProfiles(compose, profiles); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	// Services outside the profiles are never started, so aren't tested
+	compose = compose.WithProfiles(profiles)
+	if len(profiles) > 0 {
+		step += fmt.Sprintf("- Profiles: %s\n", strings.Join(profiles, ", "))
+	}
+
+	// Generate test based on type
+	var testVus int
+	var testDuration string
+	switch testType {
+	case "quick":
+		testVus = 10
+		testDuration = "30s"
+	case "thorough":
+		testVus = 100
+		testDuration = "5m"
+	case "all-services":
+		// Per-service load; services in a batch run concurrently
+		testVus = 10
+		testDuration = "1m"
+	default:
+		testVus = 50
+		testDuration = "2m"
+	}
+	run.VUs, run.Duration = testVus, testDuration
+	if err := CheckVULimit(fmt.Sprintf("The %s test's VUs", testType), testVus); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+
+	// Single-target tests hit targetService, else the first service by name
+	// with a published port
+	targetService := request.GetString("targetService", "")
+	if targetService != "" && testType == "all-services" {
+		return mcpgolang.NewToolResultError("targetService can't be combined with testType=all-services, which tests every service"), nil
+	}
+	testService, testPort, err := TargetService(*compose, targetService)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if testPort == "" {
+		testPort = "8080" // fallback
+	}
+	if testType != "all-services" && testService != "" {
+		step += fmt.Sprintf("- Target service: %s (port %s)\n", testService, testPort)
+	}
+	// HTTP/2 needs every service the run targets to be reached over https
+	targets := []string{testService}
+	if testType == "all-services" {
+		targets = publishedServices(*compose)
+	}
+	for _, name := range targets {
+		target := "the target"
+		if name != "" {
+			target = "service " + name
+		}
+		if err := tlsOptions.CheckScheme(target, schemes.For(name)); err != nil {
+			return mcpgolang.NewToolResultError(err.Error()), nil
+		}
+	}
+	if tlsOptions.HTTP2 {
+		step += "- HTTP/2: required, a request that falls back to HTTP/1.1 fails the run\n"
+	}
+	if tlsOptions.InsecureSkipTLSVerify {
+		step += "- TLS certificate verification: skipped\n"
+	}
+	step += metadata.Lines()
+
+	// Create test script with endpoint filtering; without endpoints the
+	// test covers what discovery finds, or just / until then
+	var testEndpoints []string
+	if endpoints != "" {
+		// Parse comma-separated endpoints
+		for _, ep := range strings.Split(endpoints, ",") {
+			testEndpoints = append(testEndpoints, strings.TrimSpace(ep))
+		}
+	} else {
+		testEndpoints = []string{"/"}
+	}
+
+	if dryRun {
+		report.Status = "dry run"
+		report.Summary = DryRunNotice + " Discovery is skipped, so without endpoints the script only requests /."
+		run.Endpoints = testEndpoints
+		report.AddSection("Step 1: Setting up environment", step)
+		report.AddSection("Docker Compose", "```yaml\n"+strings.TrimRight(content, "\n")+"\n```")
+		if testType == "all-services" {
+			for i, batch := range allServicesBatches(*compose, testEndpoints, concurrentRequests, testVus, testDuration, p95ThresholdMs, maxErrorRate, nil, schemes, tlsOptions) {
+				report.AddSection(fmt.Sprintf("k6 Script %d: %s", i+1, strings.Join(batch.Services, ", ")), "```javascript\n"+strings.TrimRight(batch.Script, "\n")+"\n```")
+			}
+		} else {
+			report.AddSection("k6 Script", "```javascript\n"+autoTestScript(testVus, testDuration, LocalBaseURL(schemes.For(testService), testPort), testEndpoints, concurrentRequests, p95ThresholdMs, maxErrorRate, nil, tlsOptions)+"\n```")
+		}
+		return report.Result(), nil
+	}
+
+	composeFile, err := StoreComposeFile(t.deps.DB, composeSource, content)
 	if err != nil {
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to store compose file: %v", err)), nil
 	}
+	metadata.ComposeHash = composeFile.Hash
 
 	// Create session
 	sessionName := fmt.Sprintf("auto-test-%d", time.Now().Unix())
-	result, err := t.deps.DB.Exec("INSERT INTO test_sessions (compose_file_id, session_name, status) VALUES (?, ?, ?)",
-		composeFileId, sessionName, "running")
+	sessionId, err := t.deps.DB.Insert("INSERT INTO test_sessions (compose_file_id, session_name, status, profiles) VALUES (?, ?, ?, ?)",
+		composeFile.ID, sessionName, "running", ProfilesColumn(profiles))
 	if err != nil {
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to create session: %v", err)), nil
 	}
-	sessionId, _ := result.LastInsertId()
+	SetSpanAttributes(ctx, attribute.Int64("session.id", sessionId))
+	run.SessionID = sessionId
 
-	// Parse compose to store services
-	var compose ComposeFile
-	yaml.Unmarshal([]byte(content), &compose)
+	// Store services
 	for name, service := range compose.Services {
 		ports := strings.Join(service.Ports, ",")
 		t.deps.DB.Exec("INSERT INTO services (session_id, name, image, ports) VALUES (?, ?, ?, ?)",
 			sessionId, name, service.Image, ports)
 	}
-	report += fmt.Sprintf("- Created session %d with %d services\n", sessionId, len(compose.Services))
+	step += fmt.Sprintf("- Created session %d with %d services\n", sessionId, len(compose.Services))
 
 	// Step 2: Start containers and discover APIs
-	report += "\n## Step 2: Discovering APIs\n"
+	report.AddSection("Step 1: Setting up environment", step)
+	step = ""
 	composePath, err := WriteComposeToTemp(content, sessionId)
 	if err != nil {
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to write compose: %v", err)), nil
@@ -85,178 +233,653 @@ func (t *TestApplicationTool) Handle(ctx context.Context, request mcpgolang.Call
 	defer os.RemoveAll(filepath.Dir(composePath))
 
 	projectName := fmt.Sprintf("auto-%d", sessionId)
-	startCmd := exec.CommandContext(ctx, "docker", "compose", "-f", composePath, "-p", projectName, "up", "-d")
-	if output, err := startCmd.CombinedOutput(); err != nil {
+	if err := PullImages(ctx, t.deps, composePath, projectName, profiles); err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to pull images: %v", err)), nil
+	}
+	project, ctx, output, err := StartComposeProject(ctx, t.deps, composePath, projectName, profiles)
+	if err != nil {
 		return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to start containers: %v\n%s", err, output)), nil
 	}
 
-	// Ensure cleanup
+	// Ensure cleanup, unless the containers are wanted for inspection
 	defer func() {
-		stopCmd := exec.Command("docker", "compose", "-f", composePath, "-p", projectName, "down", "-v")
-		stopCmd.Run()
+		if keepContainers {
+			if err := KeepProject(t.deps.DB, project, sessionId); err != nil {
+				t.deps.Logger.LogError("Failed to mark session left running", err, map[string]interface{}{
+					"session_id": sessionId,
+				})
+			}
+			// Reports carry the hint themselves; errors before the run get it appended
+			if toolResult != nil && toolResult.IsError && len(toolResult.Content) == 1 {
+				toolResult.Content = append(toolResult.Content, mcpgolang.NewTextContent(KeptProjectHint(projectName)))
+			}
+			return
+		}
+
+		project.Stop()
 		t.deps.DB.Exec("UPDATE test_sessions SET completed_at = CURRENT_TIMESTAMP, status = ? WHERE id = ?",
 			"completed", sessionId)
 	}()
 
-	time.Sleep(15 * time.Second) // Wait for services
+	if err := WaitForStartup(ctx, startupWait); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if err := CheckServicesStarted(t.deps, project); err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
 
 	// Discover specs
 	discovered := 0
-	commonPaths := []string{"/openapi.json", "/swagger.json", "/api-docs", "/api/v3/openapi.json"}
+	commonPaths := []string{"/openapi.json", "/swagger.json", "/api-docs", "/api/v3/openapi.json", "/openapi.yaml"}
+	client := &http.Client{
+		Timeout: DefaultProbeTimeoutSeconds * time.Second,
+		// As in discover_api_specs, probes only check the local stack is up,
+		// whatever certificate its https services present
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	probeCtx, cancelProbes := context.WithTimeout(ctx, discoveryProbeBudget)
+	defer cancelProbes()
 
 	rows, _ := t.deps.DB.Query("SELECT id, name, ports FROM services WHERE session_id = ?", sessionId)
 	defer rows.Close()
 
 	for rows.Next() {
-		var id int
+		var id int64
 		var name, ports string
 		rows.Scan(&id, &name, &ports)
 
 		portList := strings.Split(ports, ",")
 		if len(portList) > 0 && portList[0] != "" {
-			port := strings.Split(portList[0], ":")[0]
-			baseURL := fmt.Sprintf("http://localhost:%s", port)
-
-			for _, path := range commonPaths {
-				url := baseURL + path
-				resp, err := http.Get(url)
-				if err == nil && resp.StatusCode == 200 {
-					discovered++
-					t.deps.DB.Exec("INSERT INTO api_specs (session_id, spec_url) VALUES (?, ?)", sessionId, url)
-					report += fmt.Sprintf("- Found API spec: %s\n", url)
-					resp.Body.Close()
-					break
+			port := PublishedPort(portList[0])
+			baseURL := LocalBaseURL(schemes.For(name), port)
+
+			if found, _ := probeServiceSpecs(probeCtx, t.deps.Logger, client, name, baseURL, commonPaths, nil); len(found) > 0 {
+				discovered++
+				step += fmt.Sprintf("- Found API spec: %s\n", found[0])
+				if count, err := StoreDiscoveredSpec(ctx, t.deps.DB, client, sessionId, id, found[0], nil); err != nil {
+					step += fmt.Sprintf("  - %v\n", err)
+				} else {
+					step += fmt.Sprintf("  - %d endpoints\n", count)
 				}
 			}
 		}
 	}
 
+	if endpoints == "" {
+		// all-services scripts share one endpoint list, so they take every
+		// service's discovered paths
+		service := testService
+		if testType == "all-services" {
+			service = ""
+		}
+		if paths, err := DiscoveredTestPaths(t.deps.DB, sessionId, service); err == nil && len(paths) > 0 {
+			testEndpoints = paths
+		}
+	}
+
+	// Pre-flight: don't spend the whole duration load-testing a dead stack
+	if testType == "all-services" {
+		names := make([]string, 0, len(compose.Services))
+		for name := range compose.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		alive := ComposeFile{Services: map[string]Service{}}
+		for _, name := range names {
+			service := compose.Services[name]
+			if len(service.Ports) == 0 {
+				continue
+			}
+			baseURL := LocalBaseURL(schemes.For(name), PublishedPort(service.Ports[0]))
+			status, ok := probeTarget(ctx, client, baseURL)
+			if !ok {
+				step += fmt.Sprintf("- Pre-flight check: %s (%s) is not responding, skipping it: %s\n", name, baseURL, status)
+				continue
+			}
+			step += fmt.Sprintf("- Pre-flight check: %s (%s) %s\n", name, baseURL, status)
+			alive.Services[name] = service
+		}
+		if len(alive.Services) == 0 {
+			return mcpgolang.NewToolResultError(t.deadTargetError("No service is responding, so no test was run", project)), nil
+		}
+		compose = &alive
+	} else {
+		baseURL := LocalBaseURL(schemes.For(testService), testPort)
+		if override, ok := envVars["BASE_URL"]; ok {
+			baseURL = strings.TrimRight(override, "/")
+		}
+		status, ok := probeTarget(ctx, client, baseURL)
+		if !ok {
+			return mcpgolang.NewToolResultError(t.deadTargetError(
+				fmt.Sprintf("Target %s is not responding, so no test was run: %s", baseURL, status), project)), nil
+		}
+		step += fmt.Sprintf("- Pre-flight check: %s %s\n", baseURL, status)
+	}
+
 	// Step 3: Generate and run tests
-	report += fmt.Sprintf("\n## Step 3: Running %s tests\n", testType)
+	report.AddMetric("specs_discovered", float64(discovered))
+	report.AddSection("Step 2: Discovering APIs", step)
+	step = ""
+	run.Endpoints = testEndpoints
+	stepHeading := fmt.Sprintf("Step 3: Running %s tests", testType)
+	keptHint := ""
+	if keepContainers {
+		keptHint = KeptProjectHint(projectName)
+	}
 	if endpoints != "" {
-		report += fmt.Sprintf("- Testing specific endpoints: %s\n", endpoints)
+		step += fmt.Sprintf("- Testing specific endpoints: %s\n", endpoints)
+	} else if len(testEndpoints) == 1 && testEndpoints[0] == "/" {
+		step += "- No GET endpoints discovered, testing /\n"
+	} else {
+		step += fmt.Sprintf("- Testing discovered endpoints: %s\n", strings.Join(testEndpoints, ", "))
+	}
+	if testType != "all-services" {
+		if warning := HighLoadWarning(testVus, len(testEndpoints)); warning != "" {
+			step += fmt.Sprintf("- %s\n", warning)
+		}
 	}
 
-	// Generate test based on type
-	var testVus int
-	var testDuration string
-	switch testType {
-	case "quick":
-		testVus = 10
-		testDuration = "30s"
-	case "thorough":
-		testVus = 100
-		testDuration = "5m"
-	default:
-		testVus = 50
-		testDuration = "2m"
+	if testType == "all-services" {
+		results, err := t.runAllServices(ctx, sessionId, *compose, testEndpoints, concurrentRequests, testVus, testDuration, p95ThresholdMs, maxErrorRate, k6ExtraArgs, envVars, tags, metadata, schemes, tlsOptions)
+		report.AddSection(stepHeading, step+results)
+		report.AddSection("", keptHint)
+		report.Summary = fmt.Sprintf("Tested %d services in session %d", len(publishedServices(*compose)), sessionId)
+		if err != nil {
+			report.Status = "failed"
+			report.Summary = fmt.Sprintf("Testing session %d failed: %v", sessionId, err)
+			result := report.Result()
+			result.IsError = true
+			return result, nil
+		}
+		return report.Result(), nil
 	}
 
-	// Get port from first service
-	var testPort string
-	for _, service := range compose.Services {
-		if len(service.Ports) > 0 {
-			testPort = strings.Split(service.Ports[0], ":")[0]
-			break
+	// SLAs from the discovered specs become thresholds, so k6 fails the run
+	// when an endpoint misses one
+	slas, err := SessionEndpointSLAs(t.deps.DB, sessionId, testService)
+	if err != nil {
+		t.deps.Logger.LogError("Failed to load endpoint SLAs", err, map[string]interface{}{"session_id": sessionId})
+	}
+	if covered := slaCoverage(getTargets(testEndpoints), slas); covered > 0 {
+		step += fmt.Sprintf("- SLA thresholds: %d of %d endpoints\n", covered, len(testEndpoints))
+	}
+	testScript := autoTestScript(testVus, testDuration, LocalBaseURL(schemes.For(testService), testPort), testEndpoints, concurrentRequests, p95ThresholdMs, maxErrorRate, slas, tlsOptions)
+
+	// Store and run test
+	testId, _ := t.deps.DB.Insert("INSERT INTO tests (session_id, name, type, script) VALUES (?, ?, ?, ?)",
+		sessionId, "auto-load-test", "load", testScript)
+
+	// Write test script
+	tmpFile, _ := os.CreateTemp("", "k6-auto-test-*.js")
+	tmpFile.WriteString(testScript)
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	// Run test
+	resultsDir, err := ResultsDir()
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	runId, _ := t.deps.DB.Insert("INSERT INTO test_runs (test_id, vus, duration) VALUES (?, ?, ?)",
+		testId, testVus, testDuration)
+	if err := StoreRunTags(t.deps.DB, runId, tags); err != nil {
+		t.deps.Logger.LogError("Failed to store run tags", err, map[string]interface{}{"run_id": runId})
+	}
+	if _, err := StoreRunMetadata(t.deps.DB, runId, metadata); err != nil {
+		t.deps.Logger.LogError("Failed to store run metadata", err, map[string]interface{}{"run_id": runId})
+	}
+	defer TrackRun(runId)()
+	SetSpanAttributes(ctx, attribute.Int64("test.id", testId), attribute.Int64("run.id", runId))
+	run.RunID = runId
+
+	outputFile := K6ResultsPath(resultsDir, runId)
+	args := append([]string{"run",
+		"--vus", fmt.Sprintf("%d", testVus),
+		"--duration", testDuration,
+		"--out", fmt.Sprintf("json=%s", outputFile)}, k6ExtraArgs...)
+	args = append(args, envVars.Args()...)
+	k6Cmd := exec.CommandContext(ctx, K6Binary(), append(args, tmpFile.Name())...)
+
+	expected, _ := time.ParseDuration(testDuration)
+	stopProgress := TrackRunProgress(ctx, expected, func(data map[string]interface{}) {
+		data["step"] = 3
+		data["run_id"] = runId
+		t.deps.SendProgress(ctx, "Running load test", data)
+	})
+	k6Output, k6Stderr, k6Err := RunK6(ctx, k6Cmd)
+	stopProgress()
+	interrupted := RunInterrupted(ctx)
+	if interrupted {
+		step += "- Interrupted by server shutdown; the partial results are recorded\n"
+	} else if k6Err != nil {
+		t.deps.Logger.LogError("k6 test execution failed", k6Err, map[string]interface{}{
+			"run_id": runId,
+			"stderr": string(k6Stderr),
+		})
+		step += "- " + K6Failure("k6 exited with error", k6Err, nil, k6Stderr) + "\n"
+	}
+	step += fmt.Sprintf("- Test completed with %d VUs for %s\n", testVus, testDuration)
+	report.AddSection(stepHeading, step)
+	report.AddSection("Results Summary", "```\n"+strings.TrimSpace(string(k6Output))+"\n```")
+	report.Artifacts = map[string]string{"results": outputFile}
+
+	// Update session
+	t.deps.DB.Exec("UPDATE test_runs SET completed_at = CURRENT_TIMESTAMP, results = ?, stderr = ?, results_file = ?, exit_code = ? WHERE id = ?",
+		string(k6Output), string(k6Stderr), outputFile, K6ExitCode(k6Err), runId)
+	if interrupted {
+		if err := MarkRunInterrupted(t.deps.DB, runId); err != nil {
+			t.deps.Logger.LogError("Failed to mark run interrupted", err, map[string]interface{}{"run_id": runId})
 		}
 	}
-	if testPort == "" {
-		testPort = "8080" // fallback
+
+	// Store per-endpoint metrics from the name-tagged requests
+	metrics, customMetrics, err := ParseAndStoreMetrics(t.deps.DB, runId, outputFile, testService)
+	if err != nil {
+		t.deps.Logger.LogError("Failed to parse k6 metrics", err, map[string]interface{}{
+			"run_id":      runId,
+			"output_file": outputFile,
+		})
 	}
+	if len(customMetrics) > 0 {
+		report.AddSection("Custom Metrics", CustomMetricsSection(customMetrics))
+	}
+	var requests int64
+	for _, m := range metrics {
+		requests += int64(m.Requests())
+	}
+	report.AddMetric("endpoints", float64(len(metrics)))
+	report.AddMetric("requests", float64(requests))
 
-	// Create test script with endpoint filtering
-	var testEndpoints []string
-	if endpoints != "" {
-		// Parse comma-separated endpoints
-		for _, ep := range strings.Split(endpoints, ",") {
-			testEndpoints = append(testEndpoints, strings.TrimSpace(ep))
+	// The containers are still up, so their logs can explain a failed run
+	if !interrupted && (k6Err != nil || RunFailed(true, metrics)) {
+		if logs := CollectServiceLogs(t.deps, project, runId); logs != "" {
+			report.AddSection("", ServiceLogsSection(logs))
 		}
-	} else {
-		// Default endpoints based on discovered specs
-		testEndpoints = []string{"/", "/api/health", "/api/v3/pet"}
 	}
+	report.AddSection("", keptHint)
+
+	report.Status = K6ExitStatus(K6ExitCode(k6Err))
+	if interrupted {
+		report.Status = RunStatusInterrupted
+	}
+	report.Summary = fmt.Sprintf("Run %d of session %d: %s", runId, sessionId, report.Status)
+
+	// Crossed thresholds are reported above; the run itself completed
+	result := report.Result()
+	result.IsError = k6Err != nil && !K6ThresholdsCrossed(k6Err) && !interrupted
+	return result, nil
+}
+
+// applicationRun is the data of a test_application report
+type applicationRun struct {
+	SessionID int64    `json:"session_id,omitempty"`
+	TestType  string   `json:"test_type"`
+	VUs       int      `json:"vus"`
+	Duration  string   `json:"duration"`
+	Endpoints []string `json:"endpoints,omitempty"`
+	// RunID is unset for all-services tests, which make one run per batch
+	RunID int64 `json:"run_id,omitempty"`
+}
+
+// getTargets returns the GET requests test_application makes to endpoints
+func getTargets(endpoints []string) []EndpointSpec {
+	targets := make([]EndpointSpec, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		targets = append(targets, EndpointSpec{Method: "GET", Path: endpoint})
+	}
+	return targets
+}
 
-	// Generate test script
-	testScript := fmt.Sprintf(`import http from 'k6/http';
+// autoTestScript generates the single-target load test test_application
+// runs, with a threshold for each endpoint in slas
+func autoTestScript(vus int, duration, baseURL string, endpoints []string, concurrent bool, p95ThresholdMs, maxErrorRate float64, slas map[string]EndpointSLA, tlsOptions TLSOptions) string {
+	return fmt.Sprintf(`import http from 'k6/http';
 import { check, group } from 'k6';
 
 export const options = {
   vus: %d,
   duration: '%s',
-  thresholds: {
-    http_req_duration: ['p(95)<500'],
-    http_req_failed: ['rate<0.1'],
-  },
+  %s
 };
 
-const BASE_URL = 'http://localhost:%s';
+const BASE_URL = __ENV.BASE_URL || '%s';
 const endpoints = %s;
 
 export default function () {
-  endpoints.forEach(endpoint => {
+%s
+}`, vus, duration, tlsOptions.Apply(withEndpointThresholds(GenerateThresholds(p95ThresholdMs, maxErrorRate), false, getTargets(endpoints), slas, "")), baseURL, GenerateJSArray(endpoints),
+		endpointRequestsJS(concurrent, "BASE_URL", "", p95ThresholdMs))
+}
+
+// endpointRequestsJS returns script statements that GET every endpoint under
+// baseURL, a JS expression, and check each response; extraTags adds tags
+// after the endpoint name. Sequential requests run one after another in a
+// group per endpoint. Concurrent ones are sent together with http.batch, as
+// a client that parallelizes its calls would send them, and each response
+// still gets its own checks.
+func endpointRequestsJS(concurrent bool, baseURL, extraTags string, p95ThresholdMs float64) string {
+	if concurrent {
+		return fmt.Sprintf(`  const responses = http.batch(endpoints.map(endpoint => ['GET', %s + endpoint, null, { tags: { name: endpoint%s } }]));
+  responses.forEach((res, i) => {
+    check(res, {
+      'status is 200': (r) => r.status === 200,
+      'response time < %gms': (r) => r.timings.duration < %g,
+    }, { endpoint: endpoints[i] });
+  });`, baseURL, extraTags, p95ThresholdMs, p95ThresholdMs)
+	}
+	return fmt.Sprintf(`  endpoints.forEach(endpoint => {
     group('Testing ' + endpoint, () => {
-      const res = http.get(BASE_URL + endpoint);
+      const res = http.get(%s + endpoint, { tags: { name: endpoint%s } });
       check(res, {
         'status is 200': (r) => r.status === 200,
-        'response time < 500ms': (r) => r.timings.duration < 500,
+        'response time < %gms': (r) => r.timings.duration < %g,
       });
     });
-  });
-}`, testVus, testDuration, testPort, GenerateJSArray(testEndpoints))
+  });`, baseURL, extraTags, p95ThresholdMs, p95ThresholdMs)
+}
 
-	// Store and run test
-	testResult, _ := t.deps.DB.Exec("INSERT INTO tests (session_id, name, type, script) VALUES (?, ?, ?, ?)",
-		sessionId, "auto-load-test", "load", testScript)
-	testId, _ := testResult.LastInsertId()
+// maxConcurrentServices caps how many services are load-tested in a single k6 run
+const maxConcurrentServices = 4
+
+var scenarioNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// scenarioNames maps each service to its k6 scenario name. Names that
+// sanitize to the same scenario, e.g. my-svc and my_svc, get a numeric
+// suffix in sorted order: svc_my_svc, svc_my_svc_2.
+func scenarioNames(services []string) map[string]string {
+	sorted := append([]string(nil), services...)
+	sort.Strings(sorted)
+
+	names := make(map[string]string, len(sorted))
+	taken := make(map[string]bool, len(sorted))
+	for _, service := range sorted {
+		base := "svc_" + scenarioNameSanitizer.ReplaceAllString(service, "_")
+		scenario := base
+		for n := 2; taken[scenario]; n++ {
+			scenario = fmt.Sprintf("%s_%d", base, n)
+		}
+		taken[scenario] = true
+		names[service] = scenario
+	}
+	return names
+}
 
-	// Write test script
-	tmpFile, _ := os.CreateTemp("", "k6-auto-test-*.js")
-	tmpFile.WriteString(testScript)
-	tmpFile.Close()
-	defer os.Remove(tmpFile.Name())
+// serviceBatch is one k6 run of the all-services test
+type serviceBatch struct {
+	// Scenarios maps k6 scenario names to compose service names
+	Scenarios map[string]string
+	Services  []string
+	Script    string
+}
 
-	// Run test
-	runResult, _ := t.deps.DB.Exec("INSERT INTO test_runs (test_id, vus, duration) VALUES (?, ?, ?)",
-		testId, testVus, testDuration)
-	runId, _ := runResult.LastInsertId()
+// allServicesBatches builds the k6 runs for every service with a published
+// port. Services are batched into runs of at most maxConcurrentServices
+// scenarios, each with its own exec function. slas holds each service's
+// endpoint SLAs, which become thresholds on its requests.
+func allServicesBatches(compose ComposeFile, endpoints []string, concurrent bool, vus int, duration string, p95ThresholdMs, maxErrorRate float64, slas map[string]map[string]EndpointSLA, schemes Schemes, tlsOptions TLSOptions) []serviceBatch {
+	names := publishedServices(compose)
+	scenarioFor := scenarioNames(names)
+
+	var batches []serviceBatch
+	for start := 0; start < len(names); start += maxConcurrentServices {
+		batch := names[start:min(start+maxConcurrentServices, len(names))]
+
+		scenarios := make(map[string]string, len(batch))
+		var scenarioBlocks, execFunctions string
+		thresholds := GenerateThresholds(p95ThresholdMs, maxErrorRate)
+		for _, name := range batch {
+			thresholds = withEndpointThresholds(thresholds, false, getTargets(endpoints), slas[name], name)
+			scenario := scenarioFor[name]
+			scenarios[scenario] = name
+			baseURL := LocalBaseURL(schemes.For(name), PublishedPort(compose.Services[name].Ports[0]))
+			scenarioBlocks += fmt.Sprintf(`    %s: {
+      executor: 'constant-vus',
+      vus: %d,
+      duration: '%s',
+      exec: '%s',
+    },
+`, scenario, vus, duration, scenario)
+			execFunctions += fmt.Sprintf(`
+export function %s() {
+  testEndpoints('%s', '%s');
+}
+`, scenario, baseURL, name)
+		}
 
-	outputFile := fmt.Sprintf("/tmp/k6-auto-results-%d.json", runId)
-	k6Cmd := exec.CommandContext(ctx, "k6", "run",
-		"--vus", fmt.Sprintf("%d", testVus),
-		"--duration", testDuration,
-		"--out", fmt.Sprintf("json=%s", outputFile),
-		tmpFile.Name())
+		testScript := fmt.Sprintf(`import http from 'k6/http';
+import { check, group } from 'k6';
 
-	k6Output, _ := k6Cmd.CombinedOutput()
-	report += fmt.Sprintf("- Test completed with %d VUs for %s\n", testVus, testDuration)
-	report += "\n## Results Summary\n"
-	report += "```\n" + string(k6Output) + "\n```\n"
+export const options = {
+  scenarios: {
+%s  },
+  %s
+};
 
-	// Update session
-	t.deps.DB.Exec("UPDATE test_runs SET completed_at = CURRENT_TIMESTAMP WHERE id = ?", runId)
+const endpoints = %s;
 
-	return mcpgolang.NewToolResultText(report), nil
+function testEndpoints(baseUrl, service) {
+%s
 }
+%s`, scenarioBlocks, tlsOptions.Apply(thresholds), GenerateJSArray(endpoints),
+			endpointRequestsJS(concurrent, "baseUrl", ", service: service", p95ThresholdMs), execFunctions)
 
-func (t *TestApplicationTool) sendProgress(ctx context.Context, progress string, data map[string]interface{}) {
-	// Log the progress
-	t.deps.Logger.LogInfo("Progress update", map[string]interface{}{
-		"progress":  progress,
-		"component": "progress",
-		"data":      data,
-	})
+		batches = append(batches, serviceBatch{Scenarios: scenarios, Services: batch, Script: testScript})
+	}
+	return batches
+}
 
-	// Send progress notification to client
-	progressData := map[string]interface{}{
-		"progress":  progress,
-		"timestamp": time.Now().Format(time.RFC3339),
+// publishedServices returns the names of the services with a published
+// port, sorted
+func publishedServices(compose ComposeFile) []string {
+	names := make([]string, 0, len(compose.Services))
+	for name, service := range compose.Services {
+		if len(service.Ports) > 0 {
+			names = append(names, name)
+		}
 	}
-	for k, v := range data {
-		progressData[k] = v
+	sort.Strings(names)
+	return names
+}
+
+// runAllServices load-tests every service with a published port, one k6 run
+// per batch from allServicesBatches, and the report gets one section per service.
+// The error reports runs that k6 failed or that couldn't be started.
+func (t *TestApplicationTool) runAllServices(ctx context.Context, sessionId int64, compose ComposeFile, endpoints []string, concurrent bool, vus int, duration string, p95ThresholdMs, maxErrorRate float64, k6ExtraArgs []string, envVars K6EnvVars, tags RunTags, metadata RunMetadata, schemes Schemes, tlsOptions TLSOptions) (string, error) {
+	slas := map[string]map[string]EndpointSLA{}
+	for name := range compose.Services {
+		serviceSLAs, err := SessionEndpointSLAs(t.deps.DB, sessionId, name)
+		if err != nil {
+			t.deps.Logger.LogError("Failed to load endpoint SLAs", err, map[string]interface{}{
+				"session_id": sessionId,
+				"service":    name,
+			})
+			continue
+		}
+		slas[name] = serviceSLAs
 	}
+	batches := allServicesBatches(compose, endpoints, concurrent, vus, duration, p95ThresholdMs, maxErrorRate, slas, schemes, tlsOptions)
+	// Every service's scenario runs for the same duration, concurrently
+	expected, _ := time.ParseDuration(duration)
+	if len(batches) == 0 {
+		return "- No services with published ports found\n", errors.New("no services with published ports found")
+	}
+
+	resultsDir, err := ResultsDir()
+	if err != nil {
+		return fmt.Sprintf("- %v\n", err), err
+	}
+
+	report := ""
+	failed := 0
+	for i, b := range batches {
+		batch, scenarios, testScript := b.Services, b.Scenarios, b.Script
+		report += fmt.Sprintf("- Testing %d services concurrently (%d VUs each for %s): %s\n",
+			len(batch), vus, duration, strings.Join(batch, ", "))
+		// The batch's services share one k6 run, so their VUs add up
+		if err := CheckVULimit("The batch's VUs", vus*len(batch)); err != nil {
+			report += fmt.Sprintf("- Skipped: %v\n", err)
+			failed++
+			continue
+		}
+		if warning := HighLoadWarning(vus*len(batch), len(endpoints)); warning != "" {
+			report += fmt.Sprintf("- %s\n", warning)
+		}
+
+		testId, err := t.deps.DB.Insert("INSERT INTO tests (session_id, name, type, script) VALUES (?, ?, ?, ?)",
+			sessionId, fmt.Sprintf("auto-all-services-%d", i+1), "all-services", testScript)
+		if err != nil {
+			report += fmt.Sprintf("- Failed to store test: %v\n", err)
+			failed++
+			continue
+		}
 
-	// TODO: Send notification when MCP-Go library supports it
-	// For now, we'll just log the progress
-	t.deps.Logger.LogDebug("Progress notification prepared", progressData)
+		tmpFile, err := os.CreateTemp("", "k6-auto-services-*.js")
+		if err != nil {
+			report += fmt.Sprintf("- Failed to create temp file: %v\n", err)
+			failed++
+			continue
+		}
+		tmpFile.WriteString(testScript)
+		tmpFile.Close()
+
+		runId, _ := t.deps.DB.Insert("INSERT INTO test_runs (test_id, vus, duration) VALUES (?, ?, ?)",
+			testId, vus*len(batch), duration)
+		if err := StoreRunTags(t.deps.DB, runId, tags); err != nil {
+			t.deps.Logger.LogError("Failed to store run tags", err, map[string]interface{}{"run_id": runId})
+		}
+		if _, err := StoreRunMetadata(t.deps.DB, runId, metadata); err != nil {
+			t.deps.Logger.LogError("Failed to store run metadata", err, map[string]interface{}{"run_id": runId})
+		}
+		runRecorded := TrackRun(runId)
+
+		outputFile := K6ResultsPath(resultsDir, runId)
+		t.deps.SendProgress(ctx, "Running concurrent service tests", map[string]interface{}{
+			"step":     3,
+			"services": batch,
+			"run_id":   runId,
+		})
+		// Scenarios define VUs and duration, so no --vus/--duration flags here
+		args := append([]string{"run", "--out", fmt.Sprintf("json=%s", outputFile)}, k6ExtraArgs...)
+		args = append(args, envVars.Args()...)
+		k6Cmd := exec.CommandContext(ctx, K6Binary(), append(args, tmpFile.Name())...)
+		stopProgress := TrackRunProgress(ctx, expected, func(data map[string]interface{}) {
+			data["step"] = 3
+			data["services"] = batch
+			data["run_id"] = runId
+			t.deps.SendProgress(ctx, "Running concurrent service tests", data)
+		})
+		k6Output, k6Stderr, k6Err := RunK6(ctx, k6Cmd)
+		stopProgress()
+		os.Remove(tmpFile.Name())
+
+		t.deps.DB.Exec("UPDATE test_runs SET completed_at = CURRENT_TIMESTAMP, results = ?, stderr = ?, results_file = ?, exit_code = ? WHERE id = ?",
+			string(k6Output), string(k6Stderr), outputFile, K6ExitCode(k6Err), runId)
+		interrupted := RunInterrupted(ctx)
+		if interrupted {
+			if err := MarkRunInterrupted(t.deps.DB, runId); err != nil {
+				t.deps.Logger.LogError("Failed to mark run interrupted", err, map[string]interface{}{"run_id": runId})
+			}
+			report += fmt.Sprintf("- Run %d was interrupted by server shutdown; the partial results are recorded and later batches were not run\n", runId)
+		} else if k6Err != nil {
+			t.deps.Logger.LogError("k6 all-services run failed", k6Err, map[string]interface{}{
+				"run_id":   runId,
+				"services": batch,
+				"stderr":   string(k6Stderr),
+			})
+			report += "- " + K6Failure(fmt.Sprintf("k6 exited with error for run %d", runId), k6Err, nil, k6Stderr) + "\n"
+			if !K6ThresholdsCrossed(k6Err) {
+				failed++
+			}
+		}
+
+		results, err := ParseK6Results(outputFile, "scenario")
+		if err != nil {
+			runRecorded()
+			report += fmt.Sprintf("- Failed to parse results for run %d: %v\n", runId, err)
+			if interrupted {
+				break
+			}
+			continue
+		}
+		// Requests carry a service tag, so history can be filtered by service
+		_, customMetrics, err := ParseAndStoreMetrics(t.deps.DB, runId, outputFile, "")
+		if err != nil {
+			t.deps.Logger.LogError("Failed to store k6 metrics", err, map[string]interface{}{
+				"run_id":      runId,
+				"output_file": outputFile,
+			})
+		}
+		runRecorded()
+
+		for _, scenario := range sortedKeys(scenarios) {
+			name := scenarios[scenario]
+			report += fmt.Sprintf("\n### Service: %s (run %d)\n", name, runId)
+			m, ok := results[scenario]
+			if !ok || m.Requests() == 0 {
+				report += "- No requests recorded\n"
+				continue
+			}
+			report += fmt.Sprintf("- Requests: %d\n", m.Requests())
+			report += fmt.Sprintf("- Avg Response Time: %.2f ms\n", m.Avg())
+			report += fmt.Sprintf("- p95 Response Time: %.2f ms\n", m.Percentile(95))
+			report += fmt.Sprintf("- Error Rate: %.2f%%\n", m.ErrorRate()*100)
+			report += fmt.Sprintf("- Throughput: %.2f req/s\n", m.RPS())
+		}
+		if len(customMetrics) > 0 {
+			report += fmt.Sprintf("\n### Custom Metrics (run %d)\n", runId) + CustomMetricsSection(customMetrics)
+		}
+		if interrupted {
+			break
+		}
+	}
+
+	if failed > 0 {
+		return report, fmt.Errorf("%d of %d k6 runs failed", failed, len(batches))
+	}
+	return report, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// preflightPaths are probed in turn until one of them answers
+var preflightPaths = []string{"/", "/health"}
+
+// probeTarget checks that the service at baseURL responds before it is
+// load-tested, retrying while it is still starting up. It is up once one of
+// preflightPaths answers with a status below 500. The returned line describes
+// the outcome.
+func probeTarget(ctx context.Context, client *http.Client, baseURL string) (string, bool) {
+	var failures []string
+	for _, path := range preflightPaths {
+		status, reachable := probeSpecURL(ctx, client, baseURL+path, nil)
+		if code, err := strconv.Atoi(strings.SplitN(status, " ", 2)[0]); reachable && err == nil && code < 500 {
+			return fmt.Sprintf("answered %s on %s", status, path), true
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", path, status))
+		if !reachable {
+			// Other paths won't get through either
+			break
+		}
+	}
+	return strings.Join(failures, "; "), false
 }
 
+// deadTargetError appends the service logs to a pre-flight failure, since
+// they usually say why the target isn't answering
+func (t *TestApplicationTool) deadTargetError(message string, project *ComposeProject) string {
+	logs, err := project.ServiceLogs()
+	if err != nil {
+		t.deps.Logger.LogError("Failed to collect service logs", err, map[string]interface{}{
+			"project": project.Name,
+		})
+		return message
+	}
+	return message + "\n\n" + ServiceLogsSection(logs)
+}
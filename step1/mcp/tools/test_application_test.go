@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScenarioNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []string
+		want     map[string]string
+	}{
+		{
+			name:     "distinct names",
+			services: []string{"api", "web-ui"},
+			want:     map[string]string{"api": "svc_api", "web-ui": "svc_web_ui"},
+		},
+		{
+			name:     "names that sanitize alike",
+			services: []string{"my_svc", "my-svc", "my.svc"},
+			want:     map[string]string{"my-svc": "svc_my_svc", "my.svc": "svc_my_svc_2", "my_svc": "svc_my_svc_3"},
+		},
+		{
+			name:     "suffix taken by another service",
+			services: []string{"a-b", "a_b", "a_b_2"},
+			want:     map[string]string{"a-b": "svc_a_b", "a_b": "svc_a_b_2", "a_b_2": "svc_a_b_2_2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scenarioNames(tt.services); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scenarioNames(%v) = %v, want %v", tt.services, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllServicesBatchesKeepsCollidingServices(t *testing.T) {
+	compose := ComposeFile{Services: map[string]Service{
+		"my-svc": {Ports: []string{"8080:80"}},
+		"my_svc": {Ports: []string{"8081:80"}},
+	}}
+
+	batches := allServicesBatches(compose, []string{"/"}, false, 1, "10s", 500, 0.1, nil, Schemes{Default: "http"}, TLSOptions{})
+	if len(batches) != 1 {
+		t.Fatalf("got %d batches, want 1", len(batches))
+	}
+	batch := batches[0]
+	want := map[string]string{"svc_my_svc": "my-svc", "svc_my_svc_2": "my_svc"}
+	if !reflect.DeepEqual(batch.Scenarios, want) {
+		t.Errorf("Scenarios = %v, want %v", batch.Scenarios, want)
+	}
+	for scenario := range want {
+		if !strings.Contains(batch.Script, "export function "+scenario+"()") {
+			t.Errorf("script has no exec function for %s", scenario)
+		}
+	}
+}
+
+func TestRunAllServicesCountsUnstoredTestAsFailed(t *testing.T) {
+	db := openTestDB(t)
+	previous := settings
+	settings.ResultsDir = t.TempDir()
+	t.Cleanup(func() { settings = previous })
+
+	sessionId := mustInsert(t, db, "INSERT INTO test_sessions (session_name) VALUES ('unstored')")
+	// Without the tests table, storing the batch's test fails
+	if _, err := db.Exec("DROP TABLE tests"); err != nil {
+		t.Fatalf("failed to drop tests: %v", err)
+	}
+
+	tool := NewTestApplicationTool(&SharedDependencies{DB: db})
+	compose := ComposeFile{Services: map[string]Service{"api": {Ports: []string{"8080:80"}}}}
+	report, err := tool.runAllServices(context.Background(), sessionId, compose, []string{"/"}, false, 1, "10s", 500, 0.1,
+		nil, nil, nil, RunMetadata{}, Schemes{Default: "http"}, TLSOptions{})
+	if err == nil || err.Error() != "1 of 1 k6 runs failed" {
+		t.Errorf("err = %v, want the run counted as failed", err)
+	}
+	if !strings.Contains(report, "Failed to store test") {
+		t.Errorf("report doesn't say the test wasn't stored:\n%s", report)
+	}
+}
@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TLSOptions are the TLS and HTTP/2 settings of a generated HTTP test
+type TLSOptions struct {
+	// InsecureSkipTLSVerify accepts self-signed and otherwise untrusted
+	// certificates, as staging environments often have
+	InsecureSkipTLSVerify bool
+	// HTTP2 requires requests to use HTTP/2. k6 negotiates it by itself over
+	// https, so this needs https URLs and makes a fallback to HTTP/1.1 fail
+	// the run rather than go unnoticed.
+	HTTP2 bool
+}
+
+// NewTLSOptions reads the insecureSkipTLSVerify and http2 parameters
+func NewTLSOptions(insecureSkipTLSVerify, http2 string) TLSOptions {
+	return TLSOptions{
+		InsecureSkipTLSVerify: insecureSkipTLSVerify == "true",
+		HTTP2:                 http2 == "true",
+	}
+}
+
+// Set reports whether any option was asked for
+func (o TLSOptions) Set() bool {
+	return o.InsecureSkipTLSVerify || o.HTTP2
+}
+
+// DefaultScheme is the scheme targets are reached with unless one is given:
+// https with HTTP2, since k6 only negotiates HTTP/2 over TLS
+func (o TLSOptions) DefaultScheme() string {
+	if o.HTTP2 {
+		return "https"
+	}
+	return "http"
+}
+
+// CheckScheme rejects HTTP2 for a target reached over plain http
+func (o TLSOptions) CheckScheme(target, scheme string) error {
+	if o.HTTP2 && scheme != "https" {
+		return fmt.Errorf("http2 requires https, but %s uses %s: k6 only negotiates HTTP/2 over TLS", target, scheme)
+	}
+	return nil
+}
+
+// Apply adds the options to the thresholds entry of a script's options, as
+// returned by GenerateThresholds, and returns what replaces it
+func (o TLSOptions) Apply(thresholds string) string {
+	if o.HTTP2 {
+		// k6 tags each request with the protocol it negotiated
+		thresholds = strings.TrimSuffix(thresholds, "  },") + "    'http_reqs{proto:HTTP/1.1}': ['count==0'],\n  },"
+	}
+	if o.InsecureSkipTLSVerify {
+		thresholds = "insecureSkipTLSVerify: true,\n  " + thresholds
+	}
+	return thresholds
+}
+
+// Schemes are the URL schemes services are reached with
+type Schemes struct {
+	Default  string
+	Services map[string]string
+}
+
+// For returns the scheme for a service
+func (s Schemes) For(service string) string {
+	if scheme, ok := s.Services[service]; ok {
+		return scheme
+	}
+	return s.Default
+}
+
+// ParseSchemes parses a comma-separated list of schemes, where each entry is
+// either "service=https" or a bare "https" applying to all other services,
+// like ParseBasePaths. Services without an entry use defaultScheme.
+func ParseSchemes(list, defaultScheme string) (Schemes, error) {
+	schemes := Schemes{Default: defaultScheme, Services: make(map[string]string)}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		service, scheme, scoped := strings.Cut(item, "=")
+		if !scoped {
+			scheme = service
+		}
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme != "http" && scheme != "https" {
+			return schemes, fmt.Errorf("entry %q has scheme %q: must be http or https", item, scheme)
+		}
+
+		if !scoped {
+			schemes.Default = scheme
+			continue
+		}
+		service = strings.TrimSpace(service)
+		if service == "" {
+			return schemes, fmt.Errorf("entry %q is missing a service name", item)
+		}
+		schemes.Services[service] = scheme
+	}
+	return schemes, nil
+}
+
+// LocalBaseURL returns the URL a service published on port is reached at
+func LocalBaseURL(scheme, port string) string {
+	return fmt.Sprintf("%s://localhost:%s", scheme, port)
+}
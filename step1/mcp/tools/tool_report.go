@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// ToolReport is a tool's result, built once and rendered both as markdown
+// for people and as JSON for automation, so the two can't disagree
+type ToolReport struct {
+	// Title heads the markdown, e.g. "Performance Analysis"
+	Title string `json:"title"`
+	// Status is the outcome in a word or two, e.g. PASS or regressed
+	Status string `json:"status"`
+	// Summary is the outcome in a sentence, shown in bold under the title
+	Summary string `json:"summary,omitempty"`
+	// Sections are the markdown body, in order
+	Sections []ReportSection `json:"sections,omitempty"`
+	// Metrics are the headline numbers, by name
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// Artifacts are the paths of files the tool kept, by name
+	Artifacts map[string]string `json:"artifacts,omitempty"`
+	// Errors are problems that didn't stop the tool
+	Errors []string `json:"errors,omitempty"`
+	// Data is the tool's own machine-readable result, such as a RunSummary
+	Data interface{} `json:"data,omitempty"`
+}
+
+// ReportSection is a part of a report's markdown body. Sections without a
+// heading continue the one before.
+type ReportSection struct {
+	Heading string `json:"heading,omitempty"`
+	Body    string `json:"body"`
+}
+
+// AddSection appends a section; an empty body is skipped
+func (r *ToolReport) AddSection(heading, body string) {
+	if strings.TrimSpace(body) == "" {
+		return
+	}
+	r.Sections = append(r.Sections, ReportSection{Heading: heading, Body: body})
+}
+
+// AddMetric records a headline number
+func (r *ToolReport) AddMetric(name string, value float64) {
+	if r.Metrics == nil {
+		r.Metrics = make(map[string]float64)
+	}
+	r.Metrics[name] = value
+}
+
+// AddError records a problem that didn't stop the tool
+func (r *ToolReport) AddError(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// Markdown renders the report: the title, the summary in bold, the
+// sections, then the errors and artifacts
+func (r ToolReport) Markdown() string {
+	var md strings.Builder
+	fmt.Fprintf(&md, "# %s\n\n", r.Title)
+	if r.Summary != "" {
+		fmt.Fprintf(&md, "**%s**\n\n", r.Summary)
+	}
+	for _, section := range r.Sections {
+		if section.Heading != "" {
+			fmt.Fprintf(&md, "## %s\n\n", section.Heading)
+		}
+		md.WriteString(strings.TrimRight(section.Body, "\n") + "\n\n")
+	}
+	if len(r.Errors) > 0 {
+		md.WriteString("## Errors\n\n")
+		for _, err := range r.Errors {
+			fmt.Fprintf(&md, "- %s\n", err)
+		}
+		md.WriteString("\n")
+	}
+	if len(r.Artifacts) > 0 {
+		names := make([]string, 0, len(r.Artifacts))
+		for name := range r.Artifacts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		md.WriteString("## Artifacts\n\n")
+		for _, name := range names {
+			fmt.Fprintf(&md, "- %s: %s\n", name, r.Artifacts[name])
+		}
+		md.WriteString("\n")
+	}
+	return strings.TrimRight(md.String(), "\n") + "\n"
+}
+
+// JSON renders the report as indented JSON
+func (r ToolReport) JSON() string {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Sprintf(`{"title": %q, "errors": [%q]}`, r.Title, err.Error())
+	}
+	return string(data)
+}
+
+// Result returns the report as a tool result: the markdown, followed by the
+// JSON as a separate content block
+func (r ToolReport) Result() *mcpgolang.CallToolResult {
+	result := mcpgolang.NewToolResultText(r.Markdown())
+	result.Content = append(result.Content, mcpgolang.NewTextContent(r.JSON()))
+	return result
+}
+
+// DataResult returns the report for a tool whose result was its data as JSON
+// before it had a report: that JSON stays the first content block, for the
+// clients that read it, followed by the markdown
+func (r ToolReport) DataResult() *mcpgolang.CallToolResult {
+	data, err := json.MarshalIndent(r.Data, "", "  ")
+	if err != nil {
+		return r.Result()
+	}
+	result := mcpgolang.NewToolResultText(string(data))
+	result.Content = append(result.Content, mcpgolang.NewTextContent(r.Markdown()))
+	return result
+}
@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// Trend classifications
+const (
+	TrendImproving = "improving"
+	TrendStable    = "stable"
+	TrendDegrading = "degrading"
+)
+
+// minTrendRuns is the fewest runs a trend is fitted to
+const minTrendRuns = 3
+
+// TrendTool handles the trend tool
+type TrendTool struct {
+	deps *SharedDependencies
+}
+
+// NewTrendTool creates a new instance of TrendTool
+func NewTrendTool(deps *SharedDependencies) *TrendTool {
+	return &TrendTool{deps: deps}
+}
+
+// TrendPoint is one run's p95 for the endpoint
+type TrendPoint struct {
+	RunID     int64     `json:"run_id"`
+	StartedAt time.Time `json:"started_at"`
+	P95Ms     float64   `json:"p95_ms"`
+}
+
+// EndpointTrend is the machine-readable result of the trend tool
+type EndpointTrend struct {
+	Endpoint string       `json:"endpoint"`
+	Days     int          `json:"days"`
+	Runs     []TrendPoint `json:"runs"`
+	// SlopeMsPerDay is the least-squares fit of p95 against time
+	SlopeMsPerDay float64 `json:"slope_ms_per_day"`
+	// ChangePct is the fitted change over the runs' span, relative to their mean p95
+	ChangePct      float64 `json:"change_pct"`
+	Classification string  `json:"classification"`
+}
+
+// Handle processes the trend request
+func (t *TrendTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	endpoint, err := request.RequireString("endpoint")
+	if err != nil {
+		return mcpgolang.NewToolResultError("Missing required endpoint"), nil
+	}
+	filter, err := historyFilterFromRequest(request)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	filter.Endpoint = endpoint
+	// A week, the history default, rarely holds enough runs to show creep
+	filter.Days = int(request.GetFloat("days", 30))
+	thresholdPct := request.GetFloat("thresholdPct", DefaultRegressionThresholdPct)
+	if thresholdPct < 0 {
+		return mcpgolang.NewToolResultError("thresholdPct must not be negative"), nil
+	}
+
+	// One point per run; all-services runs can record an endpoint once per
+	// service, so narrow them with service or they are averaged
+	from, args := filter.From(t.deps.DB)
+	rows, err := t.deps.DB.Query(`
+		SELECT tr.id, tr.started_at, AVG(m.p95_response_time)`+from+`
+			AND m.p95_response_time IS NOT NULL
+		GROUP BY tr.id, tr.started_at
+		ORDER BY tr.started_at, tr.id`, args...)
+	if err != nil {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("Query failed: %v", err)), nil
+	}
+	points := []TrendPoint{}
+	for rows.Next() {
+		var p TrendPoint
+		if err := rows.Scan(&p.RunID, &p.StartedAt, &p.P95Ms); err != nil {
+			rows.Close()
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Failed to read metrics: %v", err)), nil
+		}
+		points = append(points, p)
+	}
+	rows.Close()
+
+	if len(points) < minTrendRuns {
+		return mcpgolang.NewToolResultError(fmt.Sprintf("%s has p95 metrics from %d runs in the last %d days; a trend needs at least %d",
+			endpoint, len(points), filter.Days, minTrendRuns)), nil
+	}
+
+	trend := EndpointTrend{Endpoint: endpoint, Days: filter.Days, Runs: points}
+	trend.SlopeMsPerDay, trend.ChangePct = fitTrend(points)
+	switch {
+	case math.Abs(trend.ChangePct) <= thresholdPct:
+		trend.Classification = TrendStable
+	case trend.ChangePct > 0:
+		trend.Classification = TrendDegrading
+	default:
+		trend.Classification = TrendImproving
+	}
+
+	report := ToolReport{
+		Title:  fmt.Sprintf("p95 Trend: %s", endpoint),
+		Status: trend.Classification,
+		Summary: fmt.Sprintf("%s: %+.2f ms/day, %+.1f%% over %d runs in the last %d days (threshold ±%.1f%%)",
+			trend.Classification, trend.SlopeMsPerDay, trend.ChangePct, len(points), filter.Days, thresholdPct),
+		Data: trend,
+	}
+	report.AddMetric("slope_ms_per_day", trend.SlopeMsPerDay)
+	report.AddMetric("change_pct", trend.ChangePct)
+	report.AddMetric("runs", float64(len(points)))
+	table := "| Run | Started | p95 (ms) |\n|---|---|---|\n"
+	for _, p := range points {
+		table += fmt.Sprintf("| %d | %s | %.2f |\n", p.RunID, p.StartedAt.Format("2006-01-02 15:04"), p.P95Ms)
+	}
+	report.AddSection("", table)
+
+	return report.Result(), nil
+}
+
+// fitTrend fits p95 against days since the first run by least squares. It
+// returns the slope in ms per day and the fitted change across the runs'
+// span as a percent of their mean p95; both are 0 when the runs all started
+// at the same time.
+func fitTrend(points []TrendPoint) (slope, changePct float64) {
+	n := float64(len(points))
+	first := points[0].StartedAt
+	var sumX, sumY float64
+	for _, p := range points {
+		sumX += p.StartedAt.Sub(first).Hours() / 24
+		sumY += p.P95Ms
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var sxy, sxx float64
+	for _, p := range points {
+		dx := p.StartedAt.Sub(first).Hours()/24 - meanX
+		sxy += dx * (p.P95Ms - meanY)
+		sxx += dx * dx
+	}
+	if sxx == 0 {
+		return 0, 0
+	}
+	slope = sxy / sxx
+
+	span := points[len(points)-1].StartedAt.Sub(first).Hours() / 24
+	if meanY != 0 {
+		changePct = slope * span / meanY * 100
+	}
+	return slope, changePct
+}
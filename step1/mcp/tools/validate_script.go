@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mcpgolang "github.com/mark3labs/mcp-go/mcp"
+)
+
+// validateTimeout bounds k6 inspect, which only evaluates the init context
+const validateTimeout = 30 * time.Second
+
+// ScriptInspection is what k6 inspect made of a script
+type ScriptInspection struct {
+	Valid bool
+	// Options is k6's JSON output for a valid script
+	Options string
+	// Problem is k6's error output for an invalid script
+	Problem string
+	// TotalDuration is the longest the script's load can run, e.g. "1m30s",
+	// or empty if k6 didn't report it
+	TotalDuration string
+}
+
+// InspectK6Script checks a script with k6 inspect --execution-requirements,
+// which runs the init context and validates the options and scenarios
+// without starting any VUs. testData, if set, is written next to the script
+// for open() calls. The error is only for failures to run the check.
+func InspectK6Script(ctx context.Context, script, testData string) (*ScriptInspection, error) {
+	dir, err := os.MkdirTemp("", TempDirPrefix+"validate-")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	scriptPath := filepath.Join(dir, "script.js")
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		return nil, fmt.Errorf("Failed to write script: %v", err)
+	}
+	if testData != "" {
+		if err := os.WriteFile(filepath.Join(dir, TestDataFileName), []byte(testData), 0644); err != nil {
+			return nil, fmt.Errorf("Failed to write test data: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, validateTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, K6Binary(), "inspect", "--execution-requirements", scriptPath)
+	output, stderr, err := RunK6(ctx, cmd)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("Validation timed out after %s: the script's init context may be waiting on the network", validateTimeout)
+	}
+	if err != nil {
+		// k6 names the temp file in its errors; the client never saw it
+		problem := strings.ReplaceAll(strings.TrimSpace(string(stderr)+"\n"+string(output)), scriptPath, "script.js")
+		return &ScriptInspection{Problem: problem}, nil
+	}
+
+	inspection := &ScriptInspection{Valid: true, Options: strings.TrimSpace(string(output))}
+	var requirements struct {
+		TotalDuration string `json:"totalDuration"`
+	}
+	if json.Unmarshal(output, &requirements) == nil {
+		inspection.TotalDuration = requirements.TotalDuration
+	}
+	return inspection, nil
+}
+
+// ValidateScriptTool handles the validate_script tool
+type ValidateScriptTool struct {
+	deps *SharedDependencies
+}
+
+// NewValidateScriptTool creates a new instance of ValidateScriptTool
+func NewValidateScriptTool(deps *SharedDependencies) *ValidateScriptTool {
+	return &ValidateScriptTool{deps: deps}
+}
+
+// Handle processes the validate_script request
+func (t *ValidateScriptTool) Handle(ctx context.Context, request mcpgolang.CallToolRequest) (*mcpgolang.CallToolResult, error) {
+	script := request.GetString("script", "")
+	testId := request.GetString("testId", "")
+	if (script == "") == (testId == "") {
+		return mcpgolang.NewToolResultError("Provide either script or testId"), nil
+	}
+
+	source := "Script"
+	var testData sql.NullString
+	if testId != "" {
+		err := t.deps.DB.QueryRow("SELECT script, test_data FROM tests WHERE id = ?", testId).Scan(&script, &testData)
+		if err != nil {
+			return mcpgolang.NewToolResultError(fmt.Sprintf("Test not found: %v", err)), nil
+		}
+		source = fmt.Sprintf("Test %s", testId)
+	}
+
+	// Data-driven tests open() their CSV in the init context
+	inspection, err := InspectK6Script(ctx, script, testData.String)
+	if err != nil {
+		return mcpgolang.NewToolResultError(err.Error()), nil
+	}
+	if !inspection.Valid {
+		t.deps.Logger.LogDebug("Script failed validation", map[string]interface{}{
+			"test_id": testId,
+			"problem": inspection.Problem,
+		})
+		return mcpgolang.NewToolResultText(fmt.Sprintf("# Script Validation\n\n%s is not valid k6:\n\n```\n%s\n```\n", source, inspection.Problem)), nil
+	}
+
+	return mcpgolang.NewToolResultText(fmt.Sprintf("# Script Validation\n\n%s is valid k6. Options as k6 resolved them:\n\n```json\n%s\n```\n",
+		source, inspection.Options)), nil
+}
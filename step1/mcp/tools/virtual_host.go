@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// VirtualHost addresses a service by the name a shared ingress or reverse
+// proxy routes on, rather than only by the port it is published on
+type VirtualHost struct {
+	// HostHeader is sent as the Host header of every request, since a proxy
+	// reached at localhost answers 404 for hosts it doesn't route
+	HostHeader string
+	// BasePath prefixes every request path, for services the proxy mounts
+	// under a path, e.g. /orders
+	BasePath string
+}
+
+// hostHeaderRegex matches a host name or IPv4 address with an optional port
+var hostHeaderRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:\d{1,5})?$`)
+
+// ParseVirtualHost reads the hostHeader and basePath parameters. The base
+// path is normalized like ParseBasePaths, so "api/" becomes "/api".
+func ParseVirtualHost(hostHeader, basePath string) (VirtualHost, error) {
+	host := VirtualHost{HostHeader: strings.TrimSpace(hostHeader)}
+	if host.HostHeader != "" && !hostHeaderRegex.MatchString(host.HostHeader) {
+		return host, fmt.Errorf("hostHeader %q must be a host name with an optional port, e.g. api.example.com or api.local:8080", hostHeader)
+	}
+
+	prefix := strings.Trim(strings.TrimSpace(basePath), "/")
+	if strings.ContainsAny(prefix, "?#\\ \t'") {
+		return host, fmt.Errorf("basePath %q must be a plain path prefix, without a query string, fragment, quotes or spaces", basePath)
+	}
+	if prefix != "" {
+		host.BasePath = "/" + prefix
+	}
+	return host, nil
+}
+
+// Set reports whether either option was asked for
+func (v VirtualHost) Set() bool {
+	return v.HostHeader != "" || v.BasePath != ""
+}
+
+// BaseURLJS returns the JavaScript expression for a script's BASE_URL. The
+// base path is appended to BASE_URL from envVars too, so a run can point the
+// script at another proxy without losing the prefix.
+func (v VirtualHost) BaseURLJS(baseURL string) string {
+	if v.BasePath == "" {
+		return fmt.Sprintf("__ENV.BASE_URL || '%s'", baseURL)
+	}
+	return fmt.Sprintf("(__ENV.BASE_URL || '%s') + '%s'", baseURL, v.BasePath)
+}
+
+// HeadersJS returns the JavaScript object of the headers every request of a
+// script sends
+func (v VirtualHost) HeadersJS() string {
+	if v.HostHeader == "" {
+		return "{}"
+	}
+	return fmt.Sprintf("{ Host: '%s' }", v.HostHeader)
+}